@@ -0,0 +1,103 @@
+package datatrans
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// currencyExponents lists the ISO 4217 currencies with a minor unit other
+// than 2.
+var currencyExponents = map[string]int{
+	"BIF": 0, "CLP": 0, "DJF": 0, "GNF": 0, "ISK": 0, "JPY": 0, "KMF": 0,
+	"KRW": 0, "PYG": 0, "RWF": 0, "UGX": 0, "VND": 0, "VUV": 0, "XAF": 0,
+	"XOF": 0, "XPF": 0,
+	"BHD": 3, "IQD": 3, "JOD": 3, "KWD": 3, "LYD": 3, "OMR": 3, "TND": 3,
+}
+
+// CurrencyExponent returns the number of decimal places of the minor unit of
+// a currency, e.g. 2 for CHF and 0 for JPY. Unknown currencies default to 2.
+func CurrencyExponent(currency string) int {
+	if e, ok := currencyExponents[strings.ToUpper(currency)]; ok {
+		return e
+	}
+	return 2
+}
+
+// ParseAmount converts a decimal amount like "19.99" into minor units of the
+// currency as required by datatrans, e.g. 1999 for CHF. The dot is the only
+// accepted decimal separator, grouping characters ' _ and spaces are ignored.
+// A comma is only accepted between groups of three digits before the decimal
+// point, like "1,234.50", so that "19,99" does not become 1999.00. More
+// decimal places than the currency supports and negative amounts are
+// rejected. No floating point arithmetic is involved.
+func ParseAmount(decimal, currency string) (int, error) {
+	s := strings.NewReplacer("'", "", "_", "", " ", "").Replace(decimal)
+	if strings.IndexByte(s, ',') >= 0 {
+		if !validCommaGrouping(s) {
+			return 0, fmt.Errorf("invalid amount %q: comma is only allowed as thousands separator", decimal)
+		}
+		s = strings.Replace(s, ",", "", -1)
+	}
+	exp := CurrencyExponent(currency)
+
+	intPart, fracPart := s, ""
+	if idx := strings.IndexByte(s, '.'); idx >= 0 {
+		intPart, fracPart = s[:idx], s[idx+1:]
+	}
+	if intPart == "" && fracPart == "" || !isDigits(intPart) || !isDigits(fracPart) {
+		return 0, fmt.Errorf("invalid amount %q", decimal)
+	}
+	if len(fracPart) > exp {
+		return 0, fmt.Errorf("amount %q has more than %d decimal places for currency %s", decimal, exp, currency)
+	}
+	fracPart += strings.Repeat("0", exp-len(fracPart))
+
+	minor, err := strconv.ParseInt(intPart+fracPart, 10, 64)
+	if err != nil || minor > math.MaxInt32 {
+		return 0, fmt.Errorf("amount %q out of range", decimal)
+	}
+	return int(minor), nil
+}
+
+// validCommaGrouping reports whether the commas of s only separate groups of
+// three digits in front of the decimal point.
+func validCommaGrouping(s string) bool {
+	intPart := s
+	if idx := strings.IndexByte(s, '.'); idx >= 0 {
+		if strings.IndexByte(s[idx:], ',') >= 0 {
+			return false
+		}
+		intPart = s[:idx]
+	}
+	groups := strings.Split(intPart, ",")
+	if len(groups[0]) < 1 || len(groups[0]) > 3 {
+		return false
+	}
+	for _, g := range groups[1:] {
+		if len(g) != 3 {
+			return false
+		}
+	}
+	return true
+}
+
+// FormatAmount formats an amount in minor units as decimal string, e.g. 1999
+// in CHF as "19.99". It is the reverse of ParseAmount without grouping.
+func FormatAmount(minor int, currency string) string {
+	exp := CurrencyExponent(currency)
+	sign := ""
+	if minor < 0 {
+		sign = "-"
+		minor = -minor
+	}
+	s := strconv.Itoa(minor)
+	if exp == 0 {
+		return sign + s
+	}
+	if len(s) <= exp {
+		s = strings.Repeat("0", exp-len(s)+1) + s
+	}
+	return sign + s[:len(s)-exp] + "." + s[len(s)-exp:]
+}
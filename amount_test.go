@@ -0,0 +1,69 @@
+package datatrans_test
+
+import (
+	"testing"
+
+	"github.com/globusdigital/datatrans"
+)
+
+func TestParseAmount(t *testing.T) {
+	tests := []struct {
+		decimal  string
+		currency string
+		want     int
+		wantErr  bool
+	}{
+		{"19.99", "CHF", 1999, false},
+		{"19.9", "CHF", 1990, false},
+		{"19", "CHF", 1900, false},
+		{".5", "EUR", 50, false},
+		{"1'234.50", "CHF", 123450, false},
+		{"1,234.50", "USD", 123450, false},
+		{"1,234,567", "USD", 123456700, false},
+		{"19,99", "CHF", 0, true},
+		{"1,2", "CHF", 0, true},
+		{",123", "CHF", 0, true},
+		{"1234,567", "CHF", 0, true},
+		{"1.234,5", "EUR", 0, true},
+		{"1000", "JPY", 1000, false},
+		{"1.234", "KWD", 1234, false},
+		{"19.999", "CHF", 0, true},
+		{"1000.5", "JPY", 0, true},
+		{"-19.99", "CHF", 0, true},
+		{"19.99.1", "CHF", 0, true},
+		{"abc", "CHF", 0, true},
+		{"", "CHF", 0, true},
+		{".", "CHF", 0, true},
+		{"99999999999999999999", "CHF", 0, true},
+	}
+	for _, tt := range tests {
+		have, err := datatrans.ParseAmount(tt.decimal, tt.currency)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%q %s: unexpected error: %v", tt.decimal, tt.currency, err)
+			continue
+		}
+		if have != tt.want {
+			t.Errorf("%q %s: want %d, have %d", tt.decimal, tt.currency, tt.want, have)
+		}
+	}
+}
+
+func TestFormatAmount(t *testing.T) {
+	tests := []struct {
+		minor    int
+		currency string
+		want     string
+	}{
+		{1999, "CHF", "19.99"},
+		{5, "CHF", "0.05"},
+		{0, "CHF", "0.00"},
+		{-1999, "EUR", "-19.99"},
+		{1000, "JPY", "1000"},
+		{1234, "KWD", "1.234"},
+	}
+	for _, tt := range tests {
+		if have := datatrans.FormatAmount(tt.minor, tt.currency); have != tt.want {
+			t.Errorf("%d %s: want %q, have %q", tt.minor, tt.currency, tt.want, have)
+		}
+	}
+}
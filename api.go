@@ -0,0 +1,38 @@
+package datatrans
+
+import "context"
+
+// API contains the transaction related methods of Client so that consumers
+// can depend on the interface and substitute fakes in their tests. Merchant
+// selection with WithMerchant and the configuration getters are not part of
+// it, pass the client returned by WithMerchant instead.
+type API interface {
+	Status(ctx context.Context, transactionID string) (*ResponseStatus, error)
+	StatusBatch(ctx context.Context, ids []string, concurrency int) (map[string]*ResponseStatus, map[string]error)
+	VerifyCredentials(ctx context.Context, internalID string) error
+	Credit(ctx context.Context, transactionID string, rc RequestCredit) (*ResponseCardMasked, error)
+	CreditAuthorize(ctx context.Context, rca RequestCreditAuthorize) (*ResponseCardMasked, error)
+	Cancel(ctx context.Context, transactionID string, refno string) error
+	CancelWith(ctx context.Context, transactionID string, rc RequestCancel) error
+	Settle(ctx context.Context, transactionID string, rs RequestSettle) error
+	SettlePartialAndReleaseRemainder(ctx context.Context, transactionID, refno, currency string, captureAmount int) (*ResponseSettlePartial, error)
+	ValidateAlias(ctx context.Context, rva RequestValidateAlias) (*ResponseCardMasked, error)
+	AuthorizeTransaction(ctx context.Context, transactionID string, rva RequestAuthorizeTransaction) (*ResponseAuthorize, error)
+	ThreeDSContinue(ctx context.Context, transactionID string, rtc RequestThreeDSContinue) (*ResponseAuthorize, error)
+	Authorize(ctx context.Context, rva RequestAuthorize) (*ResponseCardMasked, error)
+	AuthorizeWithStepUp(ctx context.Context, rva RequestAuthorize, threeD ThreeD) (*ResponseCardMasked, error)
+	ReauthorizeByAlias(ctx context.Context, alias string, rva RequestAuthorize) (*ResponseCardMasked, error)
+	AuthorizeAndSettle(ctx context.Context, rva RequestAuthorize) (*ResponseAuthorizeAndSettle, error)
+	Initialize(ctx context.Context, rva RequestInitialize) (*ResponseInitialize, error)
+	SecureFieldsInit(ctx context.Context, rva RequestSecureFieldsInit) (*ResponseInitialize, error)
+	SecureFieldsUpdate(ctx context.Context, transactionID string, rva RequestSecureFieldsUpdate) error
+	AliasConvert(ctx context.Context, legacyAlias string) (string, error)
+	AliasConvertDetails(ctx context.Context, legacyAlias string) (*ResponseAliasConvert, error)
+	AliasDelete(ctx context.Context, alias string) error
+	AliasDeleteIfExists(ctx context.Context, alias string) error
+	ReconciliationsSales(ctx context.Context, sale RequestReconciliationsSale) (*ResponseReconciliationsSale, error)
+	ReconciliationsSalesBulk(ctx context.Context, sales RequestReconciliationsSales) (*ResponseReconciliationsSales, error)
+	ReconciliationsSalesBulkStream(ctx context.Context, sales RequestReconciliationsSales, batchSize int) (*ResponseReconciliationsSales, error)
+}
+
+var _ API = (*Client)(nil)
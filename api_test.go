@@ -0,0 +1,37 @@
+package datatrans_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/globusdigital/datatrans"
+)
+
+// fakeAPI overrides only the methods needed by the code under test, calling
+// any other method panics because of the nil embedded interface.
+type fakeAPI struct {
+	datatrans.API
+	settled []string
+}
+
+func (f *fakeAPI) Settle(ctx context.Context, transactionID string, rs datatrans.RequestSettle) error {
+	f.settled = append(f.settled, transactionID)
+	return nil
+}
+
+// shipOrder represents consumer code which depends on the interface.
+func shipOrder(ctx context.Context, api datatrans.API, transactionID string) error {
+	return api.Settle(ctx, transactionID, datatrans.RequestSettle{Amount: 1337, Currency: "CHF", RefNo: "872732"})
+}
+
+func TestAPI_Fake(t *testing.T) {
+	fake := &fakeAPI{}
+	must(t, shipOrder(context.Background(), fake, "210215103042148501"))
+	if len(fake.settled) != 1 || fake.settled[0] != "210215103042148501" {
+		t.Errorf("settle not called: %v", fake.settled)
+	}
+
+	c, err := datatrans.MakeClient(datatrans.OptionMerchant{MerchantID: "322342", Password: "sfdgsdfg"})
+	must(t, err)
+	var _ datatrans.API = &c
+}
@@ -0,0 +1,138 @@
+package datatrans
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// panPattern matches a standalone sequence of 13 to 19 digits, the length of
+// card numbers, optionally preceded by its JSON key.
+var panPattern = regexp.MustCompile(`(?:"(\w+)"\s*:\s*"?)?\b(\d{13,19})\b`)
+
+// panIgnoredKeys contains JSON keys whose values might look like a card number
+// but are not.
+var panIgnoredKeys = map[string]bool{
+	"transactionId": true,
+	"merchantId":    true,
+	"refno":         true,
+	"refno2":        true,
+}
+
+// redactPAN masks all digits of Luhn valid card numbers except the first six
+// and the last four, like the masked card numbers returned by datatrans, and
+// masks the result further according to level. Returns a copy, body is not
+// modified.
+func redactPAN(body []byte, level string) []byte {
+	if body == nil {
+		return nil
+	}
+	return panPattern.ReplaceAllFunc(body, func(match []byte) []byte {
+		sub := panPattern.FindSubmatchIndex(match)
+		key := ""
+		if sub[2] >= 0 {
+			key = string(match[sub[2]:sub[3]])
+		}
+		digits := match[sub[4]:sub[5]]
+		if panIgnoredKeys[key] || !luhnValid(digits) {
+			return match
+		}
+		masked := append([]byte(nil), match...)
+		for i := sub[4] + 6; i < sub[5]-4; i++ {
+			masked[i] = 'x'
+		}
+		if level != MaskNone {
+			copy(masked[sub[4]:], maskLevel(string(masked[sub[4]:sub[5]]), level))
+		}
+		return masked
+	})
+}
+
+// luhnValid reports whether digits passes the Luhn checksum.
+func luhnValid(digits []byte) bool {
+	sum := 0
+	double := false
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+// requestBody returns a copy of the request body. Streamed bodies without
+// GetBody cannot be read twice and return nil.
+func requestBody(req *http.Request) []byte {
+	if req.GetBody == nil {
+		return nil
+	}
+	rc, err := req.GetBody()
+	if err != nil {
+		return nil
+	}
+	defer rc.Close()
+	body, _ := ioutil.ReadAll(rc)
+	return body
+}
+
+// operationName maps the method and path of a request to the name of the
+// datatrans API operation, e.g. "settle".
+func operationName(method, path string) string {
+	switch {
+	case path == pathReconciliationsSalesBulk:
+		return "reconciliationsSalesBulk"
+	case path == pathReconciliationsSales:
+		return "reconciliationsSales"
+	case path == pathInitialize:
+		return "initialize"
+	case !strings.HasPrefix(path, pathBase+"/"):
+		return method + " " + path
+	}
+	parts := strings.Split(strings.TrimPrefix(path, pathBase+"/"), "/")
+	switch parts[0] {
+	case "credit":
+		return "creditAuthorize"
+	case "validate":
+		return "validate"
+	case "authorize":
+		return "authorize"
+	case "secureFields":
+		if len(parts) == 1 {
+			return "secureFieldsInit"
+		}
+		return "secureFieldsUpdate"
+	case "aliases":
+		if method == http.MethodDelete {
+			return "aliasDelete"
+		}
+		return "aliasConvert"
+	}
+	switch {
+	case len(parts) == 1:
+		return "status"
+	case parts[1] == "authorize":
+		return "authorizeTransaction"
+	}
+	return parts[1] // credit, cancel, settle
+}
+
+// audit passes both bodies of a request to the audit sink. The rest of the
+// response body gets read first so that the sink receives the full payload.
+func (c *Client) audit(req *http.Request, reqBody []byte, resp *http.Response, respBuf *bytes.Buffer) {
+	status := 0
+	if resp != nil {
+		status = resp.StatusCode
+		if resp.Body != nil {
+			_, _ = respBuf.ReadFrom(resp.Body)
+		}
+	}
+	c.auditSink(req.Context(), operationName(req.Method, req.URL.Path), redactBody(reqBody, c.maskedPANLevel), redactBody(respBuf.Bytes(), c.maskedPANLevel), status)
+}
@@ -0,0 +1,194 @@
+package datatrans_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/globusdigital/datatrans"
+)
+
+type auditRecord struct {
+	op       string
+	reqBody  string
+	respBody string
+	status   int
+}
+
+func TestOptionAuditSink(t *testing.T) {
+	var records []auditRecord
+	respBody := `{"transactionId":"210215103042148501","card":{"number":"4242424242424242","alias":"70119122433810042"}}`
+	status := 200
+	var doErr error
+	c, err := datatrans.MakeClient(
+		datatrans.OptionAuditSink(func(ctx context.Context, op string, reqBody, respBody []byte, status int) {
+			records = append(records, auditRecord{op: op, reqBody: string(reqBody), respBody: string(respBody), status: status})
+		}),
+		datatrans.OptionHTTPRequestFn(func(req *http.Request) (*http.Response, error) {
+			if doErr != nil {
+				return nil, doErr
+			}
+			return &http.Response{
+				StatusCode: status,
+				Body:       ioutil.NopCloser(strings.NewReader(respBody)),
+			}, nil
+		}),
+		datatrans.OptionMerchant{
+			DisableRawJSONBody: true,
+			MerchantID:         "322342",
+			Password:           "sfdgsdfg",
+		},
+	)
+	must(t, err)
+
+	_, err = c.Authorize(context.Background(), datatrans.RequestAuthorize{
+		Amount:   1337,
+		Currency: "CHF",
+		RefNo:    "872732",
+		Card:     &datatrans.Card{Alias: "5555555555554444", AliasCVV: "7e4ba0e1c4"},
+	})
+	must(t, err)
+
+	status, respBody = 401, `{"error":{"code":"UNAUTHORIZED"}}`
+	_, err = c.Status(context.Background(), "210215103042148501")
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+
+	doErr = errors.New("connection refused")
+	if err := c.Settle(context.Background(), "210215103042148501", datatrans.RequestSettle{Amount: 1337, Currency: "CHF", RefNo: "872732"}); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	want := []auditRecord{
+		{
+			op:       "authorize",
+			reqBody:  `{"amount":1337,"currency":"CHF","refno":"872732","card":{"alias":"xxxxxxxxxxxx4444","aliasCVV":"xxxxxxe1c4"}}`,
+			respBody: `{"transactionId":"210215103042148501","card":{"number":"xxxxxxxxxxxx4242","alias":"xxxxxxxxxxxxx0042"}}`,
+			status:   200,
+		},
+		{
+			op:       "status",
+			respBody: `{"error":{"code":"UNAUTHORIZED"}}`,
+			status:   401,
+		},
+		{
+			op:      "settle",
+			reqBody: `{"amount":1337,"currency":"CHF","refno":"872732"}`,
+		},
+	}
+	if len(records) != len(want) {
+		t.Fatalf("invalid number of records: %#v", records)
+	}
+	for i := range want {
+		if records[i] != want[i] {
+			t.Errorf("record %d\nWant: %#v\nHave: %#v", i, want[i], records[i])
+		}
+	}
+}
+
+func TestOptionMaskedPANLevel(t *testing.T) {
+	tests := []struct {
+		level      datatrans.OptionMaskedPANLevel
+		wantMasked string
+		wantNumber string
+	}{
+		{level: datatrans.MaskNone, wantMasked: "520000xxxxxx0080", wantNumber: "424242xxxxxx4242"},
+		{level: datatrans.MaskLast4, wantMasked: "xxxxxxxxxxxx0080", wantNumber: "xxxxxxxxxxxx4242"},
+		{level: datatrans.MaskFull, wantMasked: "xxxxxxxxxxxxxxxx", wantNumber: "xxxxxxxxxxxxxxxx"},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.level), func(t *testing.T) {
+			var auditResp string
+			c, err := datatrans.MakeClient(
+				tt.level,
+				datatrans.OptionAuditSink(func(ctx context.Context, op string, reqBody, respBody []byte, status int) {
+					auditResp = string(respBody)
+				}),
+				datatrans.OptionHTTPRequestFn(func(req *http.Request) (*http.Response, error) {
+					return &http.Response{
+						StatusCode: 400,
+						Body:       ioutil.NopCloser(strings.NewReader(`{"error":{"code":"INVALID_PROPERTY"},"card":{"masked":"520000xxxxxx0080"}}`)),
+					}, nil
+				}),
+				datatrans.OptionMerchant{
+					MerchantID: "322342",
+					Password:   "sfdgsdfg",
+				},
+			)
+			must(t, err)
+
+			_, err = c.Authorize(context.Background(), datatrans.RequestAuthorize{
+				Amount:       1337,
+				Currency:     "CHF",
+				RefNo:        "872732",
+				CustomFields: datatrans.CustomFields{"card": map[string]interface{}{"number": "4242424242424242"}},
+			})
+			var errResp datatrans.ErrorResponse
+			if !errors.As(err, &errResp) {
+				t.Fatalf("expected an ErrorResponse, got: %v", err)
+			}
+			if want := `"number":"` + tt.wantNumber + `"`; !strings.Contains(string(errResp.SentBody), want) {
+				t.Errorf("SentBody: %s missing in %s", want, errResp.SentBody)
+			}
+			if want := `"masked":"` + tt.wantMasked + `"`; !strings.Contains(auditResp, want) {
+				t.Errorf("audit: %s missing in %s", want, auditResp)
+			}
+		})
+	}
+
+	if _, err := datatrans.MakeClient(datatrans.OptionMaskedPANLevel("first6")); err == nil {
+		t.Error("expected an error for an unknown level")
+	}
+}
+
+func TestOptionRequestDump(t *testing.T) {
+	var gotOp, gotAuth, gotKey, gotExtra string
+	var gotBody []byte
+	c, err := datatrans.MakeClient(
+		datatrans.OptionRequestDump(func(op string, req *http.Request, body []byte) {
+			gotOp, gotBody = op, body
+			gotAuth = req.Header.Get("Authorization")
+			gotKey = req.Header.Get("Idempotency-Key")
+			gotExtra = req.Header.Get("X-Shop")
+		}),
+		datatrans.OptionHTTPRequestFn(func(req *http.Request) (*http.Response, error) {
+			if u, _, ok := req.BasicAuth(); !ok || u != "322342" {
+				t.Error("credentials of the sent request have been modified")
+			}
+			return &http.Response{
+				StatusCode: 200,
+				Body:       ioutil.NopCloser(strings.NewReader(`{"transactionId":"210215103042148501"}`)),
+			}, nil
+		}),
+		datatrans.OptionMerchant{
+			EnableIdempotency: true,
+			ExtraHeaders:      map[string]string{"X-Shop": "zurich"},
+			MerchantID:        "322342",
+			Password:          "sfdgsdfg",
+		},
+	)
+	must(t, err)
+
+	_, err = c.Authorize(context.Background(), datatrans.RequestAuthorize{
+		Amount:   1337,
+		Currency: "CHF",
+		RefNo:    "872732",
+	})
+	must(t, err)
+	if gotOp != "authorize" {
+		t.Errorf("invalid op: %q", gotOp)
+	}
+	if want := `{"amount":1337,"currency":"CHF","refno":"872732"}`; string(gotBody) != want {
+		t.Errorf("\nWant: %s\nHave: %s", want, gotBody)
+	}
+	if gotAuth != "REDACTED" {
+		t.Errorf("Authorization not redacted: %q", gotAuth)
+	}
+	if gotKey == "" || gotExtra != "zurich" {
+		t.Errorf("headers missing: %q %q", gotKey, gotExtra)
+	}
+}
@@ -0,0 +1,95 @@
+package datatrans
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Authenticator adds the credentials to a request towards datatrans. The
+// default is BasicAuth with OptionMerchant.MerchantID and Password.
+type Authenticator interface {
+	Authenticate(req *http.Request) error
+}
+
+// BasicAuth authenticates with HTTP basic authentication.
+type BasicAuth struct {
+	Username string
+	Password string
+}
+
+func (ba BasicAuth) Authenticate(req *http.Request) error {
+	req.SetBasicAuth(ba.Username, ba.Password)
+	return nil
+}
+
+// bearerRefreshMargin renews a token shortly before it expires to account for
+// the duration of the request.
+const bearerRefreshMargin = 30 * time.Second
+
+// BearerAuth authenticates with an OAuth bearer token. The token gets
+// fetched on the first request and renewed shortly before it expires,
+// measured with the clock of the client it is configured for. It is safe for
+// concurrent use, create it with NewBearerAuth.
+type BearerAuth struct {
+	fetch  func(ctx context.Context) (token string, expires time.Time, err error)
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+	clock  clock // nil uses the wall clock, set by MakeClient
+}
+
+// clockSetter gets implemented by authenticators which depend on the time so
+// that MakeClient can pass the clock of the client.
+type clockSetter interface {
+	setClock(clock)
+}
+
+func (ba *BearerAuth) setClock(c clock) {
+	ba.mu.Lock()
+	defer ba.mu.Unlock()
+	ba.clock = c
+}
+
+// NewBearerAuth returns a BearerAuth using fetch to retrieve a new token and
+// its expiry time, e.g. from an OAuth token endpoint. A zero expiry time
+// means the token does not expire.
+func NewBearerAuth(fetch func(ctx context.Context) (token string, expires time.Time, err error)) *BearerAuth {
+	return &BearerAuth{fetch: fetch}
+}
+
+func (ba *BearerAuth) Authenticate(req *http.Request) error {
+	token, err := ba.Token(req.Context())
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
+
+// Token returns the current token and fetches a new one if none is available
+// or the current one is about to expire.
+func (ba *BearerAuth) Token(ctx context.Context) (string, error) {
+	ba.mu.Lock()
+	defer ba.mu.Unlock()
+	var now time.Time
+	if ba.clock != nil {
+		now = ba.clock.Now()
+	} else {
+		now = time.Now()
+	}
+	if ba.token != "" && (ba.expiry.IsZero() || now.Add(bearerRefreshMargin).Before(ba.expiry)) {
+		return ba.token, nil
+	}
+	token, expiry, err := ba.fetch(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch bearer token: %w", err)
+	}
+	if token == "" {
+		return "", fmt.Errorf("failed to fetch bearer token: empty token")
+	}
+	ba.token, ba.expiry = token, expiry
+	return token, nil
+}
@@ -0,0 +1,76 @@
+package datatrans_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/globusdigital/datatrans"
+)
+
+func TestAuthenticator(t *testing.T) {
+	t.Run("basic", func(t *testing.T) {
+		c, err := datatrans.MakeClient(
+			datatrans.OptionHTTPRequestFn(mockResponse(t, 200, `{}`, func(t *testing.T, req *http.Request) {
+				if u, p, ok := req.BasicAuth(); !ok || u != "322342" || p != "sfdgsdfg" {
+					t.Errorf("invalid basic auth: %q %q", u, p)
+				}
+			})),
+			datatrans.OptionMerchant{
+				MerchantID: "322342",
+				Password:   "sfdgsdfg",
+			},
+		)
+		must(t, err)
+		_, err = c.Status(context.Background(), "210215103042148501")
+		must(t, err)
+	})
+
+	t.Run("bearer", func(t *testing.T) {
+		var fetched int
+		bearer := datatrans.NewBearerAuth(func(ctx context.Context) (string, time.Time, error) {
+			fetched++
+			return fmt.Sprintf("token-%d", fetched), time.Now().Add(time.Hour), nil
+		})
+		var header string
+		c, err := datatrans.MakeClient(
+			datatrans.OptionHTTPRequestFn(mockResponse(t, 200, `{}`, func(t *testing.T, req *http.Request) {
+				header = req.Header.Get("Authorization")
+			})),
+			datatrans.OptionMerchant{
+				ExtraHeaders:  map[string]string{"Authorization": "ignored"},
+				Authenticator: bearer,
+			},
+		)
+		must(t, err)
+
+		for i := 0; i < 2; i++ {
+			_, err = c.Status(context.Background(), "210215103042148501")
+			must(t, err)
+			if header != "Bearer token-1" {
+				t.Errorf("invalid Authorization header: %q", header)
+			}
+		}
+		if fetched != 1 {
+			t.Errorf("token fetched %d times", fetched)
+		}
+	})
+
+	t.Run("bearer refresh", func(t *testing.T) {
+		var fetched int
+		bearer := datatrans.NewBearerAuth(func(ctx context.Context) (string, time.Time, error) {
+			fetched++
+			// expires within the refresh margin
+			return fmt.Sprintf("token-%d", fetched), time.Now().Add(time.Second), nil
+		})
+		for i := 1; i <= 2; i++ {
+			token, err := bearer.Token(context.Background())
+			must(t, err)
+			if want := fmt.Sprintf("token-%d", i); token != want {
+				t.Errorf("want %q, have %q", want, token)
+			}
+		}
+	})
+}
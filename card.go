@@ -0,0 +1,53 @@
+package datatrans
+
+import "strings"
+
+// splitMasked splits a masked card number like 520000xxxxxx0080 into the
+// leading and trailing digits. Spaces and dashes get ignored, x, X and * are
+// accepted as placeholders. ok is false if the input contains other characters
+// or no placeholder at all.
+func splitMasked(masked string) (lead, trail string, ok bool) {
+	masked = strings.NewReplacer(" ", "", "-", "").Replace(masked)
+	start := strings.IndexAny(masked, "xX*")
+	if start < 0 {
+		return "", "", false
+	}
+	end := strings.LastIndexAny(masked, "xX*")
+	lead, trail = masked[:start], masked[end+1:]
+	if !isDigits(lead) || !isDigits(trail) || strings.Trim(masked[start:end+1], "xX*") != "" {
+		return "", "", false
+	}
+	return lead, trail, true
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// MaskedLast4 returns the last four digits of a masked card number, e.g.
+// 0080 for 520000xxxxxx0080. Returns an empty string if the input cannot be
+// parsed or contains fewer than four trailing digits.
+func MaskedLast4(masked string) string {
+	_, trail, ok := splitMasked(masked)
+	if !ok || len(trail) < 4 {
+		return ""
+	}
+	return trail[len(trail)-4:]
+}
+
+// MaskedBIN returns the leading digits (bank identification number) of a
+// masked card number, e.g. 520000 for 520000xxxxxx0080. Returns an empty
+// string if the input cannot be parsed or contains fewer than six leading
+// digits.
+func MaskedBIN(masked string) string {
+	lead, _, ok := splitMasked(masked)
+	if !ok || len(lead) < 6 {
+		return ""
+	}
+	return lead
+}
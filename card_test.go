@@ -0,0 +1,38 @@
+package datatrans_test
+
+import (
+	"testing"
+
+	"github.com/globusdigital/datatrans"
+)
+
+func TestMaskedBINLast4(t *testing.T) {
+	tests := []struct {
+		masked    string
+		wantBIN   string
+		wantLast4 string
+	}{
+		{"520000xxxxxx0080", "520000", "0080"},
+		{"424242XXXXXX4242", "424242", "4242"},
+		{"42424242xxxx4242", "42424242", "4242"},
+		{"375811xxxxx1005", "375811", "1005"},
+		{"5200 00xx xxxx 0080", "520000", "0080"},
+		{"520000******0080", "520000", "0080"},
+		{"xxxxxxxxxxxx0080", "", "0080"},
+		{"520000xxxxxxxxxx", "520000", ""},
+		{"5200xxxxxxxx080", "", ""},
+		{"5200000000000080", "", ""},
+		{"52000axxxxxx0080", "", ""},
+		{"520000xxx1xx0080", "", ""},
+		{"", "", ""},
+		{"x", "", ""},
+	}
+	for _, tt := range tests {
+		if have := datatrans.MaskedBIN(tt.masked); have != tt.wantBIN {
+			t.Errorf("MaskedBIN(%q): want %q, have %q", tt.masked, tt.wantBIN, have)
+		}
+		if have := datatrans.MaskedLast4(tt.masked); have != tt.wantLast4 {
+			t.Errorf("MaskedLast4(%q): want %q, have %q", tt.masked, tt.wantLast4, have)
+		}
+	}
+}
@@ -2,16 +2,20 @@ package datatrans
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
 	"crypto/tls"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"hash/fnv"
 	"io"
 	"io/ioutil"
+	"math"
 	"net/http"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -38,15 +42,46 @@ const (
 	pathReconciliationsSalesBulk = "/v1/reconciliations/sales/bulk"
 )
 
+// Environment selects the datatrans API endpoint a merchant talks to.
+type Environment uint8
+
+const (
+	// EnvironmentUnset falls back to EnableProduction, rejected by
+	// OptionStrictEnvironment.
+	EnvironmentUnset Environment = iota
+	EnvironmentSandbox
+	EnvironmentProduction
+)
+
+func (e Environment) String() string {
+	switch e {
+	case EnvironmentSandbox:
+		return "sandbox"
+	case EnvironmentProduction:
+		return "production"
+	}
+	return "unset"
+}
+
+func (e Environment) endpointURL() string {
+	if e == EnvironmentProduction {
+		return endpointURLProduction
+	}
+	return endpointURLSandBox
+}
+
 type OptionMerchant struct {
-	InternalID       string
+	InternalID  string
+	Environment Environment
+	// Deprecated: use Environment. Only considered when Environment is unset.
 	EnableProduction bool
 	// https://docs.datatrans.ch/docs/api-endpoints#section-idempotency
 	// If your request failed to reach our servers, no idempotent result is saved
 	// because no API endpoint processed your request. In such cases, you can
 	// simply retry your operation safely. Idempotency keys remain stored for 3
 	// minutes. After 3 minutes have passed, sending the same request together
-	// with the previous idempotency key will create a new operation.
+	// with the previous idempotency key will create a new operation. Such a
+	// retry of OptionRetry gets rejected locally with ErrIdempotencyExpired.
 	EnableIdempotency  bool
 	DisableRawJSONBody bool
 	MerchantID         string // basic auth user
@@ -54,9 +89,68 @@ type OptionMerchant struct {
 	// Data contains merchant specific other IDs or configurations. Keys/Values
 	// from this map are not getting used in requests towards datatrans.
 	Data map[string]interface{}
+	// ExtraHeaders get added to every request of this merchant, e.g. a key
+	// required by an API gateway. The headers Authorization, Content-Type and
+	// Idempotency-Key cannot be overwritten and get ignored.
+	ExtraHeaders map[string]string
+	// DefaultRefNo2 gets used as refno2 for all requests which support it
+	// and have an empty RefNo2, e.g. a store or branch code.
+	DefaultRefNo2 string
+	// AmountBounds optionally rejects requests whose amount lies outside of
+	// the bounds before they get sent to datatrans.
+	AmountBounds *OptionAmountBounds
+	// Authenticator overrides the basic authentication with MerchantID and
+	// Password, e.g. with a BearerAuth.
+	Authenticator Authenticator
+	// PaymentMethods lists the payment methods enabled for the merchant in
+	// the datatrans web administration tool, e.g. for building a checkout UI.
+	// Datatrans does not provide an API endpoint for them. Every entry must
+	// pass PaymentMethod.Valid.
+	PaymentMethods []PaymentMethod
+}
+
+// OptionAmountBounds is a safety net against amounts accidentally sent in major
+// units instead of minor units (or the reverse). It is not meant to implement
+// business rules. Min and Max are inclusive and in minor units, a Max of zero
+// disables the upper bound. Requests without an amount are not checked. Bulk
+// sales get checked one by one.
+type OptionAmountBounds struct {
+	Min int
+	Max int
+}
+
+func (ab *OptionAmountBounds) check(amount int) error {
+	if ab == nil || amount == 0 {
+		return nil
+	}
+	if amount < ab.Min || (ab.Max > 0 && amount > ab.Max) {
+		return fmt.Errorf("amount %d outside of bounds [%d,%d]", amount, ab.Min, ab.Max)
+	}
+	return nil
+}
+
+// checkSales checks the amount of every sale of a bulk request.
+func (ab *OptionAmountBounds) checkSales(sales []RequestReconciliationsSale) error {
+	for i, s := range sales {
+		if err := ab.check(s.Amount); err != nil {
+			return fmt.Errorf("sales[%d]: %w", i, err)
+		}
+	}
+	return nil
 }
 
 func (m OptionMerchant) apply(c *Client) error {
+	if m.Environment == EnvironmentSandbox && m.EnableProduction {
+		return fmt.Errorf("InternalID %q: Environment sandbox conflicts with EnableProduction", m.InternalID)
+	}
+	if ab := m.AmountBounds; ab != nil && ab.Max > 0 && ab.Min > ab.Max {
+		return fmt.Errorf("InternalID %q: AmountBounds Min %d exceeds Max %d", m.InternalID, ab.Min, ab.Max)
+	}
+	for _, pm := range m.PaymentMethods {
+		if !pm.Valid() {
+			return fmt.Errorf("InternalID %q: invalid payment method %q", m.InternalID, pm)
+		}
+	}
 	if _, ok := c.merchants[m.InternalID]; ok {
 		return fmt.Errorf("InternalID %q already exists", m.InternalID)
 	}
@@ -67,6 +161,274 @@ func (m OptionMerchant) apply(c *Client) error {
 	return nil
 }
 
+func (m OptionMerchant) environment() Environment {
+	if m.Environment != EnvironmentUnset {
+		return m.Environment
+	}
+	if m.EnableProduction {
+		return EnvironmentProduction
+	}
+	return EnvironmentSandbox
+}
+
+// OptionStrictEnvironment requires every merchant to set its Environment
+// explicitly, so that nobody accidentally ends up in sandbox or production.
+type OptionStrictEnvironment bool
+
+func (o OptionStrictEnvironment) apply(c *Client) error {
+	c.strictEnvironment = bool(o)
+	return nil
+}
+
+// OptionCorrelationIDHeader sets the name of the HTTP header which transports
+// the correlation ID set via WithCorrelationID. Default: X-Correlation-Id
+type OptionCorrelationIDHeader string
+
+func (o OptionCorrelationIDHeader) apply(c *Client) error {
+	if o == "" {
+		return fmt.Errorf("OptionCorrelationIDHeader cannot be empty")
+	}
+	c.correlationIDHeader = string(o)
+	return nil
+}
+
+type ctxKeyCorrelationID struct{}
+
+// WithCorrelationID returns a new context which carries the correlation ID.
+// Each request executed with this context sends the ID as HTTP header, see
+// OptionCorrelationIDHeader.
+func WithCorrelationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, ctxKeyCorrelationID{}, id)
+}
+
+// OptionTransport tunes the connection pool of the default HTTP client, the
+// minimum TLS version 1.2 and the timeout of 30s are kept. It has no effect
+// in combination with OptionHTTPRequestFn, use that one to provide a fully
+// custom http.Client or http.Transport. For high throughput merchants
+// MaxIdleConnsPerHost between 20 and 100, an IdleConnTimeout of 90s and
+// ForceAttemptHTTP2 are recommended.
+type OptionTransport struct {
+	MaxIdleConnsPerHost int
+	IdleConnTimeout     time.Duration
+	ForceAttemptHTTP2   bool
+}
+
+func (o OptionTransport) apply(c *Client) error {
+	c.transport = o
+	return nil
+}
+
+func newHTTPClient(o OptionTransport) *http.Client {
+	return &http.Client{
+		Timeout: 30 * time.Second,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				MinVersion: tls.VersionTLS12,
+			},
+			MaxIdleConnsPerHost: o.MaxIdleConnsPerHost,
+			IdleConnTimeout:     o.IdleConnTimeout,
+			ForceAttemptHTTP2:   o.ForceAttemptHTTP2,
+		},
+	}
+}
+
+// OptionOnClose registers a function which gets called by Client.Close, e.g.
+// to flush metrics or traces. The functions only get called if the client owns
+// the default HTTP client, with OptionHTTPRequestFn the caller is responsible
+// for the shutdown of its resources.
+type OptionOnClose func() error
+
+func (o OptionOnClose) apply(c *Client) error {
+	c.closeHooks = append(c.closeHooks, o)
+	return nil
+}
+
+// OptionSuccessStatus defines which HTTP status codes are treated as success,
+// default is the 2xx range. Use with care: a response considered as success
+// gets decoded into the response type, a wrongly accepted error response
+// results in an empty response without an error. Note that the default
+// http.Client follows redirects itself, a 3xx status only arrives here when
+// redirects are disabled.
+type OptionSuccessStatus func(statusCode int) bool
+
+func (o OptionSuccessStatus) apply(c *Client) error {
+	c.successFn = o
+	return nil
+}
+
+// OptionAuditSink gets called after every request towards datatrans with the
+// name of the operation, e.g. "settle", the request and response bodies and
+// the HTTP status code, also on error paths. A status of 0 and an empty
+// response body indicate that no response has been received. Both bodies get
+// redacted like ErrorResponse.SentBody: card numbers are masked according to
+// OptionMaskedPANLevel, aliases to the last four characters and wallet
+// payment tokens removed. Streamed
+// request bodies, see ReconciliationsSalesBulkStream, are not reported.
+// Enabling the sink forces the response body to be buffered even if
+// OptionMerchant.DisableRawJSONBody is set. The sink must not retain the
+// bodies after returning.
+type OptionAuditSink func(ctx context.Context, op string, reqBody, respBody []byte, status int)
+
+func (o OptionAuditSink) apply(c *Client) error {
+	c.auditSink = o
+	return nil
+}
+
+// OptionStepUpCodes sets the error codes which trigger the retry with 3-D
+// Secure data in AuthorizeWithStepUp. Default: ErrCodeSoftDeclined.
+type OptionStepUpCodes []string
+
+func (o OptionStepUpCodes) apply(c *Client) error {
+	if len(o) == 0 {
+		return fmt.Errorf("OptionStepUpCodes cannot be empty")
+	}
+	c.stepUpCodes = append(OptionStepUpCodes(nil), o...)
+	return nil
+}
+
+// OptionRequestDump receives each request right before it gets sent,
+// including all headers and the exact body bytes, e.g. for debugging. The
+// Authorization header is replaced with REDACTED. Unlike OptionAuditSink, card
+// numbers in the body are NOT masked, do not enable it in production. Retries
+// are not dumped again. Streamed request bodies, see
+// ReconciliationsSalesBulkStream, are reported as nil.
+type OptionRequestDump func(op string, req *http.Request, body []byte)
+
+func (o OptionRequestDump) apply(c *Client) error {
+	c.requestDump = o
+	return nil
+}
+
+// OptionStrictDecode rejects success responses containing fields which are not
+// part of the response type, e.g. to detect API changes early in test or
+// staging environments. Do not enable it in production, additive changes of
+// datatrans would break all requests. Error responses are decoded leniently.
+type OptionStrictDecode bool
+
+func (o OptionStrictDecode) apply(c *Client) error {
+	c.strictDecode = bool(o)
+	return nil
+}
+
+// OptionStatusCache enables a LRU cache for Status with the given maximum
+// number of entries. Only statuses of finished transactions get cached:
+// settled, transmitted, canceled and failed. Note that a settled transaction
+// still becomes transmitted at the end of the day, the cache keeps returning
+// settled. Cancel and Credit through this client remove the transaction from
+// the cache. The cache is shared between clones created with WithMerchant.
+type OptionStatusCache int
+
+func (o OptionStatusCache) apply(c *Client) error {
+	if o <= 0 {
+		return fmt.Errorf("OptionStatusCache must be greater than zero, got %d", o)
+	}
+	c.statusCache = newStatusCache(int(o))
+	return nil
+}
+
+// OptionStrictValidation enables additional cross field checks before sending
+// a request. Currently checked rules for Initialize and, where applicable,
+// Authorize:
+//   - option.authenticationOnly cannot be combined with autoSettle
+//   - option.rememberMe must be "true" or "checked"
+//   - option.rememberMe requires option.createAlias
+//   - customer gets normalized and must pass Customer.Validate
+//   - the phones of card.3D.cardholder get normalized
+//   - card.3D.cardholder, cardholderAccount.acctInfo,
+//     purchase.merchantRiskIndicator, acquirer and merchant must pass their
+//     Validate
+//   - the totals of the items must add up to the amount
+//
+// For Settle with a ShipmentRef the status gets fetched upfront to check that
+// all settlements together do not exceed the authorized amount. The
+// reconciliation sales must pass their Validate, e.g. to list all sales without
+// transactionId before datatrans rejects the bulk.
+type OptionStrictValidation bool
+
+func (o OptionStrictValidation) apply(c *Client) error {
+	c.strictValidation = bool(o)
+	return nil
+}
+
+// OptionSecureFieldsUpdateCheck fetches the status before SecureFieldsUpdate
+// and rejects the update with ErrSecureFieldsUpdateNotAllowed if the
+// transaction is not initialized anymore. It costs an additional request.
+type OptionSecureFieldsUpdateCheck bool
+
+func (o OptionSecureFieldsUpdateCheck) apply(c *Client) error {
+	c.secureFieldsUpdateCheck = bool(o)
+	return nil
+}
+
+// OptionOperationTimeouts sets a default timeout per operation, keyed by the
+// operation name as passed to OptionAuditSink, e.g. "status" or
+// "reconciliationsSalesBulk". The timeout only applies if the context passed
+// by the caller has no deadline, a caller deadline always wins. It spans all
+// attempts of OptionRetry. The default HTTP client raises its overall timeout
+// of 30s to the longest configured operation timeout; a custom client of
+// OptionHTTPRequestFn must allow it itself.
+type OptionOperationTimeouts map[string]time.Duration
+
+func (o OptionOperationTimeouts) apply(c *Client) error {
+	c.operationTimeouts = make(map[string]time.Duration, len(o))
+	for op, d := range o {
+		if d <= 0 {
+			return fmt.Errorf("OptionOperationTimeouts: timeout of %q must be positive", op)
+		}
+		c.operationTimeouts[op] = d
+	}
+	return nil
+}
+
+// OptionAcceptLanguage sends the Accept-Language header with the language of
+// the request, currently RequestInitialize.Language, so that error pages and
+// messages get localized. A set language must pass ValidLanguage, otherwise
+// the request fails before it gets sent. An Accept-Language of
+// OptionMerchant.ExtraHeaders takes precedence.
+type OptionAcceptLanguage bool
+
+func (o OptionAcceptLanguage) apply(c *Client) error {
+	c.acceptLanguage = bool(o)
+	return nil
+}
+
+// RoundTripFunc sends a single HTTP request, see OptionInterceptor.
+type RoundTripFunc func(req *http.Request) (*http.Response, error)
+
+// OptionInterceptor wraps the function which sends the HTTP requests, either
+// the default HTTP client or OptionHTTPRequestFn, e.g. for logging, metrics or
+// tracing. Several interceptors form a chain, the first one applied is the
+// outermost. Every attempt of OptionRetry passes the chain, the requests are
+// already authenticated and carry all headers. An interceptor must call next
+// or return a response or error on its own.
+type OptionInterceptor func(next RoundTripFunc) RoundTripFunc
+
+func (o OptionInterceptor) apply(c *Client) error {
+	if o == nil {
+		return fmt.Errorf("OptionInterceptor cannot be nil")
+	}
+	c.interceptors = append(c.interceptors, o)
+	return nil
+}
+
+// OptionMaskedPANLevel sets how card numbers get masked in
+// ErrorResponse.SentBody and in the bodies passed to OptionAuditSink, one of
+// MaskNone, MaskLast4 or MaskFull. It applies to the values which datatrans
+// already returns masked, like card.masked, and to the card numbers masked by
+// the client. MaskNone keeps the first six and last four digits. Default is
+// MaskLast4. Use CardExtended.RedactLevel to apply a level to log values.
+type OptionMaskedPANLevel string
+
+func (o OptionMaskedPANLevel) apply(c *Client) error {
+	switch o {
+	case MaskNone, MaskLast4, MaskFull:
+	default:
+		return fmt.Errorf("unknown masking level %q", o)
+	}
+	c.maskedPANLevel = string(o)
+	return nil
+}
+
 type OptionHTTPRequestFn func(req *http.Request) (*http.Response, error)
 
 func (fn OptionHTTPRequestFn) apply(c *Client) error {
@@ -75,10 +437,32 @@ func (fn OptionHTTPRequestFn) apply(c *Client) error {
 }
 
 type Client struct {
-	doFn              OptionHTTPRequestFn
-	merchants         map[string]OptionMerchant // string = your custom merchant ID
-	currentInternalID string
-	internalIDFound   bool
+	doFn                    OptionHTTPRequestFn
+	mu                      *sync.RWMutex             // protects merchants, shared between clones
+	merchants               map[string]OptionMerchant // string = your custom merchant ID
+	currentInternalID       string
+	internalIDFound         bool
+	strictEnvironment       bool
+	correlationIDHeader     string
+	transport               OptionTransport
+	httpClient              *http.Client // only set if the client owns the default HTTP client
+	closeHooks              []func() error
+	closeOnce               *sync.Once
+	successFn               OptionSuccessStatus
+	strictValidation        bool
+	idempotencyKeys         *idempotencyKeys // shared between clones
+	clock                   clock
+	auditSink               OptionAuditSink
+	maskedPANLevel          string
+	strictDecode            bool
+	statusCache             *statusCache // nil if disabled
+	retry                   *OptionRetry // nil if disabled
+	secureFieldsUpdateCheck bool
+	requestDump             OptionRequestDump
+	stepUpCodes             OptionStepUpCodes // nil uses ErrCodeSoftDeclined
+	operationTimeouts       map[string]time.Duration
+	acceptLanguage          bool
+	interceptors            []OptionInterceptor
 }
 
 type Option interface {
@@ -87,7 +471,13 @@ type Option interface {
 
 func MakeClient(opts ...Option) (Client, error) {
 	c := Client{
-		merchants: make(map[string]OptionMerchant, 3),
+		mu:                  &sync.RWMutex{},
+		merchants:           make(map[string]OptionMerchant, 3),
+		correlationIDHeader: "X-Correlation-Id",
+		closeOnce:           &sync.Once{},
+		idempotencyKeys:     &idempotencyKeys{},
+		clock:               realClock{},
+		maskedPANLevel:      MaskLast4,
 	}
 	for _, opt := range opts {
 		if err := opt.apply(&c); err != nil {
@@ -97,75 +487,280 @@ func MakeClient(opts ...Option) (Client, error) {
 	if len(c.merchants) == 0 {
 		return Client{}, fmt.Errorf("no merchants applied")
 	}
+	if c.strictEnvironment {
+		for _, m := range c.merchants {
+			if m.Environment == EnvironmentUnset {
+				return Client{}, fmt.Errorf("InternalID %q: Environment must be set explicitly", m.InternalID)
+			}
+		}
+	}
+	for _, m := range c.merchants {
+		if cs, ok := m.Authenticator.(clockSetter); ok {
+			cs.setClock(c.clock)
+		}
+	}
 	if c.doFn == nil {
-		c.doFn = (&http.Client{
-			Timeout: 30 * time.Second,
-			Transport: &http.Transport{
-				TLSClientConfig: &tls.Config{
-					MinVersion: tls.VersionTLS12,
-				},
-			},
-		}).Do
+		c.httpClient = newHTTPClient(c.transport)
+		for _, d := range c.operationTimeouts {
+			if d > c.httpClient.Timeout {
+				c.httpClient.Timeout = d
+			}
+		}
+		c.doFn = c.httpClient.Do
+	}
+	if len(c.interceptors) > 0 {
+		rt := RoundTripFunc(c.doFn)
+		for i := len(c.interceptors) - 1; i >= 0; i-- {
+			if rt = c.interceptors[i](rt); rt == nil {
+				return Client{}, fmt.Errorf("OptionInterceptor %d returned a nil RoundTripFunc", i)
+			}
+		}
+		c.doFn = OptionHTTPRequestFn(rt)
 	}
 	// see if we have a default one, otherwise you always have to call WithMerchant.
 	_, c.internalIDFound = c.merchants[""]
 	return c, nil
 }
 
+// Close closes the idle connections of the default HTTP client and calls the
+// functions registered with OptionOnClose. With a custom HTTP client provided
+// with OptionHTTPRequestFn, Close is a no-op because the client does not own
+// any of the resources. Close affects all clones created with WithMerchant and
+// only has an effect on the first call.
+func (c *Client) Close() error {
+	if c.httpClient == nil {
+		return nil
+	}
+	var firstErr error
+	c.closeOnce.Do(func() {
+		c.httpClient.CloseIdleConnections()
+		for _, fn := range c.closeHooks {
+			if err := fn(); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+	})
+	return firstErr
+}
+
 // WithMerchant sets an ID and returns a shallow clone of the client.
 func (c *Client) WithMerchant(internalID string) *Client {
 	c2 := *c
 	c2.currentInternalID = internalID
-	_, c2.internalIDFound = c2.merchants[internalID]
+	_, c2.internalIDFound = c2.merchant(internalID)
 	return &c2
 }
 
+// Environment returns the resolved environment of a merchant or
+// EnvironmentUnset if the internalID is unknown.
+func (c *Client) Environment(internalID string) Environment {
+	m, ok := c.merchant(internalID)
+	if !ok {
+		return EnvironmentUnset
+	}
+	return m.environment()
+}
+
+// IsProduction reports whether a merchant talks to the production endpoint,
+// e.g. for logging and incident triage. Neither the transaction IDs nor the
+// responses of datatrans contain a marker for the environment, only the
+// configuration of the client tells them apart.
+func (c *Client) IsProduction(internalID string) bool {
+	return c.Environment(internalID) == EnvironmentProduction
+}
+
+// PaymentMethods returns a copy of the configured payment methods of a
+// merchant or nil if the internalID is unknown.
+func (c *Client) PaymentMethods(internalID string) []PaymentMethod {
+	m, ok := c.merchant(internalID)
+	if !ok || m.PaymentMethods == nil {
+		return nil
+	}
+	return append([]PaymentMethod(nil), m.PaymentMethods...)
+}
+
+// merchant returns a consistent snapshot of the merchant configuration.
+func (c *Client) merchant(internalID string) (OptionMerchant, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	m, ok := c.merchants[internalID]
+	return m, ok
+}
+
+// UpdateCredentials atomically replaces the MerchantID and Password of an
+// already configured merchant, all other fields stay untouched. Requests in
+// flight use either the old or the new credentials, never a mix of both.
+func (c *Client) UpdateCredentials(internalID, merchantID, password string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	m, ok := c.merchants[internalID]
+	if !ok || m.InternalID != internalID {
+		return fmt.Errorf("InternalID %q not found in list of merchants", internalID)
+	}
+	// the merchant might also be registered under its MerchantID, see apply.
+	if alias, ok := c.merchants[m.MerchantID]; ok && alias.InternalID == internalID {
+		delete(c.merchants, m.MerchantID)
+	}
+	m.MerchantID = merchantID
+	m.Password = password
+	c.merchants[internalID] = m
+	if _, ok := c.merchants[m.MerchantID]; !ok {
+		c.merchants[m.MerchantID] = m
+	}
+	return nil
+}
+
 func (c *Client) do(req *http.Request, v interface{}) error {
 	internalID := c.currentInternalID
-	if !c.internalIDFound {
+	m, ok := c.merchant(internalID)
+	if !c.internalIDFound || !ok {
 		return fmt.Errorf("ClientID %q not found in list of merchants", internalID)
 	}
+	op := operationName(req.Method, req.URL.Path)
+	if d, ok := c.operationTimeouts[op]; ok {
+		if _, ok := req.Context().Deadline(); !ok {
+			ctx, cancel := context.WithTimeout(req.Context(), d)
+			defer cancel()
+			req = req.WithContext(ctx)
+		}
+	}
 
-	req.SetBasicAuth(c.merchants[internalID].MerchantID, c.merchants[internalID].Password)
-	resp, err := c.doFn(req)
+	for k, v := range m.ExtraHeaders {
+		switch http.CanonicalHeaderKey(k) {
+		case "Authorization", "Content-Type", "Idempotency-Key":
+			continue
+		}
+		req.Header.Set(k, v)
+	}
+	auth := m.Authenticator
+	if auth == nil {
+		auth = BasicAuth{Username: m.MerchantID, Password: m.Password}
+	}
+	if err := auth.Authenticate(req); err != nil {
+		return fmt.Errorf("ClientID:%q: failed to authenticate HTTP request: %w", internalID, err)
+	}
+	var reqBody []byte
+	if c.auditSink != nil || c.requestDump != nil {
+		reqBody = requestBody(req)
+	}
+	if c.requestDump != nil {
+		dump := req.Clone(req.Context())
+		if dump.Header.Get("Authorization") != "" {
+			dump.Header.Set("Authorization", "REDACTED")
+		}
+		c.requestDump(op, dump, reqBody)
+	}
+	resp, err := c.send(req)
 	defer closeResponse(resp)
+	var buf bytes.Buffer
+	if c.auditSink != nil {
+		defer c.audit(req, reqBody, resp, &buf)
+	}
 	if err != nil {
 		return fmt.Errorf("ClientID:%q: failed to execute HTTP request: %w", internalID, err)
 	}
+	if err := decompressResponse(resp); err != nil {
+		return fmt.Errorf("ClientID:%q: failed to decompress HTTP response with status %d: %w", internalID, resp.StatusCode, err)
+	}
 
-	var buf bytes.Buffer
 	body := io.TeeReader(resp.Body, &buf)
 	dec := json.NewDecoder(body)
 
 	if !c.isSuccess(resp.StatusCode) {
 		var errResp ErrorResponse
 		if err := dec.Decode(&errResp); err != nil {
-			return fmt.Errorf("ClientID:%q: failed to unmarshal HTTP error response: %w", internalID, err)
+			if isUnauthorized(resp.StatusCode) {
+				// the body of a rejected authentication is not guaranteed to
+				// contain an error object.
+				return fmt.Errorf("ClientID:%q: HTTP status %d: %w", internalID, resp.StatusCode, ErrUnauthorized)
+			}
+			return fmt.Errorf("ClientID:%q: failed to unmarshal HTTP error response with status %d, body %q: %w", internalID, resp.StatusCode, bodySnippet(buf.Bytes()), err)
 		}
 		errResp.HTTPStatusCode = resp.StatusCode
+		errResp.SentBody = redactBody(requestBody(req), c.maskedPANLevel)
+		errResp.IdempotencyKey = req.Header.Get("Idempotency-Key")
 		return errResp
 	}
 	if v != nil {
-		if err := dec.Decode(v); err != nil {
-			return fmt.Errorf("ClientID:%q: failed to unmarshal HTTP error response: %w", internalID, err)
+		if c.strictDecode {
+			dec.DisallowUnknownFields()
+		}
+		// an empty body, e.g. with 204 No Content, is a valid success response.
+		if err := dec.Decode(v); err != nil && err != io.EOF {
+			return fmt.Errorf("ClientID:%q: failed to unmarshal HTTP success response body %q: %w", internalID, bodySnippet(buf.Bytes()), err)
 		}
 	}
-	if ri, ok := v.(*ResponseInitialize); ok {
+	if ls, ok := v.(locationSetter); ok {
 		if loc := resp.Header.Get("Location"); loc != "" {
-			ri.Location = loc
+			ls.setLocation(loc)
 		}
 	}
-	if set, ok := v.(rawJSONBodySetter); !c.merchants[internalID].DisableRawJSONBody && ok {
+	if set, ok := v.(rawJSONBodySetter); !m.DisableRawJSONBody && ok {
 		set.setJSONRawBody(buf.Bytes())
 	}
 
 	return nil
 }
 
+// bodySnippet returns the beginning of a response body for error messages.
+// Digits get replaced to avoid leaking card numbers or similar data.
+func bodySnippet(body []byte) string {
+	const maxLen = 64
+	if len(body) > maxLen {
+		body = body[:maxLen]
+	}
+	snippet := make([]byte, len(body))
+	for i, b := range body {
+		if b >= '0' && b <= '9' {
+			b = 'x'
+		}
+		snippet[i] = b
+	}
+	return string(snippet)
+}
+
 func (c *Client) isSuccess(statusCode int) bool {
+	if c.successFn != nil {
+		return c.successFn(statusCode)
+	}
 	return statusCode >= http.StatusOK && statusCode < http.StatusMultipleChoices
 }
 
+// gzipBody closes the gzip reader and the underlying response body.
+type gzipBody struct {
+	*gzip.Reader
+	body io.ReadCloser
+}
+
+func (gb gzipBody) Close() error {
+	_ = gb.Reader.Close()
+	return gb.body.Close()
+}
+
+// decompressResponse replaces the body of a gzip encoded response with the
+// decompressed stream. The transport of net/http only decompresses on its own
+// if it requested gzip itself, not if Accept-Encoding has been set explicitly
+// or a proxy compresses anyway. An empty body stays empty.
+func decompressResponse(r *http.Response) error {
+	if r.Body == nil || !strings.EqualFold(strings.TrimSpace(r.Header.Get("Content-Encoding")), "gzip") {
+		return nil
+	}
+	zr, err := gzip.NewReader(r.Body)
+	switch {
+	case err == io.EOF:
+		return nil
+	case err != nil:
+		return err
+	}
+	r.Body = gzipBody{Reader: zr, body: r.Body}
+	r.Header.Del("Content-Encoding")
+	r.Header.Del("Content-Length")
+	r.ContentLength = -1
+	r.Uncompressed = true
+	return nil
+}
+
 func closeResponse(r *http.Response) {
 	if r == nil || r.Body == nil {
 		return
@@ -190,12 +785,15 @@ func MarshalJSON(postData interface{}) ([]byte, error) {
 			return jsonBytes, nil
 		}
 
+		// UseNumber keeps large integers of the struct exact.
 		postDataMap := map[string]interface{}{}
-		if err := json.Unmarshal(jsonBytes, &postDataMap); err != nil {
+		dec := json.NewDecoder(bytes.NewReader(jsonBytes))
+		dec.UseNumber()
+		if err := dec.Decode(&postDataMap); err != nil {
 			return nil, fmt.Errorf("failed to Unmarshal postData raw bytes: %w", err)
 		}
 		for k, v := range custFields {
-			postDataMap[k] = v // overwrites existing data from postData struct
+			postDataMap[k] = normalizeNumber(v) // overwrites existing data from postData struct
 		}
 		jsonBytes, err = json.Marshal(postDataMap)
 		if err != nil {
@@ -206,43 +804,128 @@ func MarshalJSON(postData interface{}) ([]byte, error) {
 	return jsonBytes, nil
 }
 
+// normalizeNumber formats whole float64 numbers and json.Number values with an
+// exponent, e.g. from decoded JSON, without exponent. Nested maps and slices
+// get copied with their values normalized, the originals are not modified.
+// Use CustomFields.SetInt or json.Number to avoid floats at all.
+func normalizeNumber(v interface{}) interface{} {
+	switch t := v.(type) {
+	case float64:
+		if t == math.Trunc(t) && !math.IsInf(t, 0) {
+			return json.Number(strconv.FormatFloat(t, 'f', -1, 64))
+		}
+	case json.Number:
+		if strings.ContainsAny(string(t), "eE") {
+			if f, err := t.Float64(); err == nil {
+				return normalizeNumber(f)
+			}
+		}
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, e := range t {
+			m[k] = normalizeNumber(e)
+		}
+		return m
+	case []interface{}:
+		l := make([]interface{}, len(t))
+		for i, e := range t {
+			l[i] = normalizeNumber(e)
+		}
+		return l
+	}
+	return v
+}
+
 func (c *Client) prepareJSONReq(ctx context.Context, method, path string, postData interface{}) (*http.Request, error) {
-	internalID := c.currentInternalID
+	postData, lang, err := c.prepareBody(postData)
+	if err != nil {
+		return nil, err
+	}
 
 	var r io.Reader
 	var jsonBytes []byte
 	if postData != nil {
-		var err error
 		jsonBytes, err = MarshalJSON(postData)
 		if err != nil {
-			return nil, fmt.Errorf("ClientID:%q: failed to json marshal HTTP request: %w", internalID, err)
+			return nil, fmt.Errorf("ClientID:%q: failed to json marshal HTTP request: %w", c.currentInternalID, err)
 		}
 		r = bytes.NewReader(jsonBytes)
 	}
-	host := endpointURLSandBox
-	if c.merchants[internalID].EnableProduction {
-		host = endpointURLProduction
+	return c.newJSONReq(ctx, method, path, r, lang, func(w io.Writer) error {
+		_, err := w.Write(jsonBytes)
+		return err
+	})
+}
+
+// prepareBody applies the merchant defaults to postData and checks it against
+// the merchant options. It returns the accepted language of postData, if
+// enabled.
+func (c *Client) prepareBody(postData interface{}) (interface{}, string, error) {
+	internalID := c.currentInternalID
+	m, _ := c.merchant(internalID)
+
+	if rd, ok := postData.(refNo2Defaulter); ok && m.DefaultRefNo2 != "" {
+		postData = rd.withDefaultRefNo2(m.DefaultRefNo2)
+	}
+	if ag, ok := postData.(amountGetter); ok {
+		if err := m.AmountBounds.check(ag.getAmount()); err != nil {
+			return nil, "", fmt.Errorf("ClientID:%q: %w", internalID, err)
+		}
+	}
+	if rs, ok := postData.(RequestReconciliationsSales); ok {
+		if err := m.AmountBounds.checkSales(rs.Sales); err != nil {
+			return nil, "", fmt.Errorf("ClientID:%q: %w", internalID, err)
+		}
+	}
+	var lang string
+	if lg, ok := postData.(languageGetter); ok && c.acceptLanguage {
+		lang = lg.getLanguage()
+		if lang != "" && !ValidLanguage(lang) {
+			return nil, "", fmt.Errorf("ClientID:%q: unsupported language %q", internalID, lang)
+		}
 	}
+	return postData, lang, nil
+}
+
+// newJSONReq creates the request with the JSON body r and sets the headers
+// shared by all requests. writeBody writes the same body again to derive the
+// idempotency key, it allows streamed bodies to get a key without buffering.
+func (c *Client) newJSONReq(ctx context.Context, method, path string, r io.Reader, lang string, writeBody func(io.Writer) error) (*http.Request, error) {
+	internalID := c.currentInternalID
+	m, _ := c.merchant(internalID)
+	host := m.environment().endpointURL()
 
 	req, err := http.NewRequestWithContext(ctx, method, host+path, r)
 	if err != nil {
 		return nil, fmt.Errorf("ClientID:%q: failed to create HTTP request: %w", internalID, err)
 	}
-	if postData != nil {
+	if r != nil {
 		req.Header.Set("Content-Type", "application/json")
 	}
-	if method == http.MethodPost && c.merchants[internalID].EnableIdempotency {
-		// not quite happy with this
+	if lang != "" {
+		req.Header.Set("Accept-Language", lang)
+	}
+	c.setCorrelationID(req)
+	if method == http.MethodPost && m.EnableIdempotency {
 		// https://docs.datatrans.ch/docs/api-endpoints#section-idempotency
-		fh := fnv.New64a()
-		_, _ = fh.Write([]byte(internalID + host + path))
-		_, _ = fh.Write(jsonBytes)
-		req.Header.Set("Idempotency-Key", hex.EncodeToString(fh.Sum(nil)))
+		fh := idempotencyHash(internalID, host, path)
+		if err := writeBody(fh); err != nil {
+			return nil, fmt.Errorf("ClientID:%q: failed to derive the idempotency key: %w", internalID, err)
+		}
+		key := hex.EncodeToString(fh.Sum(nil))
+		c.idempotencyKeys.start(key, c.clock.Now())
+		req.Header.Set("Idempotency-Key", key)
 	}
 
 	return req, nil
 }
 
+func (c *Client) setCorrelationID(req *http.Request) {
+	if id, ok := req.Context().Value(ctxKeyCorrelationID{}).(string); ok && id != "" {
+		req.Header.Set(c.correlationIDHeader, id)
+	}
+}
+
 // Status allows once a transactionId has been received the status can be checked
 // with the Status API.
 func (c *Client) Status(ctx context.Context, transactionID string) (*ResponseStatus, error) {
@@ -250,28 +933,65 @@ func (c *Client) Status(ctx context.Context, transactionID string) (*ResponseSta
 		return nil, fmt.Errorf("transactionID cannot be empty")
 	}
 	internalID := c.currentInternalID
-	host := endpointURLSandBox
-	if c.merchants[internalID].EnableProduction {
-		host = endpointURLProduction
+	if c.statusCache != nil {
+		if rs, ok := c.statusCache.get(internalID + "/" + transactionID); ok {
+			return rs, nil
+		}
 	}
+	m, _ := c.merchant(internalID)
+	host := m.environment().endpointURL()
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf(host+pathStatus, transactionID), nil)
 	if err != nil {
 		return nil, fmt.Errorf("ClientID:%q: failed to create HTTP request: %w", internalID, err)
 	}
+	c.setCorrelationID(req)
 
 	var respStatus ResponseStatus
 	if err := c.do(req, &respStatus); err != nil {
 		return nil, fmt.Errorf("ClientID:%q: failed to execute HTTP request: %w", internalID, err)
 	}
+	if c.statusCache != nil {
+		c.statusCache.add(internalID+"/"+transactionID, respStatus)
+	}
 
 	return &respStatus, nil
 }
 
+// uncacheStatus removes a transaction whose status is about to change from
+// the status cache.
+func (c *Client) uncacheStatus(transactionID string) {
+	if c.statusCache != nil {
+		c.statusCache.remove(c.currentInternalID + "/" + transactionID)
+	}
+}
+
+// VerifyCredentials checks the credentials of a merchant with the cheapest
+// authenticated call available: the status of a non existing transaction.
+// Returns nil if datatrans accepted the credentials, an error wrapping
+// ErrUnauthorized on HTTP 401/403 or any other error, e.g. from the network.
+func (c *Client) VerifyCredentials(ctx context.Context, internalID string) error {
+	_, err := c.WithMerchant(internalID).Status(ctx, "0")
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, ErrUnauthorized) {
+		return fmt.Errorf("ClientID:%q: %w", internalID, ErrUnauthorized)
+	}
+	var errResp ErrorResponse
+	if errors.As(err, &errResp) && errResp.HTTPStatusCode < http.StatusInternalServerError {
+		return nil // authenticated, e.g. TRANSACTION_NOT_FOUND
+	}
+	return err
+}
+
 // Credit uses the credit API to credit a transaction which is in status settled.
 // The previously settled amount must not be exceeded.
 func (c *Client) Credit(ctx context.Context, transactionID string, rc RequestCredit) (*ResponseCardMasked, error) {
-	if transactionID == "" || rc.Currency == "" || rc.RefNo == "" {
-		return nil, fmt.Errorf("neither currency nor refno nor transactionID can be empty")
+	if transactionID == "" {
+		return nil, fmt.Errorf("transactionID cannot be empty")
+	}
+	if err := rc.Validate(); err != nil {
+		return nil, err
 	}
 
 	req, err := c.prepareJSONReq(ctx, http.MethodPost, fmt.Sprintf(pathCredit, transactionID), rc)
@@ -279,6 +999,7 @@ func (c *Client) Credit(ctx context.Context, transactionID string, rc RequestCre
 		return nil, err
 	}
 
+	c.uncacheStatus(transactionID)
 	var respRefund ResponseCardMasked
 	if err := c.do(req, &respRefund); err != nil {
 		return nil, fmt.Errorf("ClientID:%q: failed to execute HTTP request: %w", c.currentInternalID, err)
@@ -291,8 +1012,8 @@ func (c *Client) Credit(ctx context.Context, transactionID string, rc RequestCre
 // previous authorization. This can be useful if you want to credit a cardholder
 // when there was no debit.
 func (c *Client) CreditAuthorize(ctx context.Context, rca RequestCreditAuthorize) (*ResponseCardMasked, error) {
-	if rca.Currency == "" || rca.RefNo == "" || rca.Amount == 0 {
-		return nil, fmt.Errorf("neither currency nor refno nor amount can be empty")
+	if err := rca.Validate(); err != nil {
+		return nil, err
 	}
 
 	req, err := c.prepareJSONReq(ctx, http.MethodPost, pathCreditAuthorize, rca)
@@ -315,15 +1036,24 @@ func (c *Client) Cancel(ctx context.Context, transactionID string, refno string)
 	if transactionID == "" || refno == "" {
 		return fmt.Errorf("neither transactionID nor refno can be empty")
 	}
-	req, err := c.prepareJSONReq(ctx, http.MethodPost, fmt.Sprintf(pathCancel, transactionID), struct {
-		Refno string `json:"refno"`
-	}{
-		Refno: refno,
-	})
+	return c.CancelWith(ctx, transactionID, RequestCancel{RefNo: refno})
+}
+
+// CancelWith cancels like Cancel but additionally allows to send refno2 and
+// custom fields.
+func (c *Client) CancelWith(ctx context.Context, transactionID string, rc RequestCancel) error {
+	if transactionID == "" {
+		return fmt.Errorf("transactionID cannot be empty")
+	}
+	if err := rc.Validate(); err != nil {
+		return err
+	}
+	req, err := c.prepareJSONReq(ctx, http.MethodPost, fmt.Sprintf(pathCancel, transactionID), rc)
 	if err != nil {
 		return err
 	}
 
+	c.uncacheStatus(transactionID)
 	if err := c.do(req, nil); err != nil {
 		return fmt.Errorf("ClientID:%q: failed to execute HTTP request: %w", c.currentInternalID, err)
 	}
@@ -336,28 +1066,117 @@ func (c *Client) Cancel(ctx context.Context, transactionID string, refno string)
 // needed if "autoSettle": true was used when initializing a transaction.
 // https://api-reference.datatrans.ch/#operation/settle
 func (c *Client) Settle(ctx context.Context, transactionID string, rs RequestSettle) error {
-	if transactionID == "" || rs.Amount == 0 || rs.Currency == "" || rs.RefNo == "" {
-		return fmt.Errorf("neither transactionID nor refno nor amount nor currency can be empty")
+	if transactionID == "" {
+		return fmt.Errorf("transactionID cannot be empty")
+	}
+	if err := rs.Validate(); err != nil {
+		return err
+	}
+	if c.strictValidation && rs.ShipmentRef != "" {
+		if err := c.validateShipmentSettle(ctx, transactionID, rs); err != nil {
+			return err
+		}
+		if err := ctxErr(ctx, "settle"); err != nil {
+			return err
+		}
 	}
 	req, err := c.prepareJSONReq(ctx, http.MethodPost, fmt.Sprintf(pathSettle, transactionID), rs)
 	if err != nil {
 		return err
 	}
 
+	// a settled transaction can be settled again in case of split shipments
+	c.uncacheStatus(transactionID)
 	if err := c.do(req, nil); err != nil {
 		return fmt.Errorf("ClientID:%q: failed to execute HTTP request: %w", c.currentInternalID, err)
 	}
 	return nil
 }
 
+// ctxErr returns the error of a done ctx so that helpers with several requests
+// stop before sending the next one.
+func ctxErr(ctx context.Context, nextStep string) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("stopped before %s: %w", nextStep, err)
+	}
+	return nil
+}
+
+// validateShipmentSettle fetches the status of the transaction and checks that
+// the already settled amount plus the amount of rs does not exceed the
+// authorized amount.
+func (c *Client) validateShipmentSettle(ctx context.Context, transactionID string, rs RequestSettle) error {
+	status, err := c.Status(ctx, transactionID)
+	if err != nil {
+		return err
+	}
+	authorized := int(status.Detail.Authorize.Amount)
+	settled := int(status.Detail.Settle.Amount)
+	if settled+rs.Amount > authorized {
+		v := validator{typ: "RequestSettle"}
+		v.invalid("amount", fmt.Sprintf("%d exceeds the remaining authorized amount %d", rs.Amount, authorized-settled))
+		return v.err()
+	}
+	return nil
+}
+
+// SettlePartialAndReleaseRemainder settles captureAmount of an authorized
+// transaction. The transaction status and the authorized amount are fetched
+// upfront via Status, the transaction must be in status authorized. Datatrans
+// releases the remaining authorization on the customers account with a partial
+// settlement, so no further request is sent: a Cancel of the settled
+// transaction would cancel the settlement itself. The returned ReleasedAmount
+// reports the remainder released that way. A done ctx stops the sequence
+// before the settlement.
+func (c *Client) SettlePartialAndReleaseRemainder(ctx context.Context, transactionID, refno, currency string, captureAmount int) (*ResponseSettlePartial, error) {
+	if transactionID == "" {
+		return nil, fmt.Errorf("transactionID cannot be empty")
+	}
+	rs := RequestSettle{
+		Amount:   captureAmount,
+		Currency: currency,
+		RefNo:    refno,
+	}
+	if err := rs.Validate(); err != nil {
+		return nil, err
+	}
+	if captureAmount < 0 {
+		return nil, fmt.Errorf("captureAmount %d cannot be negative", captureAmount)
+	}
+
+	status, err := c.Status(ctx, transactionID)
+	if err != nil {
+		return nil, err
+	}
+	if status.Status != StatusAuthorized {
+		return nil, fmt.Errorf("transaction %q must be in status %q but is %q", transactionID, StatusAuthorized, status.Status)
+	}
+	authorized := int(status.Detail.Authorize.Amount)
+	if captureAmount > authorized {
+		return nil, fmt.Errorf("captureAmount %d exceeds the authorized amount %d", captureAmount, authorized)
+	}
+
+	if err := ctxErr(ctx, "settle"); err != nil {
+		return nil, err
+	}
+	if err := c.Settle(ctx, transactionID, rs); err != nil {
+		return nil, err
+	}
+	return &ResponseSettlePartial{
+		AuthorizedAmount: authorized,
+		SettledAmount:    captureAmount,
+		ReleasedAmount:   authorized - captureAmount,
+	}, nil
+}
+
 // ValidateAlias an existing alias can be validated at any time with the
 // transaction validate API. No amount will be blocked on the customers account.
 // Only credit cards (including Apple Pay and Google Pay), PFC, KLN and PAP
 // support validation of an existing alias.
 // https://api-reference.datatrans.ch/#operation/validate
 func (c *Client) ValidateAlias(ctx context.Context, rva RequestValidateAlias) (*ResponseCardMasked, error) {
-	if rva.Currency == "" || rva.RefNo == "" {
-		return nil, fmt.Errorf("neither currency nor refno can be empty")
+	if err := rva.Validate(); err != nil {
+		return nil, err
 	}
 	req, err := c.prepareJSONReq(ctx, http.MethodPost, pathValidate, rva)
 	if err != nil {
@@ -376,8 +1195,11 @@ func (c *Client) ValidateAlias(ctx context.Context, rva RequestValidateAlias) (*
 // can be used to authorize an already authenticated (3D) transaction.
 // https://api-reference.datatrans.ch/#operation/authorize-split
 func (c *Client) AuthorizeTransaction(ctx context.Context, transactionID string, rva RequestAuthorizeTransaction) (*ResponseAuthorize, error) {
-	if transactionID == "" || rva.RefNo == "" {
-		return nil, fmt.Errorf("neither transactionID nor refno can be empty")
+	if transactionID == "" {
+		return nil, fmt.Errorf("transactionID cannot be empty")
+	}
+	if err := rva.Validate(); err != nil {
+		return nil, err
 	}
 	req, err := c.prepareJSONReq(ctx, http.MethodPost, fmt.Sprintf(pathAuthorizeTransaction, transactionID), rva)
 	if err != nil {
@@ -391,6 +1213,30 @@ func (c *Client) AuthorizeTransaction(ctx context.Context, transactionID string,
 	return &rcm, nil
 }
 
+// ThreeDSContinue completes a transaction after the 3DS challenge, e.g. within
+// a Secure Fields integration. Datatrans has no separate continuation
+// endpoint, the authentication results get passed to the authorization of the
+// authenticated transaction.
+// https://api-reference.datatrans.ch/#operation/authorize-split
+func (c *Client) ThreeDSContinue(ctx context.Context, transactionID string, rtc RequestThreeDSContinue) (*ResponseAuthorize, error) {
+	if transactionID == "" {
+		return nil, fmt.Errorf("transactionID cannot be empty")
+	}
+	if err := rtc.Validate(); err != nil {
+		return nil, err
+	}
+	req, err := c.prepareJSONReq(ctx, http.MethodPost, fmt.Sprintf(pathAuthorizeTransaction, transactionID), rtc)
+	if err != nil {
+		return nil, err
+	}
+
+	var ra ResponseAuthorize
+	if err := c.do(req, &ra); err != nil {
+		return nil, fmt.Errorf("ClientID:%q: failed to execute HTTP request: %w", c.currentInternalID, err)
+	}
+	return &ra, nil
+}
+
 // Authorize a transaction. Use this API to make an authorization without user
 // interaction. (For example merchant initiated transactions with an alias)
 // Depending on the payment method, different parameters are mandatory. Refer to
@@ -398,8 +1244,17 @@ func (c *Client) AuthorizeTransaction(ctx context.Context, transactionID string,
 // so send. For credit cards, the card object can be used.
 // https://api-reference.datatrans.ch/#operation/authorize
 func (c *Client) Authorize(ctx context.Context, rva RequestAuthorize) (*ResponseCardMasked, error) {
-	if rva.Amount == 0 || rva.Currency == "" || rva.RefNo == "" {
-		return nil, fmt.Errorf("neither transactionID nor amount nor currency nor refno can be empty")
+	if err := rva.Validate(); err != nil {
+		return nil, err
+	}
+	if c.strictValidation {
+		if err := rva.validateCombinations(); err != nil {
+			return nil, err
+		}
+		rva.Card = normalizeCardholder(rva.Card)
+		if err := validateCardThreeD(rva.Card); err != nil {
+			return nil, err
+		}
 	}
 	req, err := c.prepareJSONReq(ctx, http.MethodPost, pathAuthorize, rva)
 	if err != nil {
@@ -413,6 +1268,84 @@ func (c *Client) Authorize(ctx context.Context, rva RequestAuthorize) (*Response
 	return &rcm, nil
 }
 
+// AuthorizeWithStepUp authorizes like Authorize. If the acquirer soft
+// declines the payment with one of the codes of OptionStepUpCodes, it retries
+// once with threeD as card.3D, e.g. with the full data of a 3-D Secure
+// challenge. The card of rva is not modified.
+func (c *Client) AuthorizeWithStepUp(ctx context.Context, rva RequestAuthorize, threeD ThreeD) (*ResponseCardMasked, error) {
+	if rva.Card == nil {
+		return nil, fmt.Errorf("card cannot be nil")
+	}
+	rcm, err := c.Authorize(ctx, rva)
+	var errResp ErrorResponse
+	if err == nil || !errors.As(err, &errResp) || !c.isStepUpCode(errResp.ErrorDetail.Code) {
+		return rcm, err
+	}
+	if err := ctxErr(ctx, "step-up authorization"); err != nil {
+		return nil, err
+	}
+	card := *rva.Card
+	card.ThreeD = threeD
+	rva.Card = &card
+	return c.Authorize(ctx, rva)
+}
+
+func (c *Client) isStepUpCode(code string) bool {
+	codes := c.stepUpCodes
+	if codes == nil {
+		codes = OptionStepUpCodes{ErrCodeSoftDeclined}
+	}
+	for _, sc := range codes {
+		if sc == code {
+			return true
+		}
+	}
+	return false
+}
+
+// ReauthorizeByAlias charges a card again by using the alias of a previous
+// transaction, e.g. for recurring billing (merchant initiated transaction).
+// The alias gets set as card.alias, the card of rva is not modified.
+func (c *Client) ReauthorizeByAlias(ctx context.Context, alias string, rva RequestAuthorize) (*ResponseCardMasked, error) {
+	if alias == "" {
+		return nil, fmt.Errorf("alias cannot be empty")
+	}
+	var card Card
+	if rva.Card != nil {
+		card = *rva.Card
+	}
+	card.Alias = alias
+	rva.Card = &card
+	return c.Authorize(ctx, rva)
+}
+
+// AuthorizeAndSettle authorizes a transaction with autoSettle enabled and
+// fetches afterwards the transaction status to verify that the settlement
+// happened. Use ResponseAuthorizeAndSettle.IsSettled to check the outcome. If
+// the status request fails or ctx is done after the authorization, the
+// returned response still contains the authorization with the transaction ID
+// and a nil Status, together with the error.
+func (c *Client) AuthorizeAndSettle(ctx context.Context, rva RequestAuthorize) (*ResponseAuthorizeAndSettle, error) {
+	rva.AutoSettle = true
+	rva.AutoSettleExplicit = nil
+	rcm, err := c.Authorize(ctx, rva)
+	if err != nil {
+		return nil, err
+	}
+	rsp := &ResponseAuthorizeAndSettle{
+		ResponseCardMasked: *rcm,
+	}
+	if err := ctxErr(ctx, "status"); err != nil {
+		return rsp, err
+	}
+	rs, err := c.Status(ctx, rcm.TransactionId)
+	if err != nil {
+		return rsp, fmt.Errorf("authorized transaction %q but failed to fetch the status: %w", rcm.TransactionId, err)
+	}
+	rsp.Status = rs
+	return rsp, nil
+}
+
 // Initialize a transaction. Securely send all the needed parameters to the
 // transaction initialization API. The result of this API call is a HTTP 201
 // status code with a transactionId in the response body and the Location header
@@ -423,8 +1356,25 @@ func (c *Client) Authorize(ctx context.Context, rva RequestAuthorize) (*Response
 // merchantId. If you want to limit the number of payment methods, the
 // paymentMethod array can be used.
 func (c *Client) Initialize(ctx context.Context, rva RequestInitialize) (*ResponseInitialize, error) {
-	if rva.Amount == 0 || rva.Currency == "" || rva.RefNo == "" {
-		return nil, fmt.Errorf("neither amount nor currency nor refno can be empty")
+	if err := rva.Validate(); err != nil {
+		return nil, err
+	}
+	if c.strictValidation {
+		if err := rva.validateCombinations(); err != nil {
+			return nil, err
+		}
+		if rva.Customer != nil {
+			cust := *rva.Customer
+			cust.Normalize()
+			if err := cust.validate(c.clock.Now()); err != nil {
+				return nil, err
+			}
+			rva.Customer = &cust
+		}
+		rva.Card = normalizeCardholder(rva.Card)
+		if err := validateCardThreeD(rva.Card); err != nil {
+			return nil, err
+		}
 	}
 	req, err := c.prepareJSONReq(ctx, http.MethodPost, pathInitialize, rva)
 	if err != nil {
@@ -442,8 +1392,8 @@ func (c *Client) Initialize(ctx context.Context, rva RequestInitialize) (*Respon
 // the steps below to process Secure Fields payment transactions.
 // https://api-reference.datatrans.ch/#operation/secureFieldsInit
 func (c *Client) SecureFieldsInit(ctx context.Context, rva RequestSecureFieldsInit) (*ResponseInitialize, error) {
-	if rva.Amount == 0 || rva.Currency == "" || rva.ReturnUrl == "" {
-		return nil, fmt.Errorf("neither amount nor currency nor returnURL can be empty")
+	if err := rva.Validate(); err != nil {
+		return nil, err
 	}
 	req, err := c.prepareJSONReq(ctx, http.MethodPost, pathSecureFields, rva)
 	if err != nil {
@@ -458,12 +1408,27 @@ func (c *Client) SecureFieldsInit(ctx context.Context, rva RequestSecureFieldsIn
 }
 
 // SecureFieldsUpdate use this API to update the amount of a Secure Fields
-// transaction. This action is only allowed before the 3D process. At least one
-// property must be updated.
+// transaction. This action is only allowed before the 3D process, see
+// OptionSecureFieldsUpdateCheck. At least one property must be updated.
 // https://api-reference.datatrans.ch/#operation/secure-fields-update
 func (c *Client) SecureFieldsUpdate(ctx context.Context, transactionID string, rva RequestSecureFieldsUpdate) error {
-	if rva.Amount == 0 || rva.Currency == "" {
-		return fmt.Errorf("neither amount nor currency nor returnURL can be empty")
+	if transactionID == "" {
+		return fmt.Errorf("transactionID cannot be empty")
+	}
+	if err := rva.Validate(); err != nil {
+		return err
+	}
+	if c.secureFieldsUpdateCheck {
+		status, err := c.Status(ctx, transactionID)
+		if err != nil {
+			return err
+		}
+		if status.Status != StatusInitialized {
+			return fmt.Errorf("ClientID:%q: transaction %s has status %q: %w", c.currentInternalID, transactionID, status.Status, ErrSecureFieldsUpdateNotAllowed)
+		}
+		if err := ctxErr(ctx, "update"); err != nil {
+			return err
+		}
 	}
 	req, err := c.prepareJSONReq(ctx, http.MethodPatch, fmt.Sprintf(pathSecureFieldsUpdate, transactionID), rva)
 	if err != nil {
@@ -477,10 +1442,21 @@ func (c *Client) SecureFieldsUpdate(ctx context.Context, transactionID string, r
 }
 
 // AliasConvert converts a legacy (numeric or masked) alias to the most recent
-// alias format.
+// alias format. Use AliasConvertDetails to get the card details too.
 func (c *Client) AliasConvert(ctx context.Context, legacyAlias string) (string, error) {
+	rac, err := c.AliasConvertDetails(ctx, legacyAlias)
+	if err != nil {
+		return "", err
+	}
+	return rac.Alias, nil
+}
+
+// AliasConvertDetails converts a legacy (numeric or masked) alias to the most
+// recent alias format and returns additionally the card details if provided by
+// datatrans.
+func (c *Client) AliasConvertDetails(ctx context.Context, legacyAlias string) (*ResponseAliasConvert, error) {
 	if legacyAlias == "" {
-		return "", fmt.Errorf("legacyAlias cannot be empty")
+		return nil, fmt.Errorf("legacyAlias cannot be empty")
 	}
 	req, err := c.prepareJSONReq(ctx, http.MethodPost, pathAliases, struct {
 		LegacyAlias string `json:"legacyAlias"`
@@ -488,15 +1464,13 @@ func (c *Client) AliasConvert(ctx context.Context, legacyAlias string) (string,
 		LegacyAlias: legacyAlias,
 	})
 	if err != nil {
-		return "", err
-	}
-	var resp struct {
-		Alias string `json:"alias"`
+		return nil, err
 	}
-	if err := c.do(req, &resp); err != nil {
-		return "", fmt.Errorf("ClientID:%q: failed to execute HTTP request: %w", c.currentInternalID, err)
+	var rac ResponseAliasConvert
+	if err := c.do(req, &rac); err != nil {
+		return nil, fmt.Errorf("ClientID:%q: failed to execute HTTP request: %w", c.currentInternalID, err)
 	}
-	return resp.Alias, nil
+	return &rac, nil
 }
 
 // AliasDelete deletes an alias with immediate effect. The alias will no longer
@@ -515,9 +1489,26 @@ func (c *Client) AliasDelete(ctx context.Context, alias string) error {
 	return nil
 }
 
+// AliasDeleteIfExists deletes an alias like AliasDelete but treats an
+// ALIAS_NOT_FOUND error as success, e.g. for cleanup jobs which might run
+// more than once. All other errors get returned.
+func (c *Client) AliasDeleteIfExists(ctx context.Context, alias string) error {
+	err := c.AliasDelete(ctx, alias)
+	var errResp ErrorResponse
+	if errors.As(err, &errResp) && errResp.ErrorDetail.Code == ErrCodeAliasNotFound {
+		return nil
+	}
+	return err
+}
+
 // ReconciliationsSales reports a sale. When using reconciliation, use this API
 // to report a sale. The matching is based on the transactionId.
 func (c *Client) ReconciliationsSales(ctx context.Context, sale RequestReconciliationsSale) (*ResponseReconciliationsSale, error) {
+	if c.strictValidation {
+		if err := sale.Validate(); err != nil {
+			return nil, err
+		}
+	}
 	req, err := c.prepareJSONReq(ctx, http.MethodPost, pathReconciliationsSales, sale)
 	if err != nil {
 		return nil, err
@@ -533,6 +1524,11 @@ func (c *Client) ReconciliationsSales(ctx context.Context, sale RequestReconcili
 // this API to report multiples sales with a single API call. The matching is
 // based on the transactionId.
 func (c *Client) ReconciliationsSalesBulk(ctx context.Context, sales RequestReconciliationsSales) (*ResponseReconciliationsSales, error) {
+	if c.strictValidation {
+		if err := sales.Validate(); err != nil {
+			return nil, err
+		}
+	}
 	req, err := c.prepareJSONReq(ctx, http.MethodPost, pathReconciliationsSalesBulk, sales)
 	if err != nil {
 		return nil, err
@@ -544,13 +1540,35 @@ func (c *Client) ReconciliationsSalesBulk(ctx context.Context, sales RequestReco
 	return &rrs, nil
 }
 
+// DoRequest sends body as JSON to an endpoint which is not wrapped by this
+// package yet and decodes the success response into out. path is relative to
+// the API host, e.g. "/v1/transactions/{id}/...". The request runs through
+// the same pipeline as the other methods: authentication, idempotency keys for
+// POST, correlation IDs, retries, CustomFields merging, the raw body and
+// ErrorResponse on failures. body and out can be nil. Advanced: the signature
+// might change, prefer the typed methods once they exist.
+func (c *Client) DoRequest(ctx context.Context, method, path string, body, out interface{}) error {
+	if !strings.HasPrefix(path, "/") {
+		return fmt.Errorf("path %q must start with a slash", path)
+	}
+	req, err := c.prepareJSONReq(ctx, method, path, body)
+	if err != nil {
+		return err
+	}
+	if err := c.do(req, out); err != nil {
+		return fmt.Errorf("ClientID:%q: failed to execute HTTP request: %w", c.currentInternalID, err)
+	}
+	return nil
+}
+
 // GetDataInt returns the int value from the data map or false if not found or failed to convert.
 func (c *Client) GetDataInt(key string) (int, bool) {
 	internalID := c.currentInternalID
 	if !c.internalIDFound {
 		return 0, false
 	}
-	raw, ok := c.merchants[internalID].Data[key]
+	m, _ := c.merchant(internalID)
+	raw, ok := m.Data[key]
 	if !ok {
 		return 0, false
 	}
@@ -572,7 +1590,8 @@ func (c *Client) GetDataString(key string) (string, bool) {
 	if !c.internalIDFound {
 		return "", false
 	}
-	raw, ok := c.merchants[internalID].Data[key]
+	m, _ := c.merchant(internalID)
+	raw, ok := m.Data[key]
 	if !ok {
 		return "", false
 	}
@@ -591,6 +1610,7 @@ func (c *Client) GetDataRaw(key string) (interface{}, bool) {
 	if !c.internalIDFound {
 		return nil, false
 	}
-	raw, ok := c.merchants[internalID].Data[key]
+	m, _ := c.merchant(internalID)
+	raw, ok := m.Data[key]
 	return raw, ok
 }
@@ -0,0 +1,235 @@
+package datatrans
+
+import (
+	"context"
+	"crypto/tls"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func Test_newHTTPClient(t *testing.T) {
+	hc := newHTTPClient(OptionTransport{
+		MaxIdleConnsPerHost: 50,
+		IdleConnTimeout:     90 * time.Second,
+		ForceAttemptHTTP2:   true,
+	})
+	if hc.Timeout != 30*time.Second {
+		t.Errorf("invalid timeout: %s", hc.Timeout)
+	}
+	tr := hc.Transport.(*http.Transport)
+	if tr.TLSClientConfig.MinVersion != tls.VersionTLS12 {
+		t.Error("TLS floor not kept")
+	}
+	if tr.MaxIdleConnsPerHost != 50 || tr.IdleConnTimeout != 90*time.Second || !tr.ForceAttemptHTTP2 {
+		t.Errorf("transport options not applied: %d %s %t", tr.MaxIdleConnsPerHost, tr.IdleConnTimeout, tr.ForceAttemptHTTP2)
+	}
+}
+
+func TestOptionTransport_Request(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		proto string
+		dials int
+	)
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		proto = r.Proto
+		mu.Unlock()
+		_, _ = w.Write([]byte(`{"transactionId":"210215103042148501","status":"settled"}`))
+	}))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+
+	c, err := MakeClient(
+		OptionTransport{
+			MaxIdleConnsPerHost: 50,
+			IdleConnTimeout:     90 * time.Second,
+			ForceAttemptHTTP2:   true,
+		},
+		OptionMerchant{
+			MerchantID: "322342",
+			Password:   "sfdgsdfg",
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// route the sandbox host to the test server and trust its certificate
+	tr := c.httpClient.Transport.(*http.Transport)
+	tr.TLSClientConfig.RootCAs = srv.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs
+	tr.TLSClientConfig.ServerName = "example.com"
+	tr.DialContext = func(ctx context.Context, network, _ string) (net.Conn, error) {
+		mu.Lock()
+		dials++
+		mu.Unlock()
+		var d net.Dialer
+		return d.DialContext(ctx, network, srv.Listener.Addr().String())
+	}
+
+	for i := 0; i < 2; i++ {
+		rs, err := c.Status(context.Background(), "210215103042148501")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rs.Status != StatusSettled {
+			t.Errorf("invalid status: %q", rs.Status)
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	// a custom DialContext disables HTTP/2 unless ForceAttemptHTTP2 is set
+	if proto != "HTTP/2.0" {
+		t.Errorf("ForceAttemptHTTP2 not applied, request sent with %s", proto)
+	}
+	if dials != 1 {
+		t.Errorf("the idle connection should be reused, dialed %d times", dials)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClient_idempotencySeparateCalls(t *testing.T) {
+	var sent int
+	fc := newFakeClock(time.Date(2021, 2, 15, 10, 0, 0, 0, time.UTC))
+	c, err := MakeClient(
+		optionClock{fc},
+		OptionHTTPRequestFn(func(req *http.Request) (*http.Response, error) {
+			sent++
+			return &http.Response{
+				StatusCode: 204,
+				Body:       ioutil.NopCloser(strings.NewReader("")),
+			}, nil
+		}),
+		OptionMerchant{
+			EnableIdempotency: true,
+			MerchantID:        "322342",
+			Password:          "sfdgsdfg",
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	cancel := func() error { return c.Cancel(ctx, "210215103042148501", "872732") }
+
+	// separate calls are not retries, even after the TTL
+	if err := cancel(); err != nil {
+		t.Fatal(err)
+	}
+	fc.Advance(5 * time.Minute)
+	if err := cancel(); err != nil {
+		t.Fatalf("a repeated call after the TTL must be sent: %v", err)
+	}
+	if sent != 2 {
+		t.Errorf("both calls should be sent, sent %d requests", sent)
+	}
+
+	// the second call restarted the TTL of the key
+	key := idempotencyKey("", endpointURLSandBox,
+		"/v1/transactions/210215103042148501/cancel", []byte(`{"refno":"872732"}`))
+	fc.Advance(time.Minute)
+	if err := c.idempotencyKeys.checkRetry(key, fc.Now()); err != nil {
+		t.Errorf("a retry within the TTL of the second call must be allowed: %v", err)
+	}
+	fc.Advance(idempotencyKeyTTL)
+	if err := c.idempotencyKeys.checkRetry(key, fc.Now()); err != ErrIdempotencyExpired {
+		t.Errorf("a retry after the TTL must be rejected, got: %v", err)
+	}
+
+	fc.Advance(idempotencyKeyRetention + time.Minute)
+	if err := c.Cancel(ctx, "210215103042148501", "other"); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(c.idempotencyKeys.firstUsed); n != 1 {
+		t.Errorf("old keys should be pruned, got %d keys", n)
+	}
+}
+
+type responseReinit struct {
+	TransactionID string `json:"transactionId"`
+	Location      string `json:"-"`
+}
+
+func (r *responseReinit) setLocation(loc string) { r.Location = loc }
+
+func TestClient_do_locationSetter(t *testing.T) {
+	const loc = "https://pay.sandbox.datatrans.com/v1/start/210215103033478409"
+	c, err := MakeClient(
+		OptionHTTPRequestFn(func(req *http.Request) (*http.Response, error) {
+			return &http.Response{
+				StatusCode: 201,
+				Header:     http.Header{"Location": []string{loc}},
+				Body:       ioutil.NopCloser(strings.NewReader(`{"transactionId":"210215103033478409"}`)),
+			}, nil
+		}),
+		OptionMerchant{
+			MerchantID: "322342",
+			Password:   "sfdgsdfg",
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := c.prepareJSONReq(context.Background(), http.MethodPost, pathInitialize, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rr responseReinit
+	if err := c.do(req, &rr); err != nil {
+		t.Fatal(err)
+	}
+	if rr.Location != loc || rr.TransactionID != "210215103033478409" {
+		t.Errorf("invalid response: %#v", rr)
+	}
+}
+
+func TestClient_Initialize_BirthDateClock(t *testing.T) {
+	var sent int
+	c, err := MakeClient(
+		optionClock{newFakeClock(time.Date(2021, 2, 15, 10, 0, 0, 0, time.UTC))},
+		OptionStrictValidation(true),
+		OptionHTTPRequestFn(func(req *http.Request) (*http.Response, error) {
+			sent++
+			return &http.Response{
+				StatusCode: 201,
+				Body:       ioutil.NopCloser(strings.NewReader(`{"transactionId":"210215103033478409"}`)),
+			}, nil
+		}),
+		OptionMerchant{
+			MerchantID: "322342",
+			Password:   "sfdgsdfg",
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	initialize := func(birthDate string) error {
+		_, err := c.Initialize(context.Background(), RequestInitialize{
+			Currency: "CHF",
+			RefNo:    "872732",
+			Amount:   1337,
+			Customer: &Customer{BirthDate: birthDate},
+		})
+		return err
+	}
+	if err := initialize("2021-02-15"); err != nil {
+		t.Fatalf("birth date today must be valid: %v", err)
+	}
+	if err := initialize("2021-02-16"); err == nil || err.Error() != "Customer: birthDate cannot be in the future" {
+		t.Errorf("invalid error: %v", err)
+	}
+	if sent != 1 {
+		t.Errorf("only the valid request should be sent, sent %d requests", sent)
+	}
+}
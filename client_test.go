@@ -2,14 +2,19 @@ package datatrans_test
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
+	"encoding/json"
 	"errors"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"os"
 	"reflect"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/globusdigital/datatrans"
 )
@@ -63,6 +68,91 @@ func TestClient_Status(t *testing.T) {
 	if rs.TransactionID != "210215103042148501" {
 		t.Errorf("incorrect TransactionID:%q", rs.TransactionID)
 	}
+	wantAuthorize := datatrans.AuthorizeDetail{Amount: 1000, AcquirerAuthorizationCode: "103042"}
+	if rs.Detail.Authorize != wantAuthorize {
+		t.Errorf("incorrect Detail.Authorize:%#v", rs.Detail.Authorize)
+	}
+	if rs.Detail.Settle != (datatrans.SettleDetail{}) {
+		t.Errorf("incorrect Detail.Settle:%#v", rs.Detail.Settle)
+	}
+	if rs.Card.Fingerprint != "F-dV5V8dE0SZLoTurWbq2HZp" {
+		t.Errorf("incorrect Card.Fingerprint:%q", rs.Card.Fingerprint)
+	}
+	if c, ok := rs.IssuerCountry(); !ok || c != "GB" {
+		t.Errorf("incorrect IssuerCountry:%q %t", c, ok)
+	}
+	if _, ok := (datatrans.ResponseStatus{Card: &datatrans.CardExtended{}}).IssuerCountry(); ok {
+		t.Error("IssuerCountry should not be present without card info")
+	}
+}
+
+func TestClient_Status_Cards(t *testing.T) {
+	c, err := datatrans.MakeClient(
+		datatrans.OptionHTTPRequestFn(mockResponse(t, 200, "testdata/status_response.json", nil)),
+		datatrans.OptionMerchant{
+			MerchantID: "322342",
+			Password:   "32168",
+		},
+	)
+	must(t, err)
+
+	rs, err := c.Status(context.Background(), "3423423423")
+	must(t, err)
+	cards := rs.Cards()
+	if len(cards) != 1 || cards[0].Masked != "424242xxxxxx4242" || cards[0].Fingerprint != rs.Card.Fingerprint {
+		t.Errorf("want Card as only card, have %#v", cards)
+	}
+	if cards := (datatrans.ResponseStatus{}).Cards(); cards != nil {
+		t.Errorf("want no cards, have %#v", cards)
+	}
+}
+
+func TestClient_Status_Gzip(t *testing.T) {
+	raw, err := ioutil.ReadFile("testdata/status_response.json")
+	must(t, err)
+	gzipped := func(p []byte) io.ReadCloser {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		_, _ = zw.Write(p)
+		must(t, zw.Close())
+		return ioutil.NopCloser(&buf)
+	}
+
+	status := 200
+	c, err := datatrans.MakeClient(
+		datatrans.OptionHTTPRequestFn(func(req *http.Request) (*http.Response, error) {
+			body := gzipped(raw)
+			if status != 200 {
+				body = gzipped([]byte(`{"error":{"code":"TRANSACTION_NOT_FOUND"}}`))
+			}
+			return &http.Response{
+				StatusCode: status,
+				Header:     http.Header{"Content-Encoding": []string{"gzip"}},
+				Body:       body,
+			}, nil
+		}),
+		datatrans.OptionMerchant{
+			MerchantID: "322342",
+			Password:   "32168",
+		},
+	)
+	must(t, err)
+
+	rs, err := c.Status(context.Background(), "3423423423")
+	must(t, err)
+	if rs.TransactionID != "210215103042148501" {
+		t.Errorf("incorrect TransactionID:%q", rs.TransactionID)
+	}
+	if !bytes.Equal(rs.RawJSONBody, raw) {
+		t.Errorf("RawJSONBody must contain the decompressed body:%q", rs.RawJSONBody)
+	}
+
+	status = 404
+	_, err = c.Status(context.Background(), "3423423424")
+	var errResp datatrans.ErrorResponse
+	if !errors.As(err, &errResp) || errResp.ErrorDetail.Code != datatrans.ErrCodeTransactionNotFound {
+		t.Errorf("expected a decoded ErrorResponse, got: %v", err)
+	}
 }
 
 func TestClient_Initialize(t *testing.T) {
@@ -138,6 +228,31 @@ func TestClient_Initialize(t *testing.T) {
 	})
 }
 
+func TestClient_Initialize_MobileTokenExpires(t *testing.T) {
+	c, err := datatrans.MakeClient(
+		datatrans.OptionHTTPRequestFn(mockResponse(t, 201, `{"transactionId":"210215103033478409","mobileToken":"a1b2c3","expires":"2021-02-15T10:30:33Z"}`, nil)),
+		datatrans.OptionMerchant{
+			MerchantID: "322342",
+			Password:   "sfdgsdfg",
+		},
+	)
+	must(t, err)
+
+	rs, err := c.Initialize(context.Background(), datatrans.RequestInitialize{
+		Currency: "CHF",
+		RefNo:    "872732",
+		Amount:   1337,
+		Option:   &datatrans.InitializeOption{ReturnMobileToken: true},
+	})
+	must(t, err)
+	if rs.MobileToken != "a1b2c3" {
+		t.Errorf("invalid mobile token: %q", rs.MobileToken)
+	}
+	if want := time.Date(2021, 2, 15, 10, 30, 33, 0, time.UTC); !rs.Expires.Equal(want) {
+		t.Errorf("invalid expiry: %s", rs.Expires)
+	}
+}
+
 func TestMarshalJSON(t *testing.T) {
 	ri := datatrans.RequestInitialize{
 		Currency:   "CHF",
@@ -194,6 +309,155 @@ func TestClient_AliasDelete_Error(t *testing.T) {
 	}
 }
 
+func TestClient_AliasDeleteIfExists(t *testing.T) {
+	newClient := func(status int, body string) datatrans.Client {
+		c, err := datatrans.MakeClient(
+			datatrans.OptionHTTPRequestFn(mockResponse(t, status, body, func(t *testing.T, req *http.Request) {
+				if req.Method != http.MethodDelete {
+					t.Error("not a delete request")
+				}
+			})),
+			datatrans.OptionMerchant{
+				MerchantID: "322342",
+				Password:   "sfdgsdfg",
+			},
+		)
+		must(t, err)
+		return c
+	}
+	const alias = "3469efdbbdcb043e56b19ffca69a8be0c5524d89"
+
+	c := newClient(204, "")
+	must(t, c.AliasDeleteIfExists(context.Background(), alias))
+
+	c = newClient(400, `{"error": {"code": "ALIAS_NOT_FOUND"}}`)
+	must(t, c.AliasDeleteIfExists(context.Background(), alias))
+
+	c = newClient(500, `{"error": {"code": "SERVER_ERROR"}}`)
+	err := c.AliasDeleteIfExists(context.Background(), alias)
+	var errResp datatrans.ErrorResponse
+	if !errors.As(err, &errResp) || errResp.HTTPStatusCode != 500 || errResp.ErrorDetail.Code != datatrans.ErrCodeServerError {
+		t.Errorf("expected the server error, got: %v", err)
+	}
+
+	c = newClient(400, `{"error": {"code": "INVALID_ALIAS"}}`)
+	if err := c.AliasDeleteIfExists(context.Background(), alias); err == nil {
+		t.Error("expected INVALID_ALIAS to be returned")
+	}
+	if err := c.AliasDeleteIfExists(context.Background(), ""); err == nil {
+		t.Error("expected an error for an empty alias")
+	}
+}
+
+func TestClient_ErrorSentBody(t *testing.T) {
+	c, err := datatrans.MakeClient(
+		datatrans.OptionHTTPRequestFn(mockResponse(t, 400, `{"error": {"code": "INVALID_PROPERTY"}}`, nil)),
+		datatrans.OptionMerchant{
+			MerchantID: "322342",
+			Password:   "sfdgsdfg",
+		},
+	)
+	must(t, err)
+
+	_, err = c.ValidateAlias(context.Background(), datatrans.RequestValidateAlias{
+		Currency:     "CHF",
+		RefNo:        "872732",
+		Card:         &datatrans.Card{Alias: "70119122433810042", ExpiryMonth: "12"},
+		CustomFields: datatrans.CustomFields{"extra": "x"},
+	})
+	var errResp datatrans.ErrorResponse
+	if !errors.As(err, &errResp) {
+		t.Fatalf("expected an ErrorResponse, got: %v", err)
+	}
+	const want = `{"card":{"alias":"xxxxxxxxxxxxx0042","expiryMonth":"12"},"currency":"CHF","extra":"x","refno":"872732"}`
+	if string(errResp.SentBody) != want {
+		t.Errorf("invalid SentBody: %s", errResp.SentBody)
+	}
+}
+
+func TestClient_ErrorSentBody_Wallets(t *testing.T) {
+	c, err := datatrans.MakeClient(
+		datatrans.OptionHTTPRequestFn(func(req *http.Request) (*http.Response, error) {
+			return &http.Response{
+				StatusCode: 400,
+				Body:       ioutil.NopCloser(strings.NewReader(`{"error": {"code": "INVALID_PROPERTY"}}`)),
+			}, nil
+		}),
+		datatrans.OptionMerchant{
+			MerchantID: "322342",
+			Password:   "sfdgsdfg",
+		},
+	)
+	must(t, err)
+
+	for _, ra := range []datatrans.RequestAuthorize{
+		{
+			APL: &datatrans.ApplePay{Token: datatrans.ApplePayToken{
+				Version:   "EC_v1",
+				Data:      "apl-secret",
+				Signature: "apl-signature",
+				Header:    &datatrans.ApplePayHeader{EphemeralPublicKey: "apl-key", TransactionID: "4711"},
+			}},
+		},
+		{
+			PAY: &datatrans.GooglePay{Token: datatrans.GooglePayToken{
+				ProtocolVersion:        "ECv2",
+				Signature:              "pay-signature",
+				IntermediateSigningKey: &datatrans.GooglePayIntermediateSigningKey{SignedKey: `{"keyValue":"pay-key"}`, Signatures: []string{"pay-sig1", "pay-sig2"}},
+				SignedMessage:          `{"encryptedMessage":"pay-secret"}`,
+			}},
+			CustomFields: datatrans.CustomFields{"data": "kept"},
+		},
+	} {
+		ra.Amount, ra.Currency, ra.RefNo = 1000, "CHF", "872732"
+		_, err = c.Authorize(context.Background(), ra)
+		var errResp datatrans.ErrorResponse
+		if !errors.As(err, &errResp) {
+			t.Fatalf("expected an ErrorResponse, got: %v", err)
+		}
+		sent := string(errResp.SentBody)
+		for _, secret := range []string{"apl-secret", "apl-signature", "apl-key", "pay-signature", "pay-key", "pay-sig", "pay-secret"} {
+			if strings.Contains(sent, secret) {
+				t.Errorf("SentBody contains %q: %s", secret, sent)
+			}
+		}
+		if ra.APL != nil && !strings.Contains(sent, `"version":"EC_v1"`) {
+			t.Errorf("APL version should be kept: %s", sent)
+		}
+		if ra.PAY != nil && (!strings.Contains(sent, `"protocolVersion":"ECv2"`) || !strings.Contains(sent, `"data":"kept"`)) {
+			t.Errorf("fields outside of the token should be kept: %s", sent)
+		}
+	}
+}
+
+func TestClient_ErrorIdempotencyKey(t *testing.T) {
+	var sentKey string
+	c, err := datatrans.MakeClient(
+		datatrans.OptionHTTPRequestFn(mockResponse(t, 400, `{"error": {"code": "INVALID_PROPERTY"}}`, func(t *testing.T, req *http.Request) {
+			sentKey = req.Header.Get("Idempotency-Key")
+		})),
+		datatrans.OptionMerchant{
+			EnableIdempotency: true,
+			MerchantID:        "322342",
+			Password:          "sfdgsdfg",
+		},
+	)
+	must(t, err)
+
+	_, err = c.Initialize(context.Background(), datatrans.RequestInitialize{
+		Currency: "CHF",
+		RefNo:    "872732",
+		Amount:   1337,
+	})
+	var errResp datatrans.ErrorResponse
+	if !errors.As(err, &errResp) {
+		t.Fatalf("expected an ErrorResponse, got: %v", err)
+	}
+	if sentKey == "" || errResp.IdempotencyKey != sentKey {
+		t.Errorf("invalid IdempotencyKey %q, sent %q", errResp.IdempotencyKey, sentKey)
+	}
+}
+
 func TestClient_GetData(t *testing.T) {
 	c, err := datatrans.MakeClient(
 		datatrans.OptionMerchant{
@@ -227,3 +491,1385 @@ func TestClient_GetData(t *testing.T) {
 		t.Errorf("wrong value for k2: %#v", v)
 	}
 }
+
+func TestClient_UpdateCredentials(t *testing.T) {
+	c, err := datatrans.MakeClient(
+		datatrans.OptionHTTPRequestFn(func(req *http.Request) (*http.Response, error) {
+			u, p, _ := req.BasicAuth()
+			if !(u == "old" && p == "oldpw") && !(u == "new" && p == "newpw") {
+				t.Errorf("torn credentials: %q:%q", u, p)
+			}
+			return &http.Response{
+				StatusCode: 200,
+				Body:       ioutil.NopCloser(strings.NewReader(`{"transactionId":"210215103042148501"}`)),
+			}, nil
+		}),
+		datatrans.OptionMerchant{
+			MerchantID: "old",
+			Password:   "oldpw",
+		},
+	)
+	must(t, err)
+
+	if err := c.UpdateCredentials("unknown", "new", "newpw"); err == nil {
+		t.Error("expected an error for an unknown internalID")
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				if _, err := c.Status(context.Background(), "210215103042148501"); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	for i := 0; i < 50; i++ {
+		if i%2 == 0 {
+			must(t, c.UpdateCredentials("", "new", "newpw"))
+		} else {
+			must(t, c.UpdateCredentials("", "old", "oldpw"))
+		}
+	}
+	wg.Wait()
+}
+
+func TestMakeClient_StrictEnvironment(t *testing.T) {
+	t.Run("unset environment errors", func(t *testing.T) {
+		_, err := datatrans.MakeClient(
+			datatrans.OptionStrictEnvironment(true),
+			datatrans.OptionMerchant{
+				MerchantID:       "322342",
+				EnableProduction: true,
+			},
+		)
+		if err == nil {
+			t.Fatal("expected an error")
+		}
+	})
+
+	t.Run("explicit environment", func(t *testing.T) {
+		c, err := datatrans.MakeClient(
+			datatrans.OptionStrictEnvironment(true),
+			datatrans.OptionMerchant{
+				MerchantID:  "322342",
+				Environment: datatrans.EnvironmentProduction,
+			},
+			datatrans.OptionMerchant{
+				InternalID:  "B",
+				MerchantID:  "B",
+				Environment: datatrans.EnvironmentSandbox,
+			},
+		)
+		must(t, err)
+		if e := c.Environment(""); e != datatrans.EnvironmentProduction {
+			t.Errorf("wrong environment: %s", e)
+		}
+		if e := c.Environment("B"); e != datatrans.EnvironmentSandbox {
+			t.Errorf("wrong environment: %s", e)
+		}
+		if e := c.Environment("X"); e != datatrans.EnvironmentUnset {
+			t.Errorf("wrong environment: %s", e)
+		}
+	})
+
+	t.Run("deprecated EnableProduction", func(t *testing.T) {
+		c, err := datatrans.MakeClient(
+			datatrans.OptionMerchant{
+				MerchantID:       "322342",
+				EnableProduction: true,
+			},
+		)
+		must(t, err)
+		if e := c.Environment(""); e != datatrans.EnvironmentProduction {
+			t.Errorf("wrong environment: %s", e)
+		}
+	})
+}
+
+func TestClient_IsProduction(t *testing.T) {
+	c, err := datatrans.MakeClient(
+		datatrans.OptionMerchant{
+			MerchantID:       "322342",
+			EnableProduction: true,
+		},
+		datatrans.OptionMerchant{
+			InternalID: "B",
+			MerchantID: "B",
+		},
+	)
+	must(t, err)
+	if !c.IsProduction("") {
+		t.Error("expected production")
+	}
+	if c.IsProduction("B") {
+		t.Error("expected sandbox")
+	}
+	if c.IsProduction("X") {
+		t.Error("unknown merchant cannot be production")
+	}
+}
+
+func TestClient_PaymentMethods(t *testing.T) {
+	c, err := datatrans.MakeClient(
+		datatrans.OptionMerchant{
+			InternalID:     "A",
+			MerchantID:     "322342",
+			Password:       "sfdgsdfg",
+			PaymentMethods: []datatrans.PaymentMethod{datatrans.PaymentMethodVIS, datatrans.PaymentMethodTWI, "DIN"},
+		},
+		datatrans.OptionMerchant{
+			InternalID: "B",
+			MerchantID: "322343",
+			Password:   "sfdgsdfg",
+		},
+	)
+	must(t, err)
+
+	pms := c.PaymentMethods("A")
+	if want := []datatrans.PaymentMethod{"VIS", "TWI", "DIN"}; !reflect.DeepEqual(pms, want) {
+		t.Errorf("invalid payment methods: %q", pms)
+	}
+	pms[0] = "XXX"
+	if pms := c.PaymentMethods("A"); pms[0] != "VIS" {
+		t.Errorf("configuration has been modified: %q", pms)
+	}
+	if pms := c.PaymentMethods("B"); pms != nil {
+		t.Errorf("expected nil: %q", pms)
+	}
+	if pms := c.PaymentMethods("X"); pms != nil {
+		t.Errorf("expected nil: %q", pms)
+	}
+
+	for _, pm := range []datatrans.PaymentMethod{"", "vis", "VISA", "V1S", "VSA", "XYZ"} {
+		if pm.Valid() {
+			t.Errorf("%q must not be valid", pm)
+		}
+		_, err := datatrans.MakeClient(datatrans.OptionMerchant{
+			MerchantID:     "322342",
+			Password:       "sfdgsdfg",
+			PaymentMethods: []datatrans.PaymentMethod{pm},
+		})
+		if err == nil {
+			t.Errorf("expected an error for %q", pm)
+		}
+	}
+}
+
+func TestClient_CorrelationID(t *testing.T) {
+	var gotHeader []string
+	c, err := datatrans.MakeClient(
+		datatrans.OptionCorrelationIDHeader("X-Trace"),
+		datatrans.OptionHTTPRequestFn(func(req *http.Request) (*http.Response, error) {
+			gotHeader = req.Header.Values("X-Trace")
+			return &http.Response{
+				StatusCode: 200,
+				Body:       ioutil.NopCloser(strings.NewReader(`{}`)),
+			}, nil
+		}),
+		datatrans.OptionMerchant{
+			MerchantID: "322342",
+			Password:   "sfdgsdfg",
+		},
+	)
+	must(t, err)
+
+	ctx := datatrans.WithCorrelationID(context.Background(), "corr-4711")
+
+	_, err = c.Status(ctx, "3423423423")
+	must(t, err)
+	if len(gotHeader) != 1 || gotHeader[0] != "corr-4711" {
+		t.Errorf("invalid correlation header: %q", gotHeader)
+	}
+
+	must(t, c.Cancel(ctx, "3423423423", "872732"))
+	if len(gotHeader) != 1 || gotHeader[0] != "corr-4711" {
+		t.Errorf("invalid correlation header: %q", gotHeader)
+	}
+
+	must(t, c.Cancel(context.Background(), "3423423423", "872732"))
+	if len(gotHeader) != 0 {
+		t.Errorf("correlation header should be absent: %q", gotHeader)
+	}
+}
+
+func TestClient_AuthorizeAndSettle(t *testing.T) {
+	c, err := datatrans.MakeClient(
+		datatrans.OptionHTTPRequestFn(func(req *http.Request) (*http.Response, error) {
+			body := `{"transactionId":"210215103042148501","status":"settled"}`
+			if req.Method == http.MethodPost {
+				var buf bytes.Buffer
+				buf.ReadFrom(req.Body)
+				const wantBody = `{"amount":1337,"currency":"CHF","refno":"872732","autoSettle":true}`
+				if buf.String() != wantBody {
+					t.Errorf("invalid body: %q", buf.String())
+				}
+				body = `{"transactionId":"210215103042148501","acquirerAuthorizationCode":"103042"}`
+			}
+			return &http.Response{
+				StatusCode: 200,
+				Body:       ioutil.NopCloser(strings.NewReader(body)),
+			}, nil
+		}),
+		datatrans.OptionMerchant{
+			MerchantID: "322342",
+			Password:   "sfdgsdfg",
+		},
+	)
+	must(t, err)
+
+	rs, err := c.AuthorizeAndSettle(context.Background(), datatrans.RequestAuthorize{
+		Amount:   1337,
+		Currency: "CHF",
+		RefNo:    "872732",
+	})
+	must(t, err)
+	if !rs.IsSettled() {
+		t.Error("transaction should be settled")
+	}
+	if rs.AcquirerAuthorizationCode != "103042" {
+		t.Errorf("invalid AcquirerAuthorizationCode: %q", rs.AcquirerAuthorizationCode)
+	}
+}
+
+func TestClient_AuthorizeAndSettle_StatusFails(t *testing.T) {
+	tests := []struct {
+		name      string
+		cancel    bool
+		wantCalls int
+	}{
+		{"status error", false, 2},
+		{"canceled", true, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			var calls int
+			c, err := datatrans.MakeClient(
+				datatrans.OptionHTTPRequestFn(func(req *http.Request) (*http.Response, error) {
+					calls++
+					if req.Method == http.MethodGet {
+						return &http.Response{
+							StatusCode: 500,
+							Body:       ioutil.NopCloser(strings.NewReader(`{"error":{"code":"UNKNOWN_ERROR","message":"unknown"}}`)),
+						}, nil
+					}
+					if tt.cancel {
+						cancel()
+					}
+					return &http.Response{
+						StatusCode: 200,
+						Body:       ioutil.NopCloser(strings.NewReader(`{"transactionId":"210215103042148501"}`)),
+					}, nil
+				}),
+				datatrans.OptionMerchant{
+					MerchantID: "322342",
+					Password:   "sfdgsdfg",
+				},
+			)
+			must(t, err)
+
+			rs, err := c.AuthorizeAndSettle(ctx, datatrans.RequestAuthorize{
+				Amount:   1337,
+				Currency: "CHF",
+				RefNo:    "872732",
+			})
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if tt.cancel && !errors.Is(err, context.Canceled) {
+				t.Errorf("expected context.Canceled, got: %v", err)
+			}
+			if rs == nil || rs.TransactionId != "210215103042148501" || rs.Status != nil {
+				t.Errorf("expected the authorization in the response: %#v", rs)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("want %d calls, have %d", tt.wantCalls, calls)
+			}
+		})
+	}
+}
+
+func TestClient_AmountBounds(t *testing.T) {
+	var called int
+	c, err := datatrans.MakeClient(
+		datatrans.OptionHTTPRequestFn(func(req *http.Request) (*http.Response, error) {
+			called++
+			return &http.Response{
+				StatusCode: 200,
+				Body:       ioutil.NopCloser(strings.NewReader(`{"transactionId":"210215103042148501"}`)),
+			}, nil
+		}),
+		datatrans.OptionMerchant{
+			MerchantID:   "322342",
+			Password:     "sfdgsdfg",
+			AmountBounds: &datatrans.OptionAmountBounds{Min: 100, Max: 500000},
+		},
+	)
+	must(t, err)
+
+	ra := datatrans.RequestAuthorize{
+		Amount:   1000000,
+		Currency: "CHF",
+		RefNo:    "872732",
+	}
+	if _, err := c.Authorize(context.Background(), ra); err == nil {
+		t.Error("expected an error for an out of bounds amount")
+	}
+	if called != 0 {
+		t.Error("request should not have been sent")
+	}
+
+	ra.Amount = 10000
+	_, err = c.Authorize(context.Background(), ra)
+	must(t, err)
+	if called != 1 {
+		t.Error("request should have been sent")
+	}
+
+	sales := datatrans.RequestReconciliationsSales{Sales: []datatrans.RequestReconciliationsSale{
+		{TransactionID: "210215103042148501", Currency: "CHF", Amount: 1000},
+		{TransactionID: "210215103042148502", Currency: "CHF", Amount: 1000000},
+	}}
+	_, err = c.ReconciliationsSalesBulk(context.Background(), sales)
+	if err == nil || !strings.Contains(err.Error(), "sales[1]: amount 1000000 outside of bounds") {
+		t.Errorf("expected an out of bounds error for the bulk sales, got: %v", err)
+	}
+	_, err = c.ReconciliationsSalesBulkStream(context.Background(), sales, 0)
+	if err == nil || !strings.Contains(err.Error(), "sales[1]: amount 1000000 outside of bounds") {
+		t.Errorf("expected an out of bounds error for the streamed sales, got: %v", err)
+	}
+	if called != 1 {
+		t.Error("bulk requests should not have been sent")
+	}
+
+	sales.Sales[1].Amount = 2000
+	_, err = c.ReconciliationsSalesBulk(context.Background(), sales)
+	must(t, err)
+	if called != 2 {
+		t.Error("bulk request should have been sent")
+	}
+}
+
+func TestMarshalJSON_Wallets(t *testing.T) {
+	t.Run("Apple Pay", func(t *testing.T) {
+		data, err := datatrans.MarshalJSON(datatrans.RequestAuthorize{
+			Amount:   1000,
+			Currency: "CHF",
+			RefNo:    "872732",
+			APL: &datatrans.ApplePay{
+				Token: datatrans.ApplePayToken{
+					Version:   "EC_v1",
+					Data:      "ZW5jcnlwdGVk",
+					Signature: "c2lnbmF0dXJl",
+					Header: &datatrans.ApplePayHeader{
+						EphemeralPublicKey: "ZXBoZW1lcmFs",
+						PublicKeyHash:      "aGFzaA==",
+						TransactionID:      "4711",
+					},
+				},
+			},
+		})
+		must(t, err)
+		const wantJSON = `{"amount":1000,"currency":"CHF","refno":"872732","APL":{"token":{"version":"EC_v1","data":"ZW5jcnlwdGVk","signature":"c2lnbmF0dXJl","header":{"ephemeralPublicKey":"ZXBoZW1lcmFs","publicKeyHash":"aGFzaA==","transactionId":"4711"}}}}`
+		if string(data) != wantJSON {
+			t.Errorf("\nWant: %s\nHave: %s", wantJSON, data)
+		}
+	})
+
+	t.Run("Google Pay", func(t *testing.T) {
+		data, err := datatrans.MarshalJSON(datatrans.RequestInitialize{
+			Amount:   1000,
+			Currency: "CHF",
+			RefNo:    "872732",
+			PAY: &datatrans.GooglePay{
+				Token: datatrans.GooglePayToken{
+					ProtocolVersion: "ECv2",
+					Signature:       "c2lnbmF0dXJl",
+					IntermediateSigningKey: &datatrans.GooglePayIntermediateSigningKey{
+						SignedKey:  "{}",
+						Signatures: []string{"c2ln"},
+					},
+					SignedMessage: "{}",
+				},
+			},
+		})
+		must(t, err)
+		const wantJSON = `{"currency":"CHF","refno":"872732","amount":1000,"PAY":{"token":{"protocolVersion":"ECv2","signature":"c2lnbmF0dXJl","intermediateSigningKey":{"signedKey":"{}","signatures":["c2ln"]},"signedMessage":"{}"}}}`
+		if string(data) != wantJSON {
+			t.Errorf("\nWant: %s\nHave: %s", wantJSON, data)
+		}
+	})
+}
+
+func TestValidate_OnePaymentInstrument(t *testing.T) {
+	apl := &datatrans.ApplePay{Token: datatrans.ApplePayToken{Version: "EC_v1"}}
+	pay := &datatrans.GooglePay{Token: datatrans.GooglePayToken{ProtocolVersion: "ECv2"}}
+	card := &datatrans.Card{Alias: "70119122433810042"}
+
+	ra := datatrans.RequestAuthorize{Amount: 1000, Currency: "CHF", RefNo: "872732", APL: apl}
+	must(t, ra.Validate())
+	ra.PAY = pay
+	var ve datatrans.ValidationError
+	if err := ra.Validate(); !errors.As(err, &ve) || len(ve.Fields) != 1 || ve.Fields[0].Field != "PAY" {
+		t.Errorf("expected an error for PAY, got: %v", err)
+	}
+	ra.Card = card
+	if err := ra.Validate(); !errors.As(err, &ve) || len(ve.Fields) != 2 {
+		t.Errorf("expected errors for APL and PAY, got: %v", err)
+	}
+
+	ri := datatrans.RequestInitialize{Amount: 1000, Currency: "CHF", RefNo: "872732", Card: card}
+	must(t, ri.Validate())
+	ri.PAY = pay
+	if err := ri.Validate(); !errors.As(err, &ve) || ve.Fields[0].Field != "PAY" {
+		t.Errorf("expected an error for PAY, got: %v", err)
+	}
+}
+
+func TestMarshalJSON_PayPal(t *testing.T) {
+	data, err := datatrans.MarshalJSON(datatrans.RequestAuthorize{
+		Amount:   1000,
+		Currency: "CHF",
+		RefNo:    "872732",
+		PAP: &datatrans.PayPal{
+			Alias:          "B-3E4597263K2914231",
+			FraudSessionID: "8d7f6g5h4j",
+		},
+	})
+	must(t, err)
+	const wantJSON = `{"amount":1000,"currency":"CHF","refno":"872732","PAP":{"alias":"B-3E4597263K2914231","fraudSessionId":"8d7f6g5h4j"}}`
+	if string(data) != wantJSON {
+		t.Errorf("\nWant: %s\nHave: %s", wantJSON, data)
+	}
+}
+
+func TestMarshalJSON_TWINT(t *testing.T) {
+	ri := datatrans.RequestInitialize{
+		Currency:   "CHF",
+		RefNo:      "234234",
+		AutoSettle: true,
+		Amount:     123,
+		Language:   "DE",
+	}
+	riCustom := ri
+	riCustom.CustomFields = map[string]interface{}{
+		"twi": map[string]interface{}{
+			"alias": "ZGZhc2RmYXNkZmFzZGZhc2Q=",
+		},
+	}
+	wantJSON, err := datatrans.MarshalJSON(riCustom)
+	must(t, err)
+
+	ri.TWI = &datatrans.TWINT{Alias: "ZGZhc2RmYXNkZmFzZGZhc2Q="}
+	data, err := datatrans.MarshalJSON(ri)
+	must(t, err)
+	if !bytes.Equal(data, wantJSON) {
+		t.Errorf("\nWant: %s\nHave: %s", wantJSON, data)
+	}
+}
+
+func TestClient_DefaultRefNo2(t *testing.T) {
+	var gotBody string
+	c, err := datatrans.MakeClient(
+		datatrans.OptionHTTPRequestFn(func(req *http.Request) (*http.Response, error) {
+			var buf bytes.Buffer
+			buf.ReadFrom(req.Body)
+			gotBody = buf.String()
+			return &http.Response{
+				StatusCode: 200,
+				Body:       ioutil.NopCloser(strings.NewReader(`{}`)),
+			}, nil
+		}),
+		datatrans.OptionMerchant{
+			MerchantID:    "322342",
+			Password:      "sfdgsdfg",
+			DefaultRefNo2: "store-42",
+		},
+	)
+	must(t, err)
+
+	rs := datatrans.RequestSettle{
+		Amount:   1000,
+		Currency: "CHF",
+		RefNo:    "872732",
+	}
+	must(t, c.Settle(context.Background(), "3423423423", rs))
+	if want := `{"amount":1000,"currency":"CHF","refno":"872732","refno2":"store-42"}`; gotBody != want {
+		t.Errorf("\nWant: %s\nHave: %s", want, gotBody)
+	}
+
+	rs.RefNo2 = "store-7"
+	must(t, c.Settle(context.Background(), "3423423423", rs))
+	if want := `{"amount":1000,"currency":"CHF","refno":"872732","refno2":"store-7"}`; gotBody != want {
+		t.Errorf("\nWant: %s\nHave: %s", want, gotBody)
+	}
+}
+
+func TestClient_SettleShipments(t *testing.T) {
+	var gotBodies []string
+	c, err := datatrans.MakeClient(
+		datatrans.OptionStrictValidation(true),
+		datatrans.OptionHTTPRequestFn(func(req *http.Request) (*http.Response, error) {
+			if req.Method == http.MethodGet {
+				return &http.Response{
+					StatusCode: 200,
+					Body:       ioutil.NopCloser(strings.NewReader(`{"status":"settled","detail":{"authorize":{"amount":1000},"settle":{"amount":600}}}`)),
+				}, nil
+			}
+			var buf bytes.Buffer
+			buf.ReadFrom(req.Body)
+			gotBodies = append(gotBodies, buf.String())
+			return &http.Response{StatusCode: 204, Body: ioutil.NopCloser(strings.NewReader(""))}, nil
+		}),
+		datatrans.OptionMerchant{
+			MerchantID:    "322342",
+			Password:      "sfdgsdfg",
+			DefaultRefNo2: "store-42",
+		},
+	)
+	must(t, err)
+
+	rs := datatrans.RequestSettle{Amount: 400, Currency: "CHF", RefNo: "872732", ShipmentRef: "parcel-2"}
+	must(t, c.Settle(context.Background(), "3423423423", rs))
+	if want := []string{`{"amount":400,"currency":"CHF","refno":"872732","refno2":"parcel-2"}`}; !reflect.DeepEqual(gotBodies, want) {
+		t.Errorf("\nWant: %s\nHave: %s", want, gotBodies)
+	}
+
+	rs.Amount = 401
+	err = c.Settle(context.Background(), "3423423423", rs)
+	var ve datatrans.ValidationError
+	if !errors.As(err, &ve) || !strings.Contains(err.Error(), "remaining authorized amount 400") {
+		t.Errorf("expected a validation error, got: %v", err)
+	}
+
+	rs.RefNo2 = "other"
+	if err := rs.Validate(); err == nil {
+		t.Error("expected an error for refno2 combined with shipmentRef")
+	}
+	if len(gotBodies) != 1 {
+		t.Errorf("no further settle expected: %q", gotBodies)
+	}
+}
+
+func TestResponseStatus_Settlements(t *testing.T) {
+	day := time.Date(2021, 2, 15, 0, 0, 0, 0, time.UTC)
+	rs := datatrans.ResponseStatus{History: []datatrans.History{
+		{Action: datatrans.ActionAuthorize, Amount: 1000, Date: datatrans.FlexTime{Time: day}},
+		{Action: datatrans.ActionSettle, Amount: 600, Date: datatrans.FlexTime{Time: day.Add(time.Hour)}, Success: true},
+		{Action: datatrans.ActionSettle, Amount: 400, Date: datatrans.FlexTime{Time: day.Add(2 * time.Hour)}, Success: true},
+	}}
+	list := rs.Settlements()
+	if len(list) != 2 || list[0].Amount != 600 || list[1].Amount != 400 {
+		t.Errorf("invalid settlements: %#v", list)
+	}
+	if list := (datatrans.ResponseStatus{}).Settlements(); list != nil {
+		t.Errorf("expected nil: %#v", list)
+	}
+}
+
+func TestClient_CancelWith(t *testing.T) {
+	var gotBody string
+	c, err := datatrans.MakeClient(
+		datatrans.OptionHTTPRequestFn(mockResponse(t, 204, "", func(t *testing.T, req *http.Request) {
+			if req.URL.Path != "/v1/transactions/3423423423/cancel" {
+				t.Errorf("invalid path: %q", req.URL.Path)
+			}
+			var buf bytes.Buffer
+			buf.ReadFrom(req.Body)
+			gotBody = buf.String()
+		})),
+		datatrans.OptionMerchant{
+			MerchantID: "322342",
+			Password:   "sfdgsdfg",
+		},
+	)
+	must(t, err)
+
+	must(t, c.CancelWith(context.Background(), "3423423423", datatrans.RequestCancel{
+		RefNo:        "872732",
+		RefNo2:       "store-7",
+		CustomFields: datatrans.CustomFields{"reason": "duplicate"},
+	}))
+	if want := `{"reason":"duplicate","refno":"872732","refno2":"store-7"}`; gotBody != want {
+		t.Errorf("\nWant: %s\nHave: %s", want, gotBody)
+	}
+
+	must(t, c.Cancel(context.Background(), "3423423423", "872732"))
+	if want := `{"refno":"872732"}`; gotBody != want {
+		t.Errorf("\nWant: %s\nHave: %s", want, gotBody)
+	}
+
+	if err := c.CancelWith(context.Background(), "3423423423", datatrans.RequestCancel{RefNo2: "store-7"}); err == nil {
+		t.Error("expected a validation error")
+	}
+}
+
+func TestClient_EmptyBody(t *testing.T) {
+	c, err := datatrans.MakeClient(
+		datatrans.OptionHTTPRequestFn(mockResponse(t, 204, "", nil)),
+		datatrans.OptionMerchant{
+			MerchantID: "322342",
+			Password:   "sfdgsdfg",
+		},
+	)
+	must(t, err)
+
+	rcm, err := c.Authorize(context.Background(), datatrans.RequestAuthorize{
+		Amount:   1000,
+		Currency: "CHF",
+		RefNo:    "872732",
+	})
+	must(t, err)
+	if rcm.TransactionId != "" {
+		t.Errorf("invalid response: %#v", rcm)
+	}
+}
+
+func TestClient_DecodeErrorMessages(t *testing.T) {
+	newClient := func(status int) datatrans.Client {
+		c, err := datatrans.MakeClient(
+			datatrans.OptionHTTPRequestFn(mockResponse(t, status, `{"transactionId": 4242424242424242`, nil)),
+			datatrans.OptionMerchant{
+				MerchantID: "322342",
+				Password:   "sfdgsdfg",
+			},
+		)
+		must(t, err)
+		return c
+	}
+
+	c := newClient(200)
+	_, errSuccess := c.Status(context.Background(), "3423423423")
+	c = newClient(500)
+	_, errFailure := c.Status(context.Background(), "3423423423")
+	if errSuccess == nil || errFailure == nil {
+		t.Fatal("expected errors")
+	}
+	if !strings.Contains(errSuccess.Error(), "success response") {
+		t.Errorf("invalid success path message: %s", errSuccess)
+	}
+	if !strings.Contains(errFailure.Error(), "error response with status 500") {
+		t.Errorf("invalid error path message: %s", errFailure)
+	}
+	if strings.Contains(errSuccess.Error(), "4242") || !strings.Contains(errSuccess.Error(), "xxxx") {
+		t.Errorf("body snippet not redacted: %s", errSuccess)
+	}
+}
+
+func TestClient_AliasConvertDetails(t *testing.T) {
+	c, err := datatrans.MakeClient(
+		datatrans.OptionHTTPRequestFn(mockResponse(t, 200, `{"alias":"7LHXscqwAAEAAAGQvYQBwc5zX9vtAHrl","card":{"masked":"424242xxxxxx4242","expiryMonth":"06","expiryYear":"25","info":{"brand":"VISA CREDIT"}}}`, func(t *testing.T, req *http.Request) {
+			var buf bytes.Buffer
+			buf.ReadFrom(req.Body)
+			if want := `{"legacyAlias":"70119122433810042"}`; buf.String() != want {
+				t.Errorf("invalid body: %q", buf.String())
+			}
+		})),
+		datatrans.OptionMerchant{
+			MerchantID: "322342",
+			Password:   "sfdgsdfg",
+		},
+	)
+	must(t, err)
+
+	rac, err := c.AliasConvertDetails(context.Background(), "70119122433810042")
+	must(t, err)
+	if rac.Alias != "7LHXscqwAAEAAAGQvYQBwc5zX9vtAHrl" {
+		t.Errorf("invalid alias: %q", rac.Alias)
+	}
+	if rac.Card == nil || rac.Card.Masked != "424242xxxxxx4242" || rac.Card.ExpiryYear != "25" || rac.Card.Info.Brand != "VISA CREDIT" {
+		t.Errorf("invalid card: %#v", rac.Card)
+	}
+	if len(rac.RawJSONBody) == 0 {
+		t.Error("RawJSONBody not set")
+	}
+}
+
+func TestClient_ExtraHeaders(t *testing.T) {
+	c, err := datatrans.MakeClient(
+		datatrans.OptionHTTPRequestFn(mockResponse(t, 200, `{}`, func(t *testing.T, req *http.Request) {
+			if v := req.Header.Get("X-Gateway-Key"); v != "gw-secret" {
+				t.Errorf("invalid extra header: %q", v)
+			}
+			u, p, _ := req.BasicAuth()
+			if u != "322342" || p != "sfdgsdfg" {
+				t.Error("Authorization header has been overwritten")
+			}
+			if v := req.Header.Get("Content-Type"); v != "application/json" {
+				t.Errorf("Content-Type header has been overwritten: %q", v)
+			}
+		})),
+		datatrans.OptionMerchant{
+			MerchantID: "322342",
+			Password:   "sfdgsdfg",
+			ExtraHeaders: map[string]string{
+				"X-Gateway-Key": "gw-secret",
+				"authorization": "Bearer evil",
+				"Content-Type":  "text/plain",
+			},
+		},
+	)
+	must(t, err)
+
+	must(t, c.Cancel(context.Background(), "3423423423", "872732"))
+}
+
+func TestClient_ReauthorizeByAlias(t *testing.T) {
+	c, err := datatrans.MakeClient(
+		datatrans.OptionHTTPRequestFn(mockResponse(t, 200, `{"transactionId":"210215103042148501"}`, func(t *testing.T, req *http.Request) {
+			var buf bytes.Buffer
+			buf.ReadFrom(req.Body)
+			const wantBody = `{"amount":1000,"currency":"CHF","refno":"872732","card":{"alias":"7LHXscqwAAEAAAGQvYQBwc5zX9vtAHrl","expiryMonth":"06","expiryYear":"25"}}`
+			if buf.String() != wantBody {
+				t.Errorf("invalid body: %q", buf.String())
+			}
+		})),
+		datatrans.OptionMerchant{
+			MerchantID: "322342",
+			Password:   "sfdgsdfg",
+		},
+	)
+	must(t, err)
+
+	ra := datatrans.RequestAuthorize{
+		Amount:   1000,
+		Currency: "CHF",
+		RefNo:    "872732",
+		Card:     &datatrans.Card{ExpiryMonth: "06", ExpiryYear: "25"},
+	}
+	if _, err := c.ReauthorizeByAlias(context.Background(), "", ra); err == nil {
+		t.Error("expected an error for an empty alias")
+	}
+	_, err = c.ReauthorizeByAlias(context.Background(), "7LHXscqwAAEAAAGQvYQBwc5zX9vtAHrl", ra)
+	must(t, err)
+	if ra.Card.Alias != "" {
+		t.Error("card of the request has been modified")
+	}
+}
+
+func TestMarshalJSON_AutoSettleExplicit(t *testing.T) {
+	ra := datatrans.RequestAuthorize{
+		Amount:             1000,
+		Currency:           "CHF",
+		RefNo:              "872732",
+		AutoSettleExplicit: datatrans.Bool(false),
+	}
+	data, err := datatrans.MarshalJSON(ra)
+	must(t, err)
+	const wantJSON = `{"amount":1000,"autoSettle":false,"currency":"CHF","refno":"872732"}`
+	if string(data) != wantJSON {
+		t.Errorf("\nWant: %s\nHave: %s", wantJSON, data)
+	}
+
+	ra.AutoSettleExplicit = nil
+	data, err = datatrans.MarshalJSON(ra)
+	must(t, err)
+	const wantJSONOmitted = `{"amount":1000,"currency":"CHF","refno":"872732"}`
+	if string(data) != wantJSONOmitted {
+		t.Errorf("\nWant: %s\nHave: %s", wantJSONOmitted, data)
+	}
+}
+
+func TestClient_ThreeDSContinue(t *testing.T) {
+	c, err := datatrans.MakeClient(
+		datatrans.OptionHTTPRequestFn(mockResponse(t, 200, `{"acquirerAuthorizationCode":"103042"}`, func(t *testing.T, req *http.Request) {
+			if req.URL.Path != "/v1/transactions/210215103042148501/authorize" {
+				t.Errorf("invalid path: %q", req.URL.Path)
+			}
+			var buf bytes.Buffer
+			buf.ReadFrom(req.Body)
+			const wantBody = `{"refno":"872732","amount":1000,"3D":{"eci":"05","cavv":"AAABBBCCC","threeDSTransactionId":"f25084f0-5b16-4c0a-ae5d-b24808a95e4b","authenticationResponse":"Y"}}`
+			if buf.String() != wantBody {
+				t.Errorf("invalid body: %q", buf.String())
+			}
+		})),
+		datatrans.OptionMerchant{
+			MerchantID: "322342",
+			Password:   "sfdgsdfg",
+		},
+	)
+	must(t, err)
+
+	rtc := datatrans.RequestThreeDSContinue{
+		RefNo:  "872732",
+		Amount: 1000,
+		ThreeD: &datatrans.ThreeDSAuthenticationResult{
+			ECI:                    "05",
+			CAVV:                   "AAABBBCCC",
+			ThreeDSTransactionID:   "f25084f0-5b16-4c0a-ae5d-b24808a95e4b",
+			AuthenticationResponse: "Y",
+		},
+	}
+	if _, err := c.ThreeDSContinue(context.Background(), "", rtc); err == nil {
+		t.Error("expected an error for an empty transactionID")
+	}
+	ra, err := c.ThreeDSContinue(context.Background(), "210215103042148501", rtc)
+	must(t, err)
+	if ra.AcquirerAuthorizationCode != "103042" {
+		t.Errorf("invalid response: %#v", ra)
+	}
+}
+
+func TestMarshalJSON_LargeNumbers(t *testing.T) {
+	ri := datatrans.RequestInitialize{
+		Currency: "CHF",
+		RefNo:    "234234",
+		Amount:   2147483647,
+	}
+	ri.SetInt("installments", 9007199254740993) // 2^53+1, not representable as float64
+	ri.SetString("note", "x")
+	ri.CustomFields["decoded"] = float64(1e21)
+
+	data, err := datatrans.MarshalJSON(ri)
+	must(t, err)
+	const wantJSON = `{"amount":2147483647,"currency":"CHF","decoded":1000000000000000000000,"installments":9007199254740993,"note":"x","refno":"234234"}`
+	if string(data) != wantJSON {
+		t.Errorf("\nWant: %s\nHave: %s", wantJSON, data)
+	}
+
+	articles := []interface{}{
+		map[string]interface{}{"id": "1", "price": float64(1.2e9), "quantity": json.Number("2E3")},
+		map[string]interface{}{"id": "2", "price": 19.5, "tags": []interface{}{float64(1e21)}},
+	}
+	ri.CustomFields = datatrans.CustomFields{"order": map[string]interface{}{"articles": articles}}
+	data, err = datatrans.MarshalJSON(ri)
+	must(t, err)
+	const wantNestedJSON = `{"amount":2147483647,"currency":"CHF","order":{"articles":[{"id":"1","price":1200000000,"quantity":2000},{"id":"2","price":19.5,"tags":[1000000000000000000000]}]},"refno":"234234"}`
+	if string(data) != wantNestedJSON {
+		t.Errorf("\nWant: %s\nHave: %s", wantNestedJSON, data)
+	}
+	if articles[0].(map[string]interface{})["price"] != float64(1.2e9) {
+		t.Error("original custom fields must not be modified")
+	}
+}
+
+func TestClient_Close(t *testing.T) {
+	t.Run("default transport", func(t *testing.T) {
+		var hookCalls int
+		c, err := datatrans.MakeClient(
+			datatrans.OptionOnClose(func() error {
+				hookCalls++
+				return nil
+			}),
+			datatrans.OptionMerchant{
+				MerchantID: "322342",
+				Password:   "sfdgsdfg",
+			},
+		)
+		must(t, err)
+		must(t, c.Close())
+		must(t, c.Close())
+		if hookCalls != 1 {
+			t.Errorf("hook should be called once, got %d", hookCalls)
+		}
+	})
+
+	t.Run("custom doFn", func(t *testing.T) {
+		c, err := datatrans.MakeClient(
+			datatrans.OptionHTTPRequestFn(mockResponse(t, 200, `{}`, nil)),
+			datatrans.OptionOnClose(func() error {
+				t.Error("hook must not be called without the default HTTP client")
+				return nil
+			}),
+			datatrans.OptionMerchant{
+				MerchantID: "322342",
+				Password:   "sfdgsdfg",
+			},
+		)
+		must(t, err)
+		must(t, c.Close())
+		must(t, c.WithMerchant("").Close())
+	})
+}
+
+func TestClient_OptionSuccessStatus(t *testing.T) {
+	c, err := datatrans.MakeClient(
+		datatrans.OptionSuccessStatus(func(statusCode int) bool {
+			return statusCode >= 200 && statusCode < 400
+		}),
+		datatrans.OptionHTTPRequestFn(func(req *http.Request) (*http.Response, error) {
+			return &http.Response{
+				StatusCode: http.StatusFound,
+				Header:     http.Header{"Location": []string{"https://pay.sandbox.datatrans.com/v1/start/210215103033478409"}},
+				Body:       ioutil.NopCloser(strings.NewReader(`{"transactionId": "210215103033478409"}`)),
+			}, nil
+		}),
+		datatrans.OptionMerchant{
+			MerchantID: "322342",
+			Password:   "sfdgsdfg",
+		},
+	)
+	must(t, err)
+
+	ri, err := c.Initialize(context.Background(), datatrans.RequestInitialize{
+		Currency: "CHF",
+		RefNo:    "872732",
+		Amount:   1337,
+	})
+	must(t, err)
+	if ri.TransactionId != "210215103033478409" || ri.Location != "https://pay.sandbox.datatrans.com/v1/start/210215103033478409" {
+		t.Errorf("invalid response: %#v", ri)
+	}
+}
+
+func TestClient_VerifyCredentials(t *testing.T) {
+	newClient := func(fn datatrans.OptionHTTPRequestFn) datatrans.Client {
+		c, err := datatrans.MakeClient(
+			fn,
+			datatrans.OptionMerchant{
+				InternalID: "B",
+				MerchantID: "322342",
+				Password:   "sfdgsdfg",
+			},
+		)
+		must(t, err)
+		return c
+	}
+
+	t.Run("authorized", func(t *testing.T) {
+		c := newClient(mockResponse(t, 404, `{"error": {"code": "TRANSACTION_NOT_FOUND"}}`, nil))
+		must(t, c.VerifyCredentials(context.Background(), "B"))
+	})
+
+	t.Run("unauthorized", func(t *testing.T) {
+		c := newClient(mockResponse(t, 401, `{"error": {"code": "UNAUTHORIZED"}}`, nil))
+		if err := c.VerifyCredentials(context.Background(), "B"); !errors.Is(err, datatrans.ErrUnauthorized) {
+			t.Errorf("expected ErrUnauthorized, got: %v", err)
+		}
+	})
+
+	for _, code := range []int{401, 403} {
+		t.Run("empty body "+http.StatusText(code), func(t *testing.T) {
+			c := newClient(mockResponse(t, code, ``, nil))
+			if err := c.VerifyCredentials(context.Background(), "B"); !errors.Is(err, datatrans.ErrUnauthorized) {
+				t.Errorf("expected ErrUnauthorized, got: %v", err)
+			}
+			_, err := c.WithMerchant("B").Status(context.Background(), "3423423423")
+			if !errors.Is(err, datatrans.ErrUnauthorized) {
+				t.Errorf("expected ErrUnauthorized from Status, got: %v", err)
+			}
+		})
+	}
+
+	t.Run("transport error", func(t *testing.T) {
+		errNetwork := errors.New("connection refused")
+		c := newClient(func(req *http.Request) (*http.Response, error) {
+			return nil, errNetwork
+		})
+		err := c.VerifyCredentials(context.Background(), "B")
+		if !errors.Is(err, errNetwork) || errors.Is(err, datatrans.ErrUnauthorized) {
+			t.Errorf("expected the transport error, got: %v", err)
+		}
+	})
+
+	t.Run("unknown merchant", func(t *testing.T) {
+		c := newClient(mockResponse(t, 404, `{}`, nil))
+		if err := c.VerifyCredentials(context.Background(), "X"); err == nil {
+			t.Error("expected an error")
+		}
+	})
+}
+
+func TestClient_SettlePartialAndReleaseRemainder(t *testing.T) {
+	newClient := func(calls *[]string, status datatrans.Status) datatrans.Client {
+		c, err := datatrans.MakeClient(
+			datatrans.OptionHTTPRequestFn(func(req *http.Request) (*http.Response, error) {
+				*calls = append(*calls, req.Method+" "+req.URL.Path)
+				resp := &http.Response{
+					StatusCode: 204,
+					Body:       ioutil.NopCloser(strings.NewReader("")),
+				}
+				if req.Method == http.MethodGet {
+					resp.StatusCode = 200
+					resp.Body = ioutil.NopCloser(strings.NewReader(`{"transactionId":"210215103042148501","status":"` + string(status) + `","detail":{"authorize":{"amount":1000}}}`))
+				}
+				return resp, nil
+			}),
+			datatrans.OptionMerchant{
+				MerchantID: "322342",
+				Password:   "sfdgsdfg",
+			},
+		)
+		must(t, err)
+		return c
+	}
+
+	t.Run("partial", func(t *testing.T) {
+		var calls []string
+		c := newClient(&calls, datatrans.StatusAuthorized)
+		rsp, err := c.SettlePartialAndReleaseRemainder(context.Background(), "210215103042148501", "872732", "CHF", 600)
+		must(t, err)
+		want := datatrans.ResponseSettlePartial{AuthorizedAmount: 1000, SettledAmount: 600, ReleasedAmount: 400}
+		if *rsp != want {
+			t.Errorf("invalid response: %#v", rsp)
+		}
+		wantCalls := "GET /v1/transactions/210215103042148501,POST /v1/transactions/210215103042148501/settle"
+		if s := strings.Join(calls, ","); s != wantCalls {
+			t.Errorf("invalid calls: %q", s)
+		}
+	})
+
+	t.Run("full", func(t *testing.T) {
+		var calls []string
+		c := newClient(&calls, datatrans.StatusAuthorized)
+		rsp, err := c.SettlePartialAndReleaseRemainder(context.Background(), "210215103042148501", "872732", "CHF", 1000)
+		must(t, err)
+		if rsp.ReleasedAmount != 0 || rsp.SettledAmount != 1000 {
+			t.Errorf("invalid response: %#v", rsp)
+		}
+		if len(calls) != 2 {
+			t.Errorf("invalid calls: %q", calls)
+		}
+	})
+
+	t.Run("not authorized", func(t *testing.T) {
+		var calls []string
+		c := newClient(&calls, datatrans.StatusSettled)
+		if _, err := c.SettlePartialAndReleaseRemainder(context.Background(), "210215103042148501", "872732", "CHF", 600); err == nil {
+			t.Error("expected an error")
+		}
+		if len(calls) != 1 {
+			t.Errorf("settle should not be called: %q", calls)
+		}
+	})
+
+	t.Run("exceeds authorization", func(t *testing.T) {
+		var calls []string
+		c := newClient(&calls, datatrans.StatusAuthorized)
+		if _, err := c.SettlePartialAndReleaseRemainder(context.Background(), "210215103042148501", "872732", "CHF", 1001); err == nil {
+			t.Error("expected an error")
+		}
+		if len(calls) != 1 {
+			t.Errorf("settle should not be called: %q", calls)
+		}
+	})
+
+	t.Run("invalid input", func(t *testing.T) {
+		var calls []string
+		c := newClient(&calls, datatrans.StatusAuthorized)
+		if _, err := c.SettlePartialAndReleaseRemainder(context.Background(), "210215103042148501", "", "CHF", 0); err == nil {
+			t.Error("expected an error")
+		}
+		if len(calls) != 0 {
+			t.Errorf("no request expected: %q", calls)
+		}
+	})
+}
+
+func TestClient_SettlePartialAndReleaseRemainder_Canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var calls []string
+	c, err := datatrans.MakeClient(
+		datatrans.OptionHTTPRequestFn(func(req *http.Request) (*http.Response, error) {
+			calls = append(calls, req.Method+" "+req.URL.Path)
+			cancel()
+			return &http.Response{
+				StatusCode: 200,
+				Body:       ioutil.NopCloser(strings.NewReader(`{"status":"authorized","detail":{"authorize":{"amount":1000}}}`)),
+			}, nil
+		}),
+		datatrans.OptionMerchant{
+			MerchantID: "322342",
+			Password:   "sfdgsdfg",
+		},
+	)
+	must(t, err)
+
+	rsp, err := c.SettlePartialAndReleaseRemainder(ctx, "210215103042148501", "872732", "CHF", 600)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got: %v", err)
+	}
+	if rsp != nil || len(calls) != 1 {
+		t.Errorf("settle should not be called: %q %#v", calls, rsp)
+	}
+}
+
+func TestClient_DoesNotMutateRequest(t *testing.T) {
+	c, err := datatrans.MakeClient(
+		datatrans.OptionStrictValidation(true),
+		datatrans.OptionHTTPRequestFn(mockResponse(t, 201, `{"transactionId":"210215103033478409"}`, nil)),
+		datatrans.OptionMerchant{
+			DefaultRefNo2: "store-1",
+			MerchantID:    "322342",
+			Password:      "sfdgsdfg",
+		},
+	)
+	must(t, err)
+
+	ri := datatrans.RequestInitialize{
+		Currency:     "CHF",
+		RefNo:        "872732",
+		Amount:       1337,
+		Customer:     &datatrans.Customer{Gender: "M"},
+		TWI:          &datatrans.TWINT{Alias: "abc"},
+		CustomFields: datatrans.CustomFields{"nested": map[string]interface{}{"a": 1}},
+	}
+	want := ri.Clone()
+
+	_, err = c.Initialize(context.Background(), ri)
+	must(t, err)
+	if !reflect.DeepEqual(ri, want) {
+		t.Errorf("request has been modified\nWant: %#v\nHave: %#v", want, ri)
+	}
+}
+
+func TestRequestInitialize_Clone(t *testing.T) {
+	ri := datatrans.RequestInitialize{
+		PaymentMethods: []string{datatrans.PaymentMethodVIS},
+		Card:           &datatrans.Card{ThreeD: datatrans.ThreeD{Cardholder: &datatrans.Cardholder{Email: "a@b.c"}}},
+		CustomFields:   datatrans.CustomFields{"nested": map[string]interface{}{"a": 1}},
+	}
+	cl := ri.Clone()
+	cl.PaymentMethods[0] = datatrans.PaymentMethodECA
+	cl.Card.ThreeD.Cardholder.Email = "x@y.z"
+	cl.CustomFields["nested"].(map[string]interface{})["a"] = 2
+	cl.CustomFields.SetString("b", "c")
+
+	if ri.PaymentMethods[0] != datatrans.PaymentMethodVIS || ri.Card.ThreeD.Cardholder.Email != "a@b.c" ||
+		ri.CustomFields["nested"].(map[string]interface{})["a"] != 1 || len(ri.CustomFields) != 1 {
+		t.Errorf("original modified: %#v", ri)
+	}
+}
+
+func TestOptionStrictDecode(t *testing.T) {
+	const body = `{"transactionId":"210215103042148501","status":"authorized","newField":true}`
+	for _, strict := range []bool{false, true} {
+		c, err := datatrans.MakeClient(
+			datatrans.OptionStrictDecode(strict),
+			datatrans.OptionHTTPRequestFn(mockResponse(t, 200, body, nil)),
+			datatrans.OptionMerchant{
+				MerchantID: "322342",
+				Password:   "sfdgsdfg",
+			},
+		)
+		must(t, err)
+
+		rs, err := c.Status(context.Background(), "210215103042148501")
+		if strict {
+			if err == nil || !strings.Contains(err.Error(), `unknown field "newField"`) {
+				t.Errorf("expected an unknown field error, got: %v", err)
+			}
+			continue
+		}
+		must(t, err)
+		if rs.Status != datatrans.StatusAuthorized {
+			t.Errorf("invalid status: %q", rs.Status)
+		}
+	}
+}
+
+func TestClient_DoRequest(t *testing.T) {
+	status, respBody := 200, `{"id":"42","state":"active"}`
+	var gotBody string
+	c, err := datatrans.MakeClient(
+		datatrans.OptionHTTPRequestFn(func(req *http.Request) (*http.Response, error) {
+			if req.Method != http.MethodPost || req.URL.String() != "https://api.sandbox.datatrans.com/v1/made-up/42" {
+				t.Errorf("invalid request: %s %s", req.Method, req.URL)
+			}
+			if u, p, ok := req.BasicAuth(); !ok || u != "322342" || p != "sfdgsdfg" {
+				t.Error("missing basic auth")
+			}
+			if req.Header.Get("Idempotency-Key") == "" {
+				t.Error("missing Idempotency-Key")
+			}
+			body, _ := ioutil.ReadAll(req.Body)
+			gotBody = string(body)
+			return &http.Response{
+				StatusCode: status,
+				Body:       ioutil.NopCloser(strings.NewReader(respBody)),
+			}, nil
+		}),
+		datatrans.OptionMerchant{
+			EnableIdempotency: true,
+			MerchantID:        "322342",
+			Password:          "sfdgsdfg",
+		},
+	)
+	must(t, err)
+
+	type madeUp struct {
+		State                  string `json:"state"`
+		datatrans.CustomFields `json:"-"`
+	}
+	var out struct {
+		ID    string `json:"id"`
+		State string `json:"state"`
+		datatrans.RawJSONBody
+	}
+	must(t, c.DoRequest(context.Background(), http.MethodPost, "/v1/made-up/42", madeUp{State: "active", CustomFields: datatrans.CustomFields{"note": "x"}}, &out))
+	if want := `{"note":"x","state":"active"}`; gotBody != want {
+		t.Errorf("\nWant: %s\nHave: %s", want, gotBody)
+	}
+	if out.ID != "42" || out.State != "active" || string(out.RawJSONBody) != respBody {
+		t.Errorf("invalid response: %#v", out)
+	}
+
+	status, respBody = 400, `{"error":{"code":"INVALID_PROPERTY","message":"state"}}`
+	err = c.DoRequest(context.Background(), http.MethodPost, "/v1/made-up/42", madeUp{State: "paused"}, nil)
+	var errResp datatrans.ErrorResponse
+	if !errors.As(err, &errResp) || errResp.ErrorDetail.Code != datatrans.ErrCodeInvalidProperty {
+		t.Errorf("expected an ErrorResponse, got: %v", err)
+	}
+
+	if err := c.DoRequest(context.Background(), http.MethodGet, "v1/made-up", nil, nil); err == nil {
+		t.Error("expected an error for a relative path")
+	}
+}
+
+func TestOptionOperationTimeouts(t *testing.T) {
+	deadlines := map[string]time.Duration{}
+	c, err := datatrans.MakeClient(
+		datatrans.OptionOperationTimeouts{
+			"status":                   2 * time.Second,
+			"reconciliationsSalesBulk": 5 * time.Minute,
+		},
+		datatrans.OptionHTTPRequestFn(func(req *http.Request) (*http.Response, error) {
+			if dl, ok := req.Context().Deadline(); ok {
+				deadlines[req.URL.Path] = time.Until(dl)
+			} else {
+				deadlines[req.URL.Path] = 0
+			}
+			return &http.Response{StatusCode: 200, Body: ioutil.NopCloser(strings.NewReader(`{}`))}, nil
+		}),
+		datatrans.OptionMerchant{
+			MerchantID: "322342",
+			Password:   "sfdgsdfg",
+		},
+	)
+	must(t, err)
+
+	_, err = c.Status(context.Background(), "210215103042148501")
+	must(t, err)
+	if d := deadlines["/v1/transactions/210215103042148501"]; d <= 0 || d > 2*time.Second {
+		t.Errorf("status: want the short default deadline, have %s", d)
+	}
+
+	_, err = c.ReconciliationsSalesBulk(context.Background(), datatrans.RequestReconciliationsSales{
+		Sales: []datatrans.RequestReconciliationsSale{{TransactionID: "210215103042148501"}},
+	})
+	must(t, err)
+	if d := deadlines["/v1/reconciliations/sales/bulk"]; d <= 2*time.Second || d > 5*time.Minute {
+		t.Errorf("bulk: want the long default deadline, have %s", d)
+	}
+
+	must(t, c.Cancel(context.Background(), "210215103042148501", "872732"))
+	if d := deadlines["/v1/transactions/210215103042148501/cancel"]; d != 0 {
+		t.Errorf("cancel: want no deadline, have %s", d)
+	}
+
+	// the deadline of the caller wins, even if it is longer
+	ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+	_, err = c.Status(ctx, "210215103042148501")
+	must(t, err)
+	if d := deadlines["/v1/transactions/210215103042148501"]; d <= 5*time.Minute {
+		t.Errorf("status: want the caller deadline, have %s", d)
+	}
+
+	if _, err := datatrans.MakeClient(datatrans.OptionOperationTimeouts{"status": 0}); err == nil {
+		t.Error("expected an error for a zero timeout")
+	}
+}
+
+func TestOptionAcceptLanguage(t *testing.T) {
+	var header string
+	newClient := func(opts ...datatrans.Option) datatrans.Client {
+		c, err := datatrans.MakeClient(append(opts,
+			datatrans.OptionHTTPRequestFn(mockResponse(t, 201, `{"transactionId":"210215103033478409"}`, func(t *testing.T, req *http.Request) {
+				header = req.Header.Get("Accept-Language")
+			})),
+			datatrans.OptionMerchant{
+				MerchantID: "322342",
+				Password:   "sfdgsdfg",
+			},
+		)...)
+		must(t, err)
+		return c
+	}
+	ri := datatrans.RequestInitialize{Currency: "CHF", RefNo: "872732", Amount: 1337, Language: "fr"}
+
+	c := newClient(datatrans.OptionAcceptLanguage(true))
+	_, err := c.Initialize(context.Background(), ri)
+	must(t, err)
+	if header != "fr" {
+		t.Errorf("want Accept-Language fr, have %q", header)
+	}
+
+	ri.Language = "fr-CH"
+	if _, err := c.Initialize(context.Background(), ri); err == nil || !strings.Contains(err.Error(), `unsupported language "fr-CH"`) {
+		t.Errorf("expected an unsupported language error, got: %v", err)
+	}
+
+	header = ""
+	ri.Language = "de"
+	c = newClient()
+	_, err = c.Initialize(context.Background(), ri)
+	must(t, err)
+	if header != "" {
+		t.Errorf("want no Accept-Language without the option, have %q", header)
+	}
+}
+
+func TestOptionInterceptor(t *testing.T) {
+	var calls []string
+	var statuses []int
+	c, err := datatrans.MakeClient(
+		datatrans.OptionInterceptor(func(next datatrans.RoundTripFunc) datatrans.RoundTripFunc {
+			return func(req *http.Request) (*http.Response, error) {
+				calls = append(calls, "header")
+				req.Header.Set("X-Trace-Id", "4711")
+				return next(req)
+			}
+		}),
+		datatrans.OptionInterceptor(func(next datatrans.RoundTripFunc) datatrans.RoundTripFunc {
+			return func(req *http.Request) (*http.Response, error) {
+				calls = append(calls, "status")
+				resp, err := next(req)
+				if resp != nil {
+					statuses = append(statuses, resp.StatusCode)
+				}
+				return resp, err
+			}
+		}),
+		datatrans.OptionHTTPRequestFn(mockResponse(t, 200, "testdata/status_response.json", func(t *testing.T, req *http.Request) {
+			calls = append(calls, "send")
+			if h := req.Header.Get("X-Trace-Id"); h != "4711" {
+				t.Errorf("invalid X-Trace-Id: %q", h)
+			}
+			if _, _, ok := req.BasicAuth(); !ok {
+				t.Error("request must be authenticated")
+			}
+		})),
+		datatrans.OptionMerchant{
+			MerchantID: "322342",
+			Password:   "sfdgsdfg",
+		},
+	)
+	must(t, err)
+
+	rs, err := c.Status(context.Background(), "210215103042148501")
+	must(t, err)
+	if rs.TransactionID != "210215103042148501" {
+		t.Errorf("incorrect TransactionID:%q", rs.TransactionID)
+	}
+	if want := []string{"header", "status", "send"}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("want calls %v, have %v", want, calls)
+	}
+	if want := []int{200}; !reflect.DeepEqual(statuses, want) {
+		t.Errorf("want statuses %v, have %v", want, statuses)
+	}
+
+	_, err = datatrans.MakeClient(
+		datatrans.OptionInterceptor(func(next datatrans.RoundTripFunc) datatrans.RoundTripFunc { return nil }),
+		datatrans.OptionMerchant{MerchantID: "322342", Password: "sfdgsdfg"},
+	)
+	if err == nil {
+		t.Error("expected an error for a nil RoundTripFunc")
+	}
+}
@@ -0,0 +1,38 @@
+package datatrans
+
+import (
+	"context"
+	"time"
+)
+
+// clock abstracts time for retries, backoff, the idempotency key TTL and the
+// expiry of bearer tokens so that tests can run without real waiting.
+type clock interface {
+	Now() time.Time
+	// Sleep waits for d or until ctx is done.
+	Sleep(ctx context.Context, d time.Duration) error
+}
+
+// realClock uses the wall clock.
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+func (realClock) Sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// optionClock replaces the wall clock, only used in tests.
+type optionClock struct{ clock }
+
+func (o optionClock) apply(c *Client) error {
+	c.clock = o.clock
+	return nil
+}
@@ -0,0 +1,95 @@
+package datatrans
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock advances its time only on Sleep or Advance.
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	sleeps []time.Duration
+}
+
+func newFakeClock(now time.Time) *fakeClock { return &fakeClock{now: now} }
+
+func (fc *fakeClock) Now() time.Time {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	return fc.now
+}
+
+func (fc *fakeClock) Sleep(ctx context.Context, d time.Duration) error {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	fc.sleeps = append(fc.sleeps, d)
+	fc.now = fc.now.Add(d)
+	return ctx.Err()
+}
+
+func (fc *fakeClock) Advance(d time.Duration) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	fc.now = fc.now.Add(d)
+}
+
+func TestFakeClock_RetryTiming(t *testing.T) {
+	start := time.Now()
+	fc := newFakeClock(start)
+	c, calls := retryClient(t, fc, OptionRetry{MaxAttempts: 4, BaseDelay: time.Minute, MaxDelay: time.Hour, Jitter: NoJitter}, true,
+		testResponse(503, ""), testResponse(503, ""), testResponse(503, ""), testResponse(204, ""))
+
+	// 1m + 2m: the third attempt still uses the idempotency key within its
+	// TTL of 3m, the fourth after 7m would not.
+	err := c.Cancel(context.Background(), "210215103042148501", "872732")
+	if !errors.Is(err, ErrIdempotencyExpired) {
+		t.Fatalf("expected ErrIdempotencyExpired, got: %v", err)
+	}
+	if *calls != 3 {
+		t.Errorf("invalid number of calls: %d", *calls)
+	}
+	if elapsed := fc.Now().Sub(start); elapsed != 7*time.Minute {
+		t.Errorf("fake clock should have advanced by 7m, advanced %s", elapsed)
+	}
+	if wall := time.Since(start); wall > 5*time.Second {
+		t.Errorf("test should not wait for real: %s", wall)
+	}
+}
+
+func TestFakeClock_BearerRefresh(t *testing.T) {
+	fc := newFakeClock(time.Date(2021, 2, 15, 10, 0, 0, 0, time.UTC))
+	var fetched int
+	bearer := NewBearerAuth(func(ctx context.Context) (string, time.Time, error) {
+		fetched++
+		return "token", fc.Now().Add(time.Hour), nil
+	})
+	_, err := MakeClient(
+		optionClock{fc},
+		OptionMerchant{Authenticator: bearer},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token := func() {
+		t.Helper()
+		if _, err := bearer.Token(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	token()
+	fc.Advance(time.Hour - bearerRefreshMargin - time.Second)
+	token()
+	if fetched != 1 {
+		t.Errorf("token should be reused before the refresh margin, fetched %d times", fetched)
+	}
+	fc.Advance(time.Second)
+	token()
+	if fetched != 2 {
+		t.Errorf("token should be refreshed within the refresh margin, fetched %d times", fetched)
+	}
+}
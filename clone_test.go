@@ -0,0 +1,26 @@
+package datatrans_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/globusdigital/datatrans"
+)
+
+func TestRequestInitialize_CloneUnexportedFields(t *testing.T) {
+	at := time.Date(2021, 2, 15, 10, 30, 42, 0, time.UTC)
+	ri := datatrans.RequestInitialize{
+		CustomFields: datatrans.CustomFields{
+			"at":     at,
+			"nested": map[string]interface{}{"at": &at},
+		},
+	}
+	cl := ri.Clone()
+	if have := cl.CustomFields["at"].(time.Time); !have.Equal(at) {
+		t.Errorf("invalid time: %s", have)
+	}
+	p := cl.CustomFields["nested"].(map[string]interface{})["at"].(*time.Time)
+	if !p.Equal(at) || p == &at {
+		t.Errorf("invalid pointer copy: %v", p)
+	}
+}
@@ -0,0 +1,50 @@
+package datatrans_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/globusdigital/datatrans"
+)
+
+func TestValidAlpha2(t *testing.T) {
+	for _, code := range []string{"CH", "DE", "LI", "US"} {
+		if !datatrans.ValidAlpha2(code) {
+			t.Errorf("%q should be valid", code)
+		}
+	}
+	for _, code := range []string{"", "ch", "XY", "CHE", "756"} {
+		if datatrans.ValidAlpha2(code) {
+			t.Errorf("%q should be invalid", code)
+		}
+	}
+}
+
+func TestValidNumericCountry(t *testing.T) {
+	for _, code := range []string{"756", "276", "438", "840"} {
+		if !datatrans.ValidNumericCountry(code) {
+			t.Errorf("%q should be valid", code)
+		}
+	}
+	for _, code := range []string{"", "75", "999", "0756", "CH"} {
+		if datatrans.ValidNumericCountry(code) {
+			t.Errorf("%q should be invalid", code)
+		}
+	}
+	if n, ok := datatrans.CountryNumeric("CH"); !ok || n != "756" {
+		t.Errorf("invalid numeric code for CH: %q %t", n, ok)
+	}
+}
+
+func TestCountryValidation(t *testing.T) {
+	must(t, datatrans.Customer{Country: "CH"}.Validate())
+	if have := fmt.Sprint(datatrans.Customer{Country: "SZ "}.Validate()); have != "Customer: country must be an ISO 3166-1 alpha-2 code" {
+		t.Errorf("invalid error: %q", have)
+	}
+
+	must(t, datatrans.Cardholder{BillAddrCountry: "756", ShipAddrCountry: "276"}.Validate())
+	have := fmt.Sprint(datatrans.Cardholder{BillAddrCountry: "CH", ShipAddrCountry: "757"}.Validate())
+	if have != "Cardholder: billAddrCountry must be an ISO 3166-1 numeric code, shipAddrCountry must be an ISO 3166-1 numeric code" {
+		t.Errorf("invalid error: %q", have)
+	}
+}
@@ -0,0 +1,53 @@
+// Package datatranstest provides utilities for testing code which uses the
+// datatrans package.
+package datatranstest
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/globusdigital/datatrans"
+)
+
+// SendTestWebhook sends a correctly signed webhook request to the handler and
+// returns the recorded response. The status, e.g. datatrans.StatusSettled,
+// overwrites body.Status if not empty. key is the hex encoded Sign2HMACKey as
+// used in datatrans.WebhookOption.
+func SendTestWebhook(t testing.TB, handler http.Handler, status datatrans.Status, key string, body datatrans.ResponseStatus) *httptest.ResponseRecorder {
+	t.Helper()
+
+	if status != "" {
+		body.Status = status
+	}
+	body.RawJSONBody = nil
+	data, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("failed to marshal webhook body: %s", err)
+	}
+	sign2Key, err := hex.DecodeString(key)
+	if err != nil {
+		t.Fatalf("failed to hex decode key: %s", err)
+	}
+
+	tm := strconv.FormatInt(time.Now().UnixNano()/int64(time.Millisecond), 10)
+	ht := hmac.New(sha256.New, sign2Key)
+	ht.Write([]byte(tm))
+	ht.Write(data)
+
+	r := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(data))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("Datatrans-Signature", fmt.Sprintf("t=%s,s0=%x", tm, ht.Sum(nil)))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
@@ -0,0 +1,42 @@
+package datatranstest_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/globusdigital/datatrans"
+	"github.com/globusdigital/datatrans/datatranstest"
+)
+
+func TestSendTestWebhook(t *testing.T) {
+	const key = "617364666173645e25405e26256661"
+
+	mw, err := datatrans.ValidateWebhook(datatrans.WebhookOption{
+		Sign2HMACKey: key,
+		ParseStatus:  true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		wh, _ := datatrans.WebhookFromContext(r.Context())
+		if !wh.Status.IsSettled() {
+			http.Error(w, "not settled", http.StatusBadRequest)
+			return
+		}
+		fmt.Fprintf(w, "settled %s", wh.Status.TransactionID)
+	}))
+
+	w := datatranstest.SendTestWebhook(t, handler, datatrans.StatusSettled, key, datatrans.ResponseStatus{
+		TransactionID: "210215103042148501",
+		Currency:      "CHF",
+		PaymentMethod: datatrans.PaymentMethodVIS,
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("invalid status code %d: %s", w.Code, w.Body.String())
+	}
+	if w.Body.String() != "settled 210215103042148501" {
+		t.Errorf("invalid body: %q", w.Body.String())
+	}
+}
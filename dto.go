@@ -1,6 +1,7 @@
 package datatrans
 
 import (
+	"strings"
 	"time"
 )
 
@@ -11,14 +12,85 @@ type customFieldsGetter interface {
 }
 
 // CustomFields allows to extend any input with merchant specific settings.
+// Numbers of type float64, e.g. from decoded JSON, lose precision above 2^53,
+// prefer SetInt or json.Number for integers.
 type CustomFields map[string]interface{}
 
 func (cf CustomFields) getCustomFields() map[string]interface{} { return cf }
 
+// SetInt sets an integer custom field.
+func (cf *CustomFields) SetInt(key string, v int64) {
+	cf.set(key, v)
+}
+
+// SetString sets a string custom field.
+func (cf *CustomFields) SetString(key string, v string) {
+	cf.set(key, v)
+}
+
+func (cf *CustomFields) set(key string, v interface{}) {
+	if *cf == nil {
+		*cf = CustomFields{}
+	}
+	(*cf)[key] = v
+}
+
+// merge merges typed fields which get sent like custom fields, see
+// RequestInitialize.TWI. Keys set in CustomFields take precedence. cf belongs
+// to the caller and must never be modified, fields gets modified instead.
+func (cf CustomFields) merge(fields map[string]interface{}) map[string]interface{} {
+	if len(fields) == 0 {
+		return cf
+	}
+	for k, v := range cf {
+		fields[k] = v
+	}
+	return fields
+}
+
+// typedCustomFields collects the typed fields which cannot be expressed with
+// plain struct tags.
+func typedCustomFields(twi *TWINT, autoSettleExplicit *bool, items []LineItem) map[string]interface{} {
+	m := map[string]interface{}{}
+	if twi != nil {
+		m["twi"] = twi
+	}
+	if len(items) > 0 {
+		m["order"] = order{Articles: items}
+	}
+	if autoSettleExplicit != nil {
+		m["autoSettle"] = *autoSettleExplicit
+	}
+	return m
+}
+
+// Bool returns a pointer to b, e.g. for AutoSettleExplicit.
+func Bool(b bool) *bool { return &b }
+
+type amountGetter interface {
+	getAmount() int
+}
+
+// refNo2Defaulter returns a copy of the request with RefNo2 set to def in case
+// RefNo2 is empty.
+type refNo2Defaulter interface {
+	withDefaultRefNo2(def string) interface{}
+}
+
 type rawJSONBodySetter interface {
 	setJSONRawBody([]byte)
 }
 
+// languageGetter returns the language of a request for OptionAcceptLanguage.
+type languageGetter interface {
+	getLanguage() string
+}
+
+// locationSetter receives the Location header of a success response.
+type locationSetter interface {
+	setLocation(string)
+}
+
 // RawJSONBody includes the original response from the datatrans server. There
 // might be custom fields in the response which are not included in the structs
 // in this package. This type allows for unmarshaling into custom structs.
@@ -28,6 +100,60 @@ func (b *RawJSONBody) setJSONRawBody(p []byte) {
 	*b = p
 }
 
+// PaymentMethod identifies a payment method of datatrans in the merchant
+// configuration, e.g. "VIS". The PaymentMethod constants are untyped and can
+// be used for it as well as for the string fields of the requests and
+// responses.
+type PaymentMethod string
+
+// Payment method identifiers as used in RequestInitialize.PaymentMethods and
+// ResponseStatus.PaymentMethod.
+const (
+	PaymentMethodVIS = "VIS" // Visa
+	PaymentMethodECA = "ECA" // Mastercard
+	PaymentMethodAMX = "AMX" // American Express
+	PaymentMethodDIN = "DIN" // Diners Club
+	PaymentMethodDIS = "DIS" // Discover
+	PaymentMethodJCB = "JCB" // JCB
+	PaymentMethodCUP = "CUP" // UnionPay
+	PaymentMethodMAU = "MAU" // Maestro
+	PaymentMethodPFC = "PFC" // PostFinance Card
+	PaymentMethodPEF = "PEF" // PostFinance E-Finance
+	PaymentMethodTWI = "TWI" // TWINT
+	PaymentMethodPAP = "PAP" // PayPal
+	PaymentMethodKLN = "KLN" // Klarna
+	PaymentMethodAPL = "APL" // Apple Pay
+	PaymentMethodPAY = "PAY" // Google Pay
+	PaymentMethodSAM = "SAM" // Samsung Pay
+	PaymentMethodDII = "DII" // iDEAL
+	PaymentMethodELV = "ELV" // SEPA direct debit
+	PaymentMethodREK = "REK" // Reka
+)
+
+// Valid reports whether pm is one of the PaymentMethod constants. Use a plain
+// string conversion for payment methods which are not listed yet.
+func (pm PaymentMethod) Valid() bool {
+	switch pm {
+	case PaymentMethodVIS, PaymentMethodECA, PaymentMethodAMX, PaymentMethodDIN,
+		PaymentMethodDIS, PaymentMethodJCB, PaymentMethodCUP, PaymentMethodMAU,
+		PaymentMethodPFC, PaymentMethodPEF, PaymentMethodTWI, PaymentMethodPAP,
+		PaymentMethodKLN, PaymentMethodAPL, PaymentMethodPAY, PaymentMethodSAM,
+		PaymentMethodDII, PaymentMethodELV, PaymentMethodREK:
+		return true
+	}
+	return false
+}
+
+// ValidLanguage reports whether lang is one of the languages supported by the
+// payment pages, see RequestInitialize.Language.
+func ValidLanguage(lang string) bool {
+	switch lang {
+	case "en", "de", "fr", "it", "es", "el", "no", "da", "pl", "pt", "ru", "ja":
+		return true
+	}
+	return false
+}
+
 // https://api-reference.datatrans.ch/#operation/secureFieldsInit
 type RequestSecureFieldsInit struct {
 	Currency     string `json:"currency"`
@@ -36,6 +162,8 @@ type RequestSecureFieldsInit struct {
 	CustomFields `json:"-"`
 }
 
+func (r RequestSecureFieldsInit) getAmount() int { return r.Amount }
+
 // https://api-reference.datatrans.ch/#operation/secure-fields-update
 type RequestSecureFieldsUpdate struct {
 	Currency     string `json:"currency"`
@@ -43,6 +171,15 @@ type RequestSecureFieldsUpdate struct {
 	CustomFields `json:"-"`
 }
 
+func (r RequestSecureFieldsUpdate) getAmount() int { return r.Amount }
+
+// Boolean fields use omitempty if datatrans defaults to false, so sending false
+// and omitting the field have the same effect. Fields where an explicit false
+// differs from the default, like autoSettle which can be enabled per merchant
+// in the datatrans settings, additionally provide a *bool variant with the
+// suffix Explicit which is always sent if not nil and overrides the plain
+// field. The booleans of InitializeOption are always sent.
+
 // https://api-reference.datatrans.ch/#operation/init
 type RequestInitialize struct {
 	Currency       string            `json:"currency"`
@@ -52,31 +189,112 @@ type RequestInitialize struct {
 	Customer       *Customer         `json:"customer,omitempty"`
 	Card           *Card             `json:"card,omitempty"`
 	Amount         int               `json:"amount,omitempty"`
-	Language       string            `json:"language,omitempty"` // Enum: "en" "de" "fr" "it" "es" "el" "no" "da" "pl" "pt" "ru" "ja"
+	Language       string            `json:"language,omitempty"` // Enum: "en" "de" "fr" "it" "es" "el" "no" "da" "pl" "pt" "ru" "ja", see ValidLanguage
 	PaymentMethods []string          `json:"paymentMethods,omitempty"`
 	Theme          *Theme            `json:"theme,omitempty"`
 	Redirect       *Redirect         `json:"redirect,omitempty"`
 	Option         *InitializeOption `json:"option,omitempty"`
-	CustomFields   `json:"-"`
+	APL            *ApplePay         `json:"APL,omitempty"`
+	PAY            *GooglePay        `json:"PAY,omitempty"`
+	PAP            *PayPal           `json:"PAP,omitempty"`
+	KLN            *Klarna           `json:"KLN,omitempty"`
+	TWI            *TWINT            `json:"-"` // merged like CustomFields under the key twi
+	// Items contains the cart, required by buy now pay later methods like
+	// KLN. Merged like CustomFields under the key order.articles.
+	Items []LineItem `json:"-"`
+	// AutoSettleExplicit overrides AutoSettle and is also sent when false.
+	AutoSettleExplicit *bool `json:"-"`
+	CustomFields       `json:"-"`
+}
+
+func (r RequestInitialize) getCustomFields() map[string]interface{} {
+	return r.CustomFields.merge(typedCustomFields(r.TWI, r.AutoSettleExplicit, r.Items))
+}
+
+func (r RequestInitialize) getAmount() int { return r.Amount }
+
+func (r RequestInitialize) getLanguage() string { return r.Language }
+
+func (r RequestInitialize) withDefaultRefNo2(def string) interface{} {
+	if r.RefNo2 == "" {
+		r.RefNo2 = def
+	}
+	return r
 }
 
 type ResponseInitialize struct {
 	Location      string `json:"location,omitempty"` // A URL where the users browser needs to be redirect to complete the payment. This redirect is only needed when using Redirect Mode. For Lightbox Mode the returned transactionId can be used to start the payment page.
 	TransactionId string `json:"transactionId,omitempty"`
 	MobileToken   string `json:"mobileToken,omitempty"`
-	RawJSONBody   `json:"raw,omitempty"`
+	// Expires tells when the initialized transaction and therefore the
+	// MobileToken expire. It is only set if the response contains it, otherwise
+	// use Detail.Init.Expires of a follow-up Status.
+	Expires     FlexTime `json:"expires,omitempty"`
+	RawJSONBody `json:"raw,omitempty"`
 }
 
+func (ri *ResponseInitialize) setLocation(loc string) { ri.Location = loc }
+
 type RequestAuthorize struct {
-	Amount     int    `json:"amount,omitempty"`
-	Currency   string `json:"currency,omitempty"`
-	RefNo      string `json:"refno,omitempty"`
-	RefNo2     string `json:"refno2,omitempty"`
-	AutoSettle bool   `json:"autoSettle,omitempty"`
+	Amount   int    `json:"amount,omitempty"`
+	Currency string `json:"currency,omitempty"`
+	RefNo    string `json:"refno,omitempty"`
+	RefNo2   string `json:"refno2,omitempty"`
+	// AutoSettle settles the transaction directly after the authorization, no
+	// separate call to Settle is needed. See Client.AuthorizeAndSettle.
+	AutoSettle bool `json:"autoSettle,omitempty"`
 	// The card object to be submitted when authorizing with an existing credit
 	// card alias.
-	Card         *Card `json:"card,omitempty"`
-	CustomFields `json:"-"`
+	Card *Card `json:"card,omitempty"`
+	// The wallet payment token as received from the device. Only one of Card,
+	// APL and PAY can be set.
+	APL *ApplePay  `json:"APL,omitempty"`
+	PAY *GooglePay `json:"PAY,omitempty"`
+	// Payment method specific parameters.
+	PAP *PayPal `json:"PAP,omitempty"`
+	KLN *Klarna `json:"KLN,omitempty"`
+	TWI *TWINT  `json:"-"` // merged like CustomFields under the key twi
+	// Items contains the cart, required by buy now pay later methods like
+	// KLN. Merged like CustomFields under the key order.articles.
+	Items []LineItem `json:"-"`
+	// AutoSettleExplicit overrides AutoSettle and is also sent when false.
+	AutoSettleExplicit *bool `json:"-"`
+	CustomFields       `json:"-"`
+}
+
+func (r RequestAuthorize) getCustomFields() map[string]interface{} {
+	return r.CustomFields.merge(typedCustomFields(r.TWI, r.AutoSettleExplicit, r.Items))
+}
+
+func (r RequestAuthorize) getAmount() int { return r.Amount }
+
+func (r RequestAuthorize) withDefaultRefNo2(def string) interface{} {
+	if r.RefNo2 == "" {
+		r.RefNo2 = def
+	}
+	return r
+}
+
+// ResponseAuthorizeAndSettle gets returned by Client.AuthorizeAndSettle.
+type ResponseAuthorizeAndSettle struct {
+	ResponseCardMasked
+	// Status contains the transaction status fetched after the authorization.
+	Status *ResponseStatus
+}
+
+// IsSettled reports whether the transaction has been settled.
+func (r ResponseAuthorizeAndSettle) IsSettled() bool {
+	return r.Status != nil && r.Status.IsSettled()
+}
+
+// ResponseSettlePartial gets returned by Client.SettlePartialAndReleaseRemainder.
+type ResponseSettlePartial struct {
+	AuthorizedAmount int
+	SettledAmount    int
+	// ReleasedAmount is the remainder of the authorization which datatrans
+	// releases with the partial settlement, zero if the full amount has been
+	// settled.
+	ReleasedAmount int
 }
 
 type ResponseAuthorize struct {
@@ -85,13 +303,59 @@ type ResponseAuthorize struct {
 }
 
 type RequestAuthorizeTransaction struct {
-	RefNo        string `json:"refno,omitempty"`
-	Amount       int    `json:"amount,omitempty"`
-	AutoSettle   bool   `json:"autoSettle,omitempty"`
-	RefNo2       string `json:"refno2,omitempty"`
+	RefNo      string `json:"refno,omitempty"`
+	Amount     int    `json:"amount,omitempty"`
+	AutoSettle bool   `json:"autoSettle,omitempty"`
+	RefNo2     string `json:"refno2,omitempty"`
+	// AutoSettleExplicit overrides AutoSettle and is also sent when false.
+	AutoSettleExplicit *bool `json:"-"`
+	CustomFields       `json:"-"`
+}
+
+func (r RequestAuthorizeTransaction) getCustomFields() map[string]interface{} {
+	return r.CustomFields.merge(typedCustomFields(nil, r.AutoSettleExplicit, nil))
+}
+
+func (r RequestAuthorizeTransaction) getAmount() int { return r.Amount }
+
+func (r RequestAuthorizeTransaction) withDefaultRefNo2(def string) interface{} {
+	if r.RefNo2 == "" {
+		r.RefNo2 = def
+	}
+	return r
+}
+
+// RequestThreeDSContinue continues an authenticated transaction after the 3DS
+// challenge and passes the authentication results along with the
+// authorization.
+type RequestThreeDSContinue struct {
+	RefNo        string                       `json:"refno,omitempty"`
+	Amount       int                          `json:"amount,omitempty"`
+	AutoSettle   bool                         `json:"autoSettle,omitempty"`
+	RefNo2       string                       `json:"refno2,omitempty"`
+	ThreeD       *ThreeDSAuthenticationResult `json:"3D,omitempty"`
 	CustomFields `json:"-"`
 }
 
+func (r RequestThreeDSContinue) getAmount() int { return r.Amount }
+
+func (r RequestThreeDSContinue) withDefaultRefNo2(def string) interface{} {
+	if r.RefNo2 == "" {
+		r.RefNo2 = def
+	}
+	return r
+}
+
+// ThreeDSAuthenticationResult contains the outcome of the 3DS challenge.
+type ThreeDSAuthenticationResult struct {
+	ECI                          string `json:"eci,omitempty"`  // Electronic Commerce Indicator
+	XID                          string `json:"xid,omitempty"`  // 3DS 1 transaction ID
+	CAVV                         string `json:"cavv,omitempty"` // Cardholder Authentication Verification Value
+	ThreeDSTransactionID         string `json:"threeDSTransactionId,omitempty"`
+	DirectoryServerTransactionID string `json:"directoryServerTransactionId,omitempty"`
+	AuthenticationResponse       string `json:"authenticationResponse,omitempty"` // Enum: "Y" "A" "N" "U" "R"
+}
+
 type RequestValidateAlias struct {
 	Currency     string `json:"currency,omitempty"`
 	RefNo        string `json:"refno,omitempty"`
@@ -100,14 +364,48 @@ type RequestValidateAlias struct {
 	CustomFields `json:"-"`
 }
 
+func (r RequestValidateAlias) withDefaultRefNo2(def string) interface{} {
+	if r.RefNo2 == "" {
+		r.RefNo2 = def
+	}
+	return r
+}
+
 type RequestSettle struct {
-	Amount       int    `json:"amount,omitempty"`
-	Currency     string `json:"currency,omitempty"`
-	RefNo        string `json:"refno,omitempty"`
+	Amount   int    `json:"amount,omitempty"`
+	Currency string `json:"currency,omitempty"`
+	RefNo    string `json:"refno,omitempty"`
+	RefNo2   string `json:"refno2,omitempty"`
+	// ShipmentRef identifies one shipment of an order which gets settled in
+	// several parts. Datatrans has no dedicated field, it gets sent as refno2
+	// which appears in the settlement reports. It cannot be combined with
+	// RefNo2 but takes precedence over OptionMerchant.DefaultRefNo2.
+	ShipmentRef  string `json:"-"`
+	CustomFields `json:"-"`
+}
+
+func (r RequestSettle) getAmount() int { return r.Amount }
+
+func (r RequestSettle) withDefaultRefNo2(def string) interface{} {
+	if r.RefNo2 == "" {
+		r.RefNo2 = def
+	}
+	return r
+}
+
+type RequestCancel struct {
+	RefNo        string `json:"refno"`
 	RefNo2       string `json:"refno2,omitempty"`
 	CustomFields `json:"-"`
 }
 
+func (r RequestCancel) withDefaultRefNo2(def string) interface{} {
+	if r.RefNo2 == "" {
+		r.RefNo2 = def
+	}
+	return r
+}
+
 type RequestCredit struct {
 	Amount       int    `json:"amount,omitempty"`
 	Currency     string `json:"currency,omitempty"`
@@ -116,14 +414,38 @@ type RequestCredit struct {
 	CustomFields `json:"-"`
 }
 
+func (r RequestCredit) getAmount() int { return r.Amount }
+
+func (r RequestCredit) withDefaultRefNo2(def string) interface{} {
+	if r.RefNo2 == "" {
+		r.RefNo2 = def
+	}
+	return r
+}
+
 type RequestCreditAuthorize struct {
-	Currency     string `json:"currency,omitempty"`
-	RefNo        string `json:"refno,omitempty"`
-	Card         *Card  `json:"card,omitempty"`
-	Amount       int    `json:"amount,omitempty"`
-	AutoSettle   bool   `json:"autoSettle,omitempty"`
-	Refno2       string `json:"refno2,omitempty"`
-	CustomFields `json:"-"`
+	Currency   string `json:"currency,omitempty"`
+	RefNo      string `json:"refno,omitempty"`
+	Card       *Card  `json:"card,omitempty"`
+	Amount     int    `json:"amount,omitempty"`
+	AutoSettle bool   `json:"autoSettle,omitempty"`
+	Refno2     string `json:"refno2,omitempty"`
+	// AutoSettleExplicit overrides AutoSettle and is also sent when false.
+	AutoSettleExplicit *bool `json:"-"`
+	CustomFields       `json:"-"`
+}
+
+func (r RequestCreditAuthorize) getCustomFields() map[string]interface{} {
+	return r.CustomFields.merge(typedCustomFields(nil, r.AutoSettleExplicit, nil))
+}
+
+func (r RequestCreditAuthorize) getAmount() int { return r.Amount }
+
+func (r RequestCreditAuthorize) withDefaultRefNo2(def string) interface{} {
+	if r.Refno2 == "" {
+		r.Refno2 = def
+	}
+	return r
 }
 
 type ResponseCardMasked struct {
@@ -133,6 +455,93 @@ type ResponseCardMasked struct {
 	RawJSONBody               `json:"raw,omitempty"`
 }
 
+// ApplePay wraps the Apple Pay payment token as received from the device,
+// sent as {"APL":{"token":{...}}}.
+type ApplePay struct {
+	Token ApplePayToken `json:"token"`
+}
+
+// ApplePayToken contains the encrypted PKPaymentToken paymentData which gets
+// passed through to datatrans.
+type ApplePayToken struct {
+	Version   string          `json:"version,omitempty"` // e.g. EC_v1
+	Data      string          `json:"data,omitempty"`    // base64 encoded encrypted payment data
+	Signature string          `json:"signature,omitempty"`
+	Header    *ApplePayHeader `json:"header,omitempty"`
+}
+
+type ApplePayHeader struct {
+	EphemeralPublicKey string `json:"ephemeralPublicKey,omitempty"`
+	WrappedKey         string `json:"wrappedKey,omitempty"` // only set for RSA_v1
+	PublicKeyHash      string `json:"publicKeyHash,omitempty"`
+	TransactionID      string `json:"transactionId,omitempty"`
+	ApplicationData    string `json:"applicationData,omitempty"`
+}
+
+// GooglePay wraps the Google Pay payment token as received from the device,
+// sent as {"PAY":{"token":{...}}}.
+type GooglePay struct {
+	Token GooglePayToken `json:"token"`
+}
+
+// GooglePayToken contains the encrypted Google Pay payment token which gets
+// passed through to datatrans.
+type GooglePayToken struct {
+	ProtocolVersion        string                           `json:"protocolVersion,omitempty"` // e.g. ECv2
+	Signature              string                           `json:"signature,omitempty"`
+	IntermediateSigningKey *GooglePayIntermediateSigningKey `json:"intermediateSigningKey,omitempty"`
+	SignedMessage          string                           `json:"signedMessage,omitempty"`
+}
+
+type GooglePayIntermediateSigningKey struct {
+	SignedKey  string   `json:"signedKey,omitempty"`
+	Signatures []string `json:"signatures,omitempty"`
+}
+
+// PayPal specific parameters, sent under the key PAP.
+type PayPal struct {
+	Alias          string `json:"alias,omitempty"`          // PayPal alias (billing agreement) of a previous transaction
+	FraudSessionID string `json:"fraudSessionId,omitempty"` // session ID of the PayPal fraud net integration
+	ImageURL       string `json:"imageUrl,omitempty"`       // URL of the logo shown on the PayPal checkout page
+}
+
+// Klarna specific parameters, sent under the key KLN. More fields can be added
+// if needed, until then use CustomFields.
+type Klarna struct {
+	Alias string `json:"alias,omitempty"`
+}
+
+// LineItem describes one article of the cart. Amounts are in the smallest
+// unit of the currency, like Amount of the requests.
+type LineItem struct {
+	ID          string  `json:"id,omitempty"`
+	Name        string  `json:"name,omitempty"`
+	Description string  `json:"description,omitempty"`
+	Type        string  `json:"type,omitempty"` // e.g. goods, shipping, discount
+	Quantity    int     `json:"quantity,omitempty"`
+	UnitPrice   int     `json:"price,omitempty"`      // price of one unit including tax
+	TaxRate     float64 `json:"taxPercent,omitempty"` // e.g. 7.7
+	TaxAmount   int     `json:"tax,omitempty"`        // tax amount of all units
+}
+
+// Total returns the price of all units of the item.
+func (li LineItem) Total() int { return li.Quantity * li.UnitPrice }
+
+type order struct {
+	Articles []LineItem `json:"articles"`
+}
+
+// TWINT specific parameters, sent under the key twi.
+type TWINT struct {
+	Alias string `json:"alias,omitempty"`
+}
+
+type ResponseAliasConvert struct {
+	Alias       string        `json:"alias,omitempty"`
+	Card        *CardExtended `json:"card,omitempty"` // only set if returned by datatrans
+	RawJSONBody `json:"raw,omitempty"`
+}
+
 type CardMaskedSimple struct {
 	Masked string `json:"masked,omitempty"`
 }
@@ -200,9 +609,9 @@ type WorkPhone struct {
 	Subscriber string `json:"subscriber,omitempty"`
 }
 type Cardholder struct {
-	AddrMatch        string       `json:"addrMatch,omitempty"`
+	AddrMatch        AddrMatch    `json:"addrMatch,omitempty"` // AddrMatchYes or AddrMatchNo
 	BillAddrCity     string       `json:"billAddrCity,omitempty"`
-	BillAddrCountry  string       `json:"billAddrCountry,omitempty"`
+	BillAddrCountry  string       `json:"billAddrCountry,omitempty"` // 3 digit ISO 3166-1 numeric country code, see CountryNumeric
 	BillAddrLine1    string       `json:"billAddrLine1,omitempty"`
 	BillAddrLine2    string       `json:"billAddrLine2,omitempty"`
 	BillAddrLine3    string       `json:"billAddrLine3,omitempty"`
@@ -214,24 +623,63 @@ type Cardholder struct {
 	WorkPhone        *WorkPhone   `json:"workPhone,omitempty"`
 	CardholderName   string       `json:"cardholderName,omitempty"`
 	ShipAddrCity     string       `json:"shipAddrCity,omitempty"`
-	ShipAddrCountry  string       `json:"shipAddrCountry,omitempty"`
+	ShipAddrCountry  string       `json:"shipAddrCountry,omitempty"` // 3 digit ISO 3166-1 numeric country code, see CountryNumeric
 	ShipAddrLine1    string       `json:"shipAddrLine1,omitempty"`
 	ShipAddrLine2    string       `json:"shipAddrLine2,omitempty"`
 	ShipAddrLine3    string       `json:"shipAddrLine3,omitempty"`
 	ShipAddrPostCode string       `json:"shipAddrPostCode,omitempty"`
 	ShipAddrState    string       `json:"shipAddrState,omitempty"`
 }
+
+// AddrMatch tells whether the shipping and the billing address of a
+// Cardholder are the same.
+type AddrMatch string
+
+// Values of Cardholder.AddrMatch.
+const (
+	AddrMatchYes AddrMatch = "Y"
+	AddrMatchNo  AddrMatch = "N"
+)
+
 type MerchantRiskIndicator struct {
-	ShipIndicator        string `json:"shipIndicator,omitempty"`
-	DeliveryTimeframe    string `json:"deliveryTimeframe,omitempty"`
-	DeliveryEmailAddress string `json:"deliveryEmailAddress,omitempty"`
-	ReorderItemsInd      string `json:"reorderItemsInd,omitempty"`
-	PreOrderPurchaseInd  string `json:"preOrderPurchaseInd,omitempty"`
-	PreOrderDate         string `json:"preOrderDate,omitempty"`
-	GiftCardAmount       int    `json:"giftCardAmount,omitempty"`
-	GiftCardCurr         string `json:"giftCardCurr,omitempty"`
-	GiftCardCount        string `json:"giftCardCount,omitempty"`
+	ShipIndicator        ShipIndicator     `json:"shipIndicator,omitempty"`     // see ShipIndicatorBillingAddress
+	DeliveryTimeframe    DeliveryTimeframe `json:"deliveryTimeframe,omitempty"` // see DeliveryTimeframeElectronic
+	DeliveryEmailAddress string            `json:"deliveryEmailAddress,omitempty"`
+	ReorderItemsInd      string            `json:"reorderItemsInd,omitempty"`     // 01 first time ordered, 02 reordered
+	PreOrderPurchaseInd  string            `json:"preOrderPurchaseInd,omitempty"` // 01 merchandise available, 02 future availability
+	PreOrderDate         string            `json:"preOrderDate,omitempty"`
+	GiftCardAmount       int               `json:"giftCardAmount,omitempty"`
+	GiftCardCurr         string            `json:"giftCardCurr,omitempty"`
+	GiftCardCount        string            `json:"giftCardCount,omitempty"`
 }
+
+// ShipIndicator is the shipping method of a purchase as defined by EMV 3-D
+// Secure.
+type ShipIndicator string
+
+// Values of MerchantRiskIndicator.ShipIndicator.
+const (
+	ShipIndicatorBillingAddress  ShipIndicator = "01" // ship to the billing address of the cardholder
+	ShipIndicatorVerifiedAddress ShipIndicator = "02" // ship to another verified address on file with the merchant
+	ShipIndicatorOtherAddress    ShipIndicator = "03" // ship to an address different from the billing address
+	ShipIndicatorStore           ShipIndicator = "04" // ship to a store or pick-up at a local store
+	ShipIndicatorDigitalGoods    ShipIndicator = "05" // digital goods including online services and electronic gift cards
+	ShipIndicatorTickets         ShipIndicator = "06" // travel and event tickets, not shipped
+	ShipIndicatorOther           ShipIndicator = "07" // other, e.g. gaming or digital services not shipped
+)
+
+// DeliveryTimeframe is the delivery time of a purchase as defined by EMV 3-D
+// Secure.
+type DeliveryTimeframe string
+
+// Values of MerchantRiskIndicator.DeliveryTimeframe.
+const (
+	DeliveryTimeframeElectronic DeliveryTimeframe = "01"
+	DeliveryTimeframeSameDay    DeliveryTimeframe = "02"
+	DeliveryTimeframeOvernight  DeliveryTimeframe = "03"
+	DeliveryTimeframeTwoOrMore  DeliveryTimeframe = "04" // two or more days
+)
+
 type Purchase struct {
 	PurchaseInstalData    int                   `json:"purchaseInstalData,omitempty"`
 	MerchantRiskIndicator MerchantRiskIndicator `json:"merchantRiskIndicator,omitempty"`
@@ -302,41 +750,99 @@ type ThreeD struct {
 	ThreeRIInd                      string               `json:"threeRIInd,omitempty"`
 }
 
+// Status of a transaction as returned in ResponseStatus.Status.
+type Status string
+
+// Transaction statuses as returned in ResponseStatus.Status.
+const (
+	StatusInitialized       Status = "initialized"
+	StatusChallengeRequired Status = "challenge_required"
+	StatusChallengeOngoing  Status = "challenge_ongoing"
+	StatusAuthenticated     Status = "authenticated"
+	StatusAuthorized        Status = "authorized"
+	StatusSettled           Status = "settled"
+	StatusCanceled          Status = "canceled"
+	StatusTransmitted       Status = "transmitted"
+	StatusFailed            Status = "failed"
+)
+
 type ResponseStatus struct {
-	TransactionID string `json:"transactionId,omitempty"`
-	MerchantID    string `json:"merchantId,omitempty"`
-	Type          string `json:"type,omitempty"`
-	Status        string `json:"status,omitempty"`
-	Currency      string `json:"currency,omitempty"`
-	RefNo         string `json:"refno,omitempty"`
-	PaymentMethod string `json:"paymentMethod,omitempty"`
-	Detail        struct {
-		Init struct {
-			Expires time.Time `json:"expires,omitempty"` // Tells when the initialized transaction will expire if not continued - 30 minutes after initialization.
-		} `json:"init,omitempty"`
-		Authorize struct {
-			Amount                    int    `json:"amount,omitempty"`
-			AcquirerAuthorizationCode string `json:"acquirerAuthorizationCode,omitempty"`
-		} `json:"authorize,omitempty"`
-		Settle struct {
-			Amount int `json:"amount,omitempty"`
-		} `json:"settle,omitempty"`
-		Credit struct {
-			Amount int `json:"amount,omitempty"`
-		} `json:"credit,omitempty"`
-		Cancel struct {
-			Reversal bool `json:"reversal,omitempty"` // Whether the transaction was reversed on acquirer side.
-		} `json:"cancel,omitempty"`
-		Fail struct {
-			Reason  string `json:"reason,omitempty"`
-			Message string `json:"message,omitempty"`
-		} `json:"fail,omitempty"`
-	} `json:"detail,omitempty"`
-	Customer    *Customer     `json:"customer,omitempty"`
-	Card        *CardExtended `json:"card,omitempty"`
-	Language    string        `json:"language,omitempty"`
-	History     []History     `json:"history,omitempty"`
-	RawJSONBody `json:"raw,omitempty"`
+	TransactionID string        `json:"transactionId,omitempty"`
+	MerchantID    string        `json:"merchantId,omitempty"`
+	Type          string        `json:"type,omitempty"`
+	Status        Status        `json:"status,omitempty"`
+	Currency      string        `json:"currency,omitempty"`
+	RefNo         string        `json:"refno,omitempty"`
+	PaymentMethod string        `json:"paymentMethod,omitempty"`
+	Detail        StatusDetail  `json:"detail,omitempty"`
+	Customer      *Customer     `json:"customer,omitempty"`
+	Card          *CardExtended `json:"card,omitempty"`
+	Language      string        `json:"language,omitempty"`
+	History       []History     `json:"history,omitempty"`
+	RawJSONBody   `json:"raw,omitempty"`
+}
+
+// IssuerCountry returns the country of the card issuer. It is only present if
+// the transaction has been initialized with
+// InitializeOption.ReturnCustomerCountry.
+func (rs ResponseStatus) IssuerCountry() (string, bool) {
+	if rs.Card == nil || rs.Card.Info == nil || rs.Card.Info.Country == "" {
+		return "", false
+	}
+	return rs.Card.Info.Country, true
+}
+
+// Settlements returns the settle entries of the history in their original
+// order, one per (partial) settlement.
+func (rs ResponseStatus) Settlements() []History {
+	var list []History
+	for _, h := range rs.History {
+		if h.Action == ActionSettle {
+			list = append(list, h)
+		}
+	}
+	return list
+}
+
+type StatusDetail struct {
+	Init      InitDetail      `json:"init,omitempty"`
+	Authorize AuthorizeDetail `json:"authorize,omitempty"`
+	Settle    SettleDetail    `json:"settle,omitempty"`
+	Credit    CreditDetail    `json:"credit,omitempty"`
+	Cancel    CancelDetail    `json:"cancel,omitempty"`
+	Fail      FailDetail      `json:"fail,omitempty"`
+}
+
+type InitDetail struct {
+	Expires FlexTime `json:"expires,omitempty"` // Tells when the initialized transaction will expire if not continued - 30 minutes after initialization.
+}
+
+type AuthorizeDetail struct {
+	Amount                    FlexInt `json:"amount,omitempty"`
+	AcquirerAuthorizationCode string  `json:"acquirerAuthorizationCode,omitempty"`
+}
+
+type SettleDetail struct {
+	Amount FlexInt `json:"amount,omitempty"`
+}
+
+type CreditDetail struct {
+	Amount FlexInt `json:"amount,omitempty"`
+}
+
+type CancelDetail struct {
+	Reversal bool `json:"reversal,omitempty"` // Whether the transaction was reversed on acquirer side.
+}
+
+type FailDetail struct {
+	Reason  string `json:"reason,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// IsSettled reports whether the transaction has been settled or already
+// transmitted to the acquirer.
+func (rs ResponseStatus) IsSettled() bool {
+	return rs.Status == StatusSettled || rs.Status == StatusTransmitted
 }
 
 type CardExtended struct {
@@ -347,46 +853,94 @@ type CardExtended struct {
 	ExpiryYear      string            `json:"expiryYear,omitempty"`
 	Info            *CardExtendedInfo `json:"info,omitempty"`
 	WalletIndicator string            `json:"walletIndicator,omitempty"`
+	// Fingerprint identifies the card number independent of the alias, e.g.
+	// to detect the same card across customers for fraud checks.
+	Fingerprint string `json:"fingerprint,omitempty"`
 }
 
 type CardExtendedInfo struct {
 	Brand   string `json:"brand,omitempty"`
 	Type    string `json:"type,omitempty"`
 	Usage   string `json:"usage,omitempty"`
-	Country string `json:"country,omitempty"`
+	Country string `json:"country,omitempty"` // 2 letter ISO 3166-1 alpha-2 country code of the issuer, see InitializeOption.ReturnCustomerCountry
 	Issuer  string `json:"issuer,omitempty"`
 }
 
 type History struct {
-	Action  string    `json:"action,omitempty"`
-	Amount  int       `json:"amount,omitempty"`
-	Source  string    `json:"source,omitempty"`
-	Date    time.Time `json:"date,omitempty"`
-	Success bool      `json:"success,omitempty"`
-	IP      string    `json:"ip,omitempty"`
+	Action  HistoryAction `json:"action,omitempty"`
+	Amount  FlexInt       `json:"amount,omitempty"`
+	Source  string        `json:"source,omitempty"`
+	Date    FlexTime      `json:"date,omitempty"`
+	Success bool          `json:"success,omitempty"`
+	IP      string        `json:"ip,omitempty"`
 }
 
 type Customer struct {
-	ID                    string `json:"id,omitempty"`                    // Unique customer identifier
-	Title                 string `json:"title,omitempty"`                 // Something like Ms or Mrs
-	FirstName             string `json:"firstName,omitempty"`             // The first name of the customer.
-	LastName              string `json:"lastName,omitempty"`              // The last name of the customer.
-	Street                string `json:"street,omitempty"`                // The street of the customer.
-	Street2               string `json:"street2,omitempty"`               // Additional street information. For example: '3rd floor'
-	City                  string `json:"city,omitempty"`                  // The city of the customer.
-	Country               string `json:"country,omitempty"`               // 2 letter ISO 3166-1 alpha-2 country code
-	ZipCode               string `json:"zipCode,omitempty"`               // Zip code of the customer.
-	Phone                 string `json:"phone,omitempty"`                 // Phone number of the customer.
-	CellPhone             string `json:"cellPhone,omitempty"`             // Cell Phone number of the customer.
-	Email                 string `json:"email,omitempty"`                 // The email address of the customer.
-	Gender                string `json:"gender,omitempty"`                // Gender of the customer. female or male.
-	BirthDate             string `json:"birthDate,omitempty"`             // The birth date of the customer. Must be in ISO-8601 format (YYYY-MM-DD).
-	Language              string `json:"language,omitempty"`              // The language of the customer.
-	Type                  string `json:"type,omitempty"`                  // P or C depending on whether the customer is private or a company. If C, the fields name and companyRegisterNumber are required
-	Name                  string `json:"name,omitempty"`                  // The name of the company. Only applicable if type=C
-	CompanyLegalForm      string `json:"companyLegalForm,omitempty"`      // The legal form of the company (AG, GmbH, ...)
-	CompanyRegisterNumber string `json:"companyRegisterNumber,omitempty"` // The register number of the company. Only applicable if type=C
-	IpAddress             string `json:"ipAddress,omitempty"`             // The ip address of the customer.
+	ID                    string       `json:"id,omitempty"`                    // Unique customer identifier
+	Title                 string       `json:"title,omitempty"`                 // Something like Ms or Mrs
+	FirstName             string       `json:"firstName,omitempty"`             // The first name of the customer.
+	LastName              string       `json:"lastName,omitempty"`              // The last name of the customer.
+	Street                string       `json:"street,omitempty"`                // The street of the customer.
+	Street2               string       `json:"street2,omitempty"`               // Additional street information. For example: '3rd floor'
+	City                  string       `json:"city,omitempty"`                  // The city of the customer.
+	Country               string       `json:"country,omitempty"`               // 2 letter ISO 3166-1 alpha-2 country code
+	ZipCode               string       `json:"zipCode,omitempty"`               // Zip code of the customer.
+	Phone                 string       `json:"phone,omitempty"`                 // Phone number of the customer.
+	CellPhone             string       `json:"cellPhone,omitempty"`             // Cell Phone number of the customer.
+	Email                 string       `json:"email,omitempty"`                 // The email address of the customer.
+	Gender                Gender       `json:"gender,omitempty"`                // Gender of the customer. female or male.
+	BirthDate             string       `json:"birthDate,omitempty"`             // The birth date of the customer. Must be in ISO-8601 format (YYYY-MM-DD).
+	Language              string       `json:"language,omitempty"`              // The language of the customer.
+	Type                  CustomerType `json:"type,omitempty"`                  // P or C depending on whether the customer is private or a company. If C, the fields name and companyRegisterNumber are required
+	Name                  string       `json:"name,omitempty"`                  // The name of the company. Only applicable if type=C
+	CompanyLegalForm      string       `json:"companyLegalForm,omitempty"`      // The legal form of the company (AG, GmbH, ...)
+	CompanyRegisterNumber string       `json:"companyRegisterNumber,omitempty"` // The register number of the company. Only applicable if type=C
+	IpAddress             string       `json:"ipAddress,omitempty"`             // The ip address of the customer.
+}
+
+// Gender of a Customer.
+type Gender string
+
+// Values of Customer.Gender.
+const (
+	GenderFemale Gender = "female"
+	GenderMale   Gender = "male"
+)
+
+// CustomerType tells whether a Customer is a private person or a company.
+type CustomerType string
+
+// Values of Customer.Type.
+const (
+	CustomerTypePrivate CustomerType = "P"
+	CustomerTypeCompany CustomerType = "C"
+)
+
+// birthDateLayout is the format of Customer.BirthDate.
+const birthDateLayout = "2006-01-02"
+
+// SetBirthDate sets BirthDate in the format YYYY-MM-DD. Only the date in the
+// location of t gets used.
+func (c *Customer) SetBirthDate(t time.Time) {
+	c.BirthDate = t.Format(birthDateLayout)
+}
+
+// Normalize converts common abbreviations and spellings of Gender and Type to
+// the values expected by datatrans, e.g. "M" to "male" or "c" to "C". Unknown
+// values are left untouched so that Validate can report them.
+func (c *Customer) Normalize() {
+	switch strings.ToLower(strings.TrimSpace(string(c.Gender))) {
+	case "f", "female":
+		c.Gender = GenderFemale
+	case "m", "male":
+		c.Gender = GenderMale
+	}
+	switch CustomerType(strings.ToUpper(strings.TrimSpace(string(c.Type)))) {
+	case CustomerTypePrivate:
+		c.Type = CustomerTypePrivate
+	case CustomerTypeCompany:
+		c.Type = CustomerTypeCompany
+	}
 }
 
 type Theme struct {
@@ -428,6 +982,8 @@ type Redirect struct {
 	Method string `json:"method,omitempty"` // Default: "GET"	Enum: "GET" "POST"
 }
 
+// InitializeOption booleans are always sent because the whole option block is
+// optional, set RequestInitialize.Option to nil to omit them.
 type InitializeOption struct {
 	// Whether an alias should be created for this transaction or not. If set to
 	// true an alias will be created. This alias can then be used to initialize
@@ -437,10 +993,19 @@ type InitializeOption struct {
 	ReturnMaskedCardNumber bool   `json:"returnMaskedCardNumber"` // Whether to return the masked card number. Format: 520000xxxxxx0080
 	ReturnCustomerCountry  bool   `json:"returnCustomerCountry"`  // If set to true, the country of the customers issuer will be returned.
 	AuthenticationOnly     bool   `json:"authenticationOnly"`     // Whether to only authenticate the transaction (3D process only). If set to true, the actual authorization will not take place.
-	RememberMe             string `json:"rememberMe"`             // Enum: "true" "checked"	Whether to show a checkbox on the payment page to let the customer choose if they want to save their card information.
+	RememberMe             string `json:"rememberMe"`             // Enum: RememberMeTrue, RememberMeChecked	Whether to show a checkbox on the payment page to let the customer choose if they want to save their card information.
 	ReturnMobileToken      bool   `json:"returnMobileToken"`      // Indicates that a mobile token should be created. This is needed when using our Mobile SDKs.
 }
 
+// Values of InitializeOption.RememberMe. It is a string instead of a bool
+// because it has three states: no checkbox on the payment page (empty), an
+// unchecked checkbox (RememberMeTrue) and a pre-checked one
+// (RememberMeChecked). OptionStrictValidation rejects other values.
+const (
+	RememberMeTrue    = "true"
+	RememberMeChecked = "checked"
+)
+
 type RequestReconciliationsSale struct {
 	Date          time.Time `json:"date"`
 	TransactionID string    `json:"transactionId"`
@@ -450,6 +1015,8 @@ type RequestReconciliationsSale struct {
 	Refno         string    `json:"refno"`
 }
 
+func (r RequestReconciliationsSale) getAmount() int { return r.Amount }
+
 type ResponseReconciliationsSale struct {
 	TransactionID string    `json:"transactionId"`
 	SaleDate      time.Time `json:"saleDate"`
@@ -0,0 +1,132 @@
+package datatrans
+
+import (
+	"encoding/json"
+	"reflect"
+	"time"
+)
+
+// The value type nested structs of the 3D data would always get serialized as
+// empty objects, e.g. "3D":{}, which some acquirers reject. The MarshalJSON
+// functions below omit them if they are empty. The outer fields shadow the
+// fields with the same JSON name of the embedded alias type.
+
+func (c Card) MarshalJSON() ([]byte, error) {
+	type alias Card
+	var td *ThreeD
+	if !reflect.ValueOf(c.ThreeD).IsZero() {
+		td = &c.ThreeD
+	}
+	return json.Marshal(struct {
+		alias
+		ThreeD *ThreeD `json:"3D,omitempty"`
+	}{alias(c), td})
+}
+
+func (r ThreeDSRequestor) MarshalJSON() ([]byte, error) {
+	type alias ThreeDSRequestor
+	var ai *ThreeDSRequestorAuthenticationInfo
+	if r.ThreeDSRequestorAuthenticationInfo != (ThreeDSRequestorAuthenticationInfo{}) {
+		ai = &r.ThreeDSRequestorAuthenticationInfo
+	}
+	var pai *ThreeDSRequestorPriorAuthenticationInfo
+	if r.ThreeDSRequestorPriorAuthenticationInfo != (ThreeDSRequestorPriorAuthenticationInfo{}) {
+		pai = &r.ThreeDSRequestorPriorAuthenticationInfo
+	}
+	return json.Marshal(struct {
+		alias
+		ThreeDSRequestorAuthenticationInfo      *ThreeDSRequestorAuthenticationInfo      `json:"threeDSRequestorAuthenticationInfo,omitempty"`
+		ThreeDSRequestorPriorAuthenticationInfo *ThreeDSRequestorPriorAuthenticationInfo `json:"threeDSRequestorPriorAuthenticationInfo,omitempty"`
+	}{alias(r), ai, pai})
+}
+
+func (ca CardholderAccount) MarshalJSON() ([]byte, error) {
+	type alias CardholderAccount
+	var ai *AcctInfo
+	if ca.AcctInfo != (AcctInfo{}) {
+		ai = &ca.AcctInfo
+	}
+	return json.Marshal(struct {
+		alias
+		AcctInfo *AcctInfo `json:"acctInfo,omitempty"`
+	}{alias(ca), ai})
+}
+
+func (p Purchase) MarshalJSON() ([]byte, error) {
+	type alias Purchase
+	var mri *MerchantRiskIndicator
+	if p.MerchantRiskIndicator != (MerchantRiskIndicator{}) {
+		mri = &p.MerchantRiskIndicator
+	}
+	return json.Marshal(struct {
+		alias
+		MerchantRiskIndicator *MerchantRiskIndicator `json:"merchantRiskIndicator,omitempty"`
+	}{alias(p), mri})
+}
+
+func (me MessageExtension) MarshalJSON() ([]byte, error) {
+	type alias MessageExtension
+	var d *Data
+	if me.Data != (Data{}) {
+		d = &me.Data
+	}
+	return json.Marshal(struct {
+		alias
+		Data *Data `json:"data,omitempty"`
+	}{alias(me), d})
+}
+
+// MarshalJSON sends ShipmentRef as refno2.
+func (r RequestSettle) MarshalJSON() ([]byte, error) {
+	type alias RequestSettle
+	if r.ShipmentRef != "" {
+		r.RefNo2 = r.ShipmentRef
+	}
+	return json.Marshal(alias(r))
+}
+
+// reconciliationTimeLayout is the documented format of the dates of the
+// reconciliation API.
+const reconciliationTimeLayout = "2006-01-02T15:04:05Z"
+
+// reconciliationTime marshals a time in UTC with second precision, the default
+// RFC3339Nano of time.Time with fractions and local offsets might prevent
+// datatrans from matching the sale.
+type reconciliationTime time.Time
+
+func (rt reconciliationTime) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + time.Time(rt).UTC().Format(reconciliationTimeLayout) + `"`), nil
+}
+
+func (r RequestReconciliationsSale) MarshalJSON() ([]byte, error) {
+	type alias RequestReconciliationsSale
+	return json.Marshal(struct {
+		alias
+		Date reconciliationTime `json:"date"`
+	}{alias(r), reconciliationTime(r.Date)})
+}
+
+// UnmarshalJSON parses the dates leniently like FlexTime.
+func (r *ResponseReconciliationsSale) UnmarshalJSON(data []byte) error {
+	type alias ResponseReconciliationsSale
+	aux := struct {
+		*alias
+		SaleDate     FlexTime `json:"saleDate"`
+		ReportedDate FlexTime `json:"reportedDate"`
+	}{alias: (*alias)(r)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	r.SaleDate, r.ReportedDate = aux.SaleDate.Time, aux.ReportedDate.Time
+	return nil
+}
+
+// Cards returns Card as a list, nil without card. Datatrans documents a
+// single card per transaction, also for wallet payments: Card.WalletIndicator
+// tells whether the card data came from Apple Pay or Google Pay.
+func (rs ResponseStatus) Cards() []CardExtended {
+	if rs.Card == nil {
+		return nil
+	}
+	return []CardExtended{*rs.Card}
+}
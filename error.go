@@ -1,10 +1,63 @@
 package datatrans
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Error codes as documented in https://docs.datatrans.ch/docs/error-messages
+const (
+	ErrCodeUnauthorized             = "UNAUTHORIZED"
+	ErrCodeInvalidJSONPayload       = "INVALID_JSON_PAYLOAD"
+	ErrCodeUnrecognizedProperty     = "UNRECOGNIZED_PROPERTY"
+	ErrCodeInvalidProperty          = "INVALID_PROPERTY"
+	ErrCodeClientError              = "CLIENT_ERROR"
+	ErrCodeServerError              = "SERVER_ERROR"
+	ErrCodeInvalidTransactionStatus = "INVALID_TRANSACTION_STATUS"
+	ErrCodeTransactionNotFound      = "TRANSACTION_NOT_FOUND"
+	ErrCodeExpiredCard              = "EXPIRED_CARD"
+	ErrCodeInvalidCard              = "INVALID_CARD"
+	ErrCodeBlockedCard              = "BLOCKED_CARD"
+	ErrCodeUnsupportedCard          = "UNSUPPORTED_CARD"
+	ErrCodeInvalidAlias             = "INVALID_ALIAS"
+	ErrCodeAliasNotFound            = "ALIAS_NOT_FOUND"
+	ErrCodeInvalidCVV               = "INVALID_CVV"
+	ErrCodeDuplicateRefno           = "DUPLICATE_REFNO"
+	ErrCodeDeclined                 = "DECLINED"
+	ErrCodeSoftDeclined             = "SOFT_DECLINED"
+	ErrCodeInvalidSign              = "INVALID_SIGN"
+	ErrCodeBlockedByVelocityChecker = "BLOCKED_BY_VELOCITY_CHECKER"
+	ErrCodeThirdPartyError          = "THIRD_PARTY_ERROR"
+	ErrCodeReferral                 = "REFERRAL"
+	ErrCodeInvalidSetup             = "INVALID_SETUP"
+)
+
+// ErrUnauthorized gets returned by Client.VerifyCredentials if datatrans
+// rejects the credentials of a merchant. Errors of all other requests match it
+// with errors.Is on HTTP 401/403, also if the response body is empty.
+var ErrUnauthorized = errors.New("datatrans: unauthorized")
+
+func isUnauthorized(statusCode int) bool {
+	return statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden
+}
+
+// ErrSecureFieldsUpdateNotAllowed gets returned by Client.SecureFieldsUpdate
+// with OptionSecureFieldsUpdateCheck if the 3D process has already started.
+var ErrSecureFieldsUpdateNotAllowed = errors.New("datatrans: secure fields update only allowed before the 3D process")
 
 type ErrorResponse struct {
 	HTTPStatusCode int
 	ErrorDetail    ErrorDetail `json:"error"`
+	// SentBody contains the request body as sent to datatrans, after merging
+	// the CustomFields, to reproduce the error. Card numbers and aliases are
+	// masked, wallet payment tokens removed. Empty for requests without a body
+	// and for streamed bodies.
+	SentBody []byte `json:"-"`
+	// IdempotencyKey contains the Idempotency-Key header as sent, e.g. for
+	// support tickets. Empty if OptionMerchant.EnableIdempotency is disabled.
+	// On success the key is available via OptionRequestDump.
+	IdempotencyKey string `json:"-"`
 }
 
 // see https://docs.datatrans.ch/docs/error-messages
@@ -24,3 +77,111 @@ func (s ErrorResponse) Error() string {
 		s.ErrorDetail.Message,
 	)
 }
+
+// Is reports whether target is ErrUnauthorized and the response has the HTTP
+// status 401 or 403.
+func (s ErrorResponse) Is(target error) bool {
+	return target == ErrUnauthorized && isUnauthorized(s.HTTPStatusCode)
+}
+
+// Retryable reports whether the same request might succeed when sent again
+// later. Transient conditions like server errors, timeouts or rate limiting
+// are retryable, declines and invalid input are permanent.
+func (s ErrorResponse) Retryable() bool {
+	switch s.ErrorDetail.Code {
+	case ErrCodeServerError, ErrCodeThirdPartyError:
+		return true
+	case ErrCodeUnauthorized, ErrCodeInvalidJSONPayload, ErrCodeUnrecognizedProperty,
+		ErrCodeInvalidProperty, ErrCodeClientError, ErrCodeInvalidTransactionStatus,
+		ErrCodeTransactionNotFound, ErrCodeExpiredCard, ErrCodeInvalidCard,
+		ErrCodeBlockedCard, ErrCodeUnsupportedCard, ErrCodeInvalidAlias,
+		ErrCodeAliasNotFound, ErrCodeInvalidCVV, ErrCodeDuplicateRefno,
+		ErrCodeDeclined, ErrCodeSoftDeclined, ErrCodeInvalidSign,
+		ErrCodeBlockedByVelocityChecker, ErrCodeReferral, ErrCodeInvalidSetup:
+		return false
+	}
+	switch s.HTTPStatusCode {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests:
+		return true
+	}
+	return s.HTTPStatusCode >= http.StatusInternalServerError
+}
+
+// SuggestedHTTPStatus maps the error to an HTTP status code suitable for
+// re-serving the error to your own API clients. Declines map to 402, invalid
+// input to 400, conflicts to 409, missing resources to 404 and everything
+// related to datatrans itself or the merchant setup to 502.
+func (s ErrorResponse) SuggestedHTTPStatus() int {
+	if isDeclineCode(s.ErrorDetail.Code) {
+		return http.StatusPaymentRequired
+	}
+	switch s.ErrorDetail.Code {
+	case ErrCodeInvalidJSONPayload, ErrCodeUnrecognizedProperty, ErrCodeInvalidProperty,
+		ErrCodeClientError, ErrCodeInvalidAlias:
+		return http.StatusBadRequest
+	case ErrCodeDuplicateRefno, ErrCodeInvalidTransactionStatus:
+		return http.StatusConflict
+	case ErrCodeTransactionNotFound, ErrCodeAliasNotFound:
+		return http.StatusNotFound
+	case ErrCodeServerError, ErrCodeThirdPartyError, ErrCodeUnauthorized,
+		ErrCodeInvalidSign, ErrCodeInvalidSetup:
+		return http.StatusBadGateway
+	}
+	switch {
+	case s.HTTPStatusCode == http.StatusTooManyRequests:
+		return http.StatusServiceUnavailable
+	case s.HTTPStatusCode == http.StatusNotFound:
+		return http.StatusNotFound
+	case s.HTTPStatusCode >= 400 && s.HTTPStatusCode < 500 && s.HTTPStatusCode != http.StatusUnauthorized:
+		return http.StatusBadRequest
+	}
+	return http.StatusBadGateway
+}
+
+// PublicMessage returns a message which can be shown to end users without
+// leaking internal details of the payment setup.
+func (s ErrorResponse) PublicMessage() string {
+	switch s.ErrorDetail.Code {
+	case ErrCodeExpiredCard:
+		return "The card has expired."
+	case ErrCodeInvalidCVV:
+		return "The card verification code is invalid."
+	}
+	switch s.SuggestedHTTPStatus() {
+	case http.StatusPaymentRequired:
+		return "The payment has been declined."
+	case http.StatusBadRequest:
+		return "The payment request is invalid."
+	case http.StatusConflict:
+		return "The payment cannot be processed in its current state."
+	case http.StatusNotFound:
+		return "The payment could not be found."
+	}
+	return "The payment service is currently unavailable, please try again later."
+}
+
+func isDeclineCode(code string) bool {
+	switch code {
+	case ErrCodeDeclined, ErrCodeSoftDeclined, ErrCodeExpiredCard, ErrCodeInvalidCard,
+		ErrCodeBlockedCard, ErrCodeUnsupportedCard, ErrCodeInvalidCVV,
+		ErrCodeBlockedByVelocityChecker, ErrCodeReferral:
+		return true
+	}
+	return false
+}
+
+// IsDeclined reports whether a payment has been declined for business reasons
+// (card declined, expired, blocked, ...) as opposed to a technical error.
+// Depending on the endpoint a decline is returned as an HTTP error or as a
+// failed transaction status, so both can be passed, each one may be nil:
+//
+//	err ErrorResponse with a decline code             -> true
+//	rs.Status failed and Detail.Fail.Reason a decline -> true
+//	any other error or status                         -> false
+func IsDeclined(err error, rs *ResponseStatus) bool {
+	var errResp ErrorResponse
+	if errors.As(err, &errResp) && isDeclineCode(errResp.ErrorDetail.Code) {
+		return true
+	}
+	return rs != nil && rs.Status == StatusFailed && isDeclineCode(rs.Detail.Fail.Reason)
+}
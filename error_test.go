@@ -0,0 +1,111 @@
+package datatrans_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/globusdigital/datatrans"
+)
+
+func TestErrorResponse_Retryable(t *testing.T) {
+	tests := []struct {
+		status int
+		code   string
+		want   bool
+	}{
+		{500, datatrans.ErrCodeServerError, true},
+		{502, "", true},
+		{503, "", true},
+		{429, "", true},
+		{408, "", true},
+		{400, datatrans.ErrCodeThirdPartyError, true},
+		{400, datatrans.ErrCodeDeclined, false},
+		{400, datatrans.ErrCodeInvalidCard, false},
+		{400, datatrans.ErrCodeAliasNotFound, false},
+		{401, datatrans.ErrCodeUnauthorized, false},
+		{404, datatrans.ErrCodeTransactionNotFound, false},
+		{500, datatrans.ErrCodeInvalidSetup, false},
+		{400, "", false},
+	}
+	for _, tt := range tests {
+		er := datatrans.ErrorResponse{
+			HTTPStatusCode: tt.status,
+			ErrorDetail:    datatrans.ErrorDetail{Code: tt.code},
+		}
+		if have := er.Retryable(); have != tt.want {
+			t.Errorf("%d %q: want %t, have %t", tt.status, tt.code, tt.want, have)
+		}
+	}
+}
+
+func TestErrorResponse_SuggestedHTTPStatus(t *testing.T) {
+	tests := []struct {
+		status     int
+		code       string
+		wantStatus int
+		wantMsg    string
+	}{
+		{400, datatrans.ErrCodeDeclined, 402, "The payment has been declined."},
+		{400, datatrans.ErrCodeExpiredCard, 402, "The card has expired."},
+		{400, datatrans.ErrCodeInvalidProperty, 400, "The payment request is invalid."},
+		{400, datatrans.ErrCodeDuplicateRefno, 409, "The payment cannot be processed in its current state."},
+		{404, datatrans.ErrCodeTransactionNotFound, 404, "The payment could not be found."},
+		{400, datatrans.ErrCodeAliasNotFound, 404, "The payment could not be found."},
+		{500, datatrans.ErrCodeServerError, 502, "The payment service is currently unavailable, please try again later."},
+		{401, datatrans.ErrCodeUnauthorized, 502, "The payment service is currently unavailable, please try again later."},
+		{429, "", 503, "The payment service is currently unavailable, please try again later."},
+		{422, "", 400, "The payment request is invalid."},
+	}
+	for _, tt := range tests {
+		er := datatrans.ErrorResponse{
+			HTTPStatusCode: tt.status,
+			ErrorDetail:    datatrans.ErrorDetail{Code: tt.code, Message: "internal details"},
+		}
+		if have := er.SuggestedHTTPStatus(); have != tt.wantStatus {
+			t.Errorf("%d %q: want %d, have %d", tt.status, tt.code, tt.wantStatus, have)
+		}
+		if have := er.PublicMessage(); have != tt.wantMsg {
+			t.Errorf("%d %q: want %q, have %q", tt.status, tt.code, tt.wantMsg, have)
+		}
+	}
+}
+
+func TestIsDeclined(t *testing.T) {
+	declinedErr := fmt.Errorf("wrapped: %w", datatrans.ErrorResponse{
+		HTTPStatusCode: 400,
+		ErrorDetail:    datatrans.ErrorDetail{Code: datatrans.ErrCodeDeclined},
+	})
+	serverErr := datatrans.ErrorResponse{
+		HTTPStatusCode: 500,
+		ErrorDetail:    datatrans.ErrorDetail{Code: datatrans.ErrCodeServerError},
+	}
+	failedDeclined := &datatrans.ResponseStatus{
+		Status: datatrans.StatusFailed,
+		Detail: datatrans.StatusDetail{Fail: datatrans.FailDetail{Reason: datatrans.ErrCodeBlockedCard}},
+	}
+	failedTechnical := &datatrans.ResponseStatus{
+		Status: datatrans.StatusFailed,
+		Detail: datatrans.StatusDetail{Fail: datatrans.FailDetail{Reason: datatrans.ErrCodeThirdPartyError}},
+	}
+
+	tests := []struct {
+		name string
+		err  error
+		rs   *datatrans.ResponseStatus
+		want bool
+	}{
+		{"error path decline", declinedErr, nil, true},
+		{"status path decline", nil, failedDeclined, true},
+		{"server error", serverErr, nil, false},
+		{"technical failure", nil, failedTechnical, false},
+		{"authorized", nil, &datatrans.ResponseStatus{Status: datatrans.StatusAuthorized}, false},
+		{"other error", errors.New("timeout"), nil, false},
+		{"nothing", nil, nil, false},
+	}
+	for _, tt := range tests {
+		if have := datatrans.IsDeclined(tt.err, tt.rs); have != tt.want {
+			t.Errorf("%s: want %t, have %t", tt.name, tt.want, have)
+		}
+	}
+}
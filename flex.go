@@ -0,0 +1,71 @@
+package datatrans
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// FlexInt is an integer which can be unmarshaled from a JSON number or from a
+// quoted string. Some payment methods return amounts as strings. It gets
+// marshaled as a plain JSON number.
+type FlexInt int
+
+func (fi *FlexInt) UnmarshalJSON(data []byte) error {
+	if len(data) >= 2 && data[0] == '"' && data[len(data)-1] == '"' {
+		data = data[1 : len(data)-1]
+	}
+	if len(data) == 0 || string(data) == "null" {
+		*fi = 0
+		return nil
+	}
+	i, err := strconv.Atoi(string(data))
+	if err != nil {
+		return fmt.Errorf("FlexInt: failed to parse %q: %w", data, err)
+	}
+	*fi = FlexInt(i)
+	return nil
+}
+
+// flexTimeLayouts lists the accepted formats of FlexTime, RFC3339 as
+// documented first.
+var flexTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999Z0700",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02",
+}
+
+// FlexTime is a time which tolerates different formats when unmarshaled from
+// JSON. An empty string or null results in the zero time. It gets marshaled as
+// RFC 3339 and the zero time as null, omitempty has no effect on structs.
+type FlexTime struct {
+	time.Time
+}
+
+func (ft FlexTime) MarshalJSON() ([]byte, error) {
+	if ft.IsZero() {
+		return []byte("null"), nil
+	}
+	return ft.Time.MarshalJSON()
+}
+
+func (ft *FlexTime) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if s == "null" || s == `""` {
+		ft.Time = time.Time{}
+		return nil
+	}
+	if len(s) < 2 || s[0] != '"' || s[len(s)-1] != '"' {
+		return fmt.Errorf("FlexTime: invalid value %s", s)
+	}
+	s = s[1 : len(s)-1]
+	for _, layout := range flexTimeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			ft.Time = t
+			return nil
+		}
+	}
+	return fmt.Errorf("FlexTime: unsupported format %q", s)
+}
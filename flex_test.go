@@ -0,0 +1,98 @@
+package datatrans_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/globusdigital/datatrans"
+)
+
+func TestFlexInt(t *testing.T) {
+	tests := []struct {
+		json string
+		want datatrans.FlexInt
+	}{
+		{`{"amount": 100}`, 100},
+		{`{"amount": "100"}`, 100},
+		{`{"amount": ""}`, 0},
+		{`{"amount": null}`, 0},
+		{`{}`, 0},
+	}
+	for _, tt := range tests {
+		var h datatrans.History
+		must(t, json.Unmarshal([]byte(tt.json), &h))
+		if h.Amount != tt.want {
+			t.Errorf("%s: want %d, have %d", tt.json, tt.want, h.Amount)
+		}
+	}
+
+	var h datatrans.History
+	if err := json.Unmarshal([]byte(`{"amount": "1a"}`), &h); err == nil {
+		t.Error("expected an error")
+	}
+
+	data, err := json.Marshal(datatrans.SettleDetail{Amount: 100})
+	must(t, err)
+	if string(data) != `{"amount":100}` {
+		t.Errorf("invalid JSON: %s", data)
+	}
+
+	var rs datatrans.ResponseStatus
+	must(t, json.Unmarshal([]byte(`{"detail":{"authorize":{"amount":"1000"},"settle":{"amount":1000},"credit":{"amount":"500"}}}`), &rs))
+	if rs.Detail.Authorize.Amount != 1000 || rs.Detail.Settle.Amount != 1000 || rs.Detail.Credit.Amount != 500 {
+		t.Errorf("invalid detail: %#v", rs.Detail)
+	}
+}
+
+func TestFlexTime(t *testing.T) {
+	want := time.Date(2021, 2, 15, 9, 30, 42, 0, time.UTC)
+	tests := []struct {
+		json string
+		want time.Time
+	}{
+		{`{"date": "2021-02-15T09:30:42Z"}`, want},
+		{`{"date": "2021-02-15T10:30:42+01:00"}`, want},
+		{`{"date": "2021-02-15T10:30:42.000+0100"}`, want},
+		{`{"date": "2021-02-15 09:30:42"}`, want},
+		{`{"date": ""}`, time.Time{}},
+		{`{"date": null}`, time.Time{}},
+	}
+	for _, tt := range tests {
+		var h datatrans.History
+		must(t, json.Unmarshal([]byte(tt.json), &h))
+		if !h.Date.Equal(tt.want) {
+			t.Errorf("%s: want %s, have %s", tt.json, tt.want, h.Date)
+		}
+	}
+
+	var h datatrans.History
+	if err := json.Unmarshal([]byte(`{"date": "15.02.2021"}`), &h); err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestFlexTime_MarshalJSON(t *testing.T) {
+	data, err := json.Marshal(datatrans.ResponseInitialize{TransactionId: "210215103033478409"})
+	must(t, err)
+	if want := `{"transactionId":"210215103033478409","expires":null}`; string(data) != want {
+		t.Errorf("\nWant: %s\nHave: %s", want, data)
+	}
+	var ri datatrans.ResponseInitialize
+	must(t, json.Unmarshal(data, &ri))
+	if !ri.Expires.IsZero() {
+		t.Errorf("zero time not kept: %s", ri.Expires)
+	}
+
+	expires := time.Date(2021, 2, 15, 10, 0, 42, 0, time.UTC)
+	data, err = json.Marshal(datatrans.ResponseInitialize{Expires: datatrans.FlexTime{Time: expires}})
+	must(t, err)
+	if want := `{"expires":"2021-02-15T10:00:42Z"}`; string(data) != want {
+		t.Errorf("\nWant: %s\nHave: %s", want, data)
+	}
+	ri = datatrans.ResponseInitialize{}
+	must(t, json.Unmarshal(data, &ri))
+	if !ri.Expires.Equal(expires) {
+		t.Errorf("want %s, have %s", expires, ri.Expires)
+	}
+}
@@ -0,0 +1,83 @@
+package datatrans
+
+import (
+	"encoding/hex"
+	"errors"
+	"hash"
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+// idempotencyKeyTTL is the duration datatrans keeps idempotency keys.
+const idempotencyKeyTTL = 3 * time.Minute
+
+// idempotencyKeyRetention defines how long the first usage of a key is
+// remembered locally to detect expired retries.
+const idempotencyKeyRetention = time.Hour
+
+// ErrIdempotencyExpired gets returned if OptionRetry would re-send a request
+// with EnableIdempotency after datatrans has already forgotten its idempotency key. Sending
+// the request again would create a new operation, e.g. a double charge, in
+// case the first attempt succeeded. Check the transaction status before
+// retrying or use a new refno. Separate calls with the same request are not
+// affected, they start a new operation. The detection is advisory: the first usage of
+// a key is only tracked in memory of the current process, shared between
+// clones of a Client, and forgotten after one hour.
+var ErrIdempotencyExpired = errors.New("datatrans: idempotency key expired")
+
+// idempotencyKey derives the Idempotency-Key header from the request. Keys
+// are only sent with POST requests, so the method is not part of the hash and
+// the keys stay stable for retries across versions of this package.
+func idempotencyKey(internalID, host, path string, body []byte) string {
+	fh := idempotencyHash(internalID, host, path)
+	_, _ = fh.Write(body)
+	return hex.EncodeToString(fh.Sum(nil))
+}
+
+// idempotencyHash returns the hash of idempotencyKey without the body.
+func idempotencyHash(internalID, host, path string) hash.Hash64 {
+	fh := fnv.New64a()
+	_, _ = fh.Write([]byte(internalID + host + path))
+	return fh
+}
+
+// idempotencyKeys tracks when an idempotency key has been used first.
+type idempotencyKeys struct {
+	mu        sync.Mutex
+	firstUsed map[string]time.Time
+	lastPrune time.Time
+}
+
+// start records the first usage of key by a new call. A key which datatrans
+// has already forgotten counts as a new operation and restarts the TTL.
+func (ik *idempotencyKeys) start(key string, now time.Time) {
+	ik.mu.Lock()
+	defer ik.mu.Unlock()
+	if first, ok := ik.firstUsed[key]; ok && now.Sub(first) <= idempotencyKeyTTL {
+		return
+	}
+	if ik.firstUsed == nil {
+		ik.firstUsed = make(map[string]time.Time)
+	}
+	ik.firstUsed[key] = now
+	if now.Sub(ik.lastPrune) > idempotencyKeyTTL {
+		for k, first := range ik.firstUsed {
+			if now.Sub(first) > idempotencyKeyRetention {
+				delete(ik.firstUsed, k)
+			}
+		}
+		ik.lastPrune = now
+	}
+}
+
+// checkRetry returns ErrIdempotencyExpired if a retry of key would be sent
+// after the TTL of its first usage.
+func (ik *idempotencyKeys) checkRetry(key string, now time.Time) error {
+	ik.mu.Lock()
+	defer ik.mu.Unlock()
+	if first, ok := ik.firstUsed[key]; ok && now.Sub(first) > idempotencyKeyTTL {
+		return ErrIdempotencyExpired
+	}
+	return nil
+}
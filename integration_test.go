@@ -0,0 +1,121 @@
+//go:build integration
+// +build integration
+
+package datatrans_test
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/globusdigital/datatrans"
+)
+
+// The integration test runs against the datatrans sandbox and needs the
+// following environment variables:
+//
+//	DATATRANS_MERCHANT_ID  merchant ID of a sandbox account
+//	DATATRANS_PASSWORD     server to server password of that account
+//	DATATRANS_CARD_NUMBER  optional test card, defaults to 4242424242424242
+//
+// Run it with:
+//
+//	go test -tags integration -run Integration -v .
+//
+// Authorizing a plain card number requires that the sandbox account is allowed
+// to send card numbers, otherwise the authorization gets rejected.
+func TestIntegration_TransactionLifecycle(t *testing.T) {
+	merchantID, password := os.Getenv("DATATRANS_MERCHANT_ID"), os.Getenv("DATATRANS_PASSWORD")
+	if merchantID == "" || password == "" {
+		t.Skip("DATATRANS_MERCHANT_ID and DATATRANS_PASSWORD are required")
+	}
+	cardNumber := os.Getenv("DATATRANS_CARD_NUMBER")
+	if cardNumber == "" {
+		cardNumber = "4242424242424242"
+	}
+
+	c, err := datatrans.MakeClient(
+		datatrans.OptionMerchant{
+			Environment:       datatrans.EnvironmentSandbox,
+			EnableIdempotency: true,
+			MerchantID:        merchantID,
+			Password:          password,
+		},
+	)
+	must(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	refNo := "it-" + strconv.FormatInt(time.Now().UnixNano(), 36)
+
+	assertStatus := func(transactionID string, want ...string) *datatrans.ResponseStatus {
+		t.Helper()
+		rs, err := c.Status(ctx, transactionID)
+		must(t, err)
+		for _, w := range want {
+			if rs.Status == w {
+				return rs
+			}
+		}
+		t.Fatalf("transaction %s: want status %v, have %q", transactionID, want, rs.Status)
+		return nil
+	}
+
+	ri, err := c.Initialize(ctx, datatrans.RequestInitialize{
+		Currency: "CHF",
+		RefNo:    refNo + "-init",
+		Amount:   1000,
+		Redirect: &datatrans.Redirect{
+			SuccessUrl: "https://example.com/success",
+			CancelUrl:  "https://example.com/cancel",
+			ErrorUrl:   "https://example.com/error",
+		},
+	})
+	must(t, err)
+	if ri.TransactionId == "" || ri.Location == "" {
+		t.Fatalf("initialize: missing transaction ID or location: %#v", ri)
+	}
+	assertStatus(ri.TransactionId, datatrans.StatusInitialized)
+
+	expiry := time.Now().AddDate(2, 0, 0)
+	ra, err := c.Authorize(ctx, datatrans.RequestAuthorize{
+		Currency: "CHF",
+		RefNo:    refNo,
+		Amount:   1000,
+		CustomFields: datatrans.CustomFields{
+			"card": map[string]interface{}{
+				"number":      cardNumber,
+				"expiryMonth": expiry.Format("01"),
+				"expiryYear":  expiry.Format("06"),
+			},
+		},
+	})
+	must(t, err)
+	if ra.TransactionId == "" {
+		t.Fatalf("authorize: missing transaction ID: %#v", ra)
+	}
+	assertStatus(ra.TransactionId, datatrans.StatusAuthorized)
+
+	must(t, c.Settle(ctx, ra.TransactionId, datatrans.RequestSettle{
+		Amount:   1000,
+		Currency: "CHF",
+		RefNo:    refNo,
+	}))
+	assertStatus(ra.TransactionId, datatrans.StatusSettled, datatrans.StatusTransmitted)
+
+	rc, err := c.Credit(ctx, ra.TransactionId, datatrans.RequestCredit{
+		Amount:   400,
+		Currency: "CHF",
+		RefNo:    refNo + "-credit",
+	})
+	must(t, err)
+	if rc.TransactionId == "" {
+		t.Fatalf("credit: missing transaction ID: %#v", rc)
+	}
+	rs := assertStatus(rc.TransactionId, datatrans.StatusSettled, datatrans.StatusTransmitted)
+	if rs.Type != "credit" {
+		t.Errorf("credit: want type credit, have %q", rs.Type)
+	}
+}
@@ -0,0 +1,28 @@
+package datatrans
+
+// https://docs.datatrans.ch/docs/redirect-lightbox
+const (
+	lightboxScriptSandbox    = "https://pay.sandbox.datatrans.com/upp/payment/js/datatrans-2.0.0.js"
+	lightboxScriptProduction = "https://pay.datatrans.com/upp/payment/js/datatrans-2.0.0.js"
+)
+
+// LightboxConfig contains the values to render the Lightbox Mode snippet of
+// the payment page.
+type LightboxConfig struct {
+	ScriptURL     string `json:"scriptUrl"`
+	TransactionID string `json:"transactionId"`
+}
+
+// LightboxParams returns the Lightbox script URL of the environment of the
+// merchant and the transactionID returned by Initialize. ScriptURL is empty
+// if the internalID is unknown.
+func (c *Client) LightboxParams(internalID, transactionID string) LightboxConfig {
+	lc := LightboxConfig{TransactionID: transactionID}
+	switch c.Environment(internalID) {
+	case EnvironmentProduction:
+		lc.ScriptURL = lightboxScriptProduction
+	case EnvironmentSandbox:
+		lc.ScriptURL = lightboxScriptSandbox
+	}
+	return lc
+}
@@ -0,0 +1,37 @@
+package datatrans_test
+
+import (
+	"testing"
+
+	"github.com/globusdigital/datatrans"
+)
+
+func TestClient_LightboxParams(t *testing.T) {
+	c, err := datatrans.MakeClient(
+		datatrans.OptionMerchant{
+			InternalID:  "prod",
+			MerchantID:  "322342",
+			Environment: datatrans.EnvironmentProduction,
+		},
+		datatrans.OptionMerchant{
+			InternalID: "sandbox",
+			MerchantID: "322343",
+		},
+	)
+	must(t, err)
+
+	tests := []struct {
+		internalID string
+		want       string
+	}{
+		{"prod", "https://pay.datatrans.com/upp/payment/js/datatrans-2.0.0.js"},
+		{"sandbox", "https://pay.sandbox.datatrans.com/upp/payment/js/datatrans-2.0.0.js"},
+		{"unknown", ""},
+	}
+	for _, tt := range tests {
+		lc := c.LightboxParams(tt.internalID, "210215103033478409")
+		if lc.ScriptURL != tt.want || lc.TransactionID != "210215103033478409" {
+			t.Errorf("%s: invalid config: %#v", tt.internalID, lc)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package datatrans
+
+import (
+	"fmt"
+	"strings"
+)
+
+// EMV 3-D Secure limits the country code to 3 and the subscriber to 15 digits.
+const (
+	maxPhoneCcLen         = 3
+	maxPhoneSubscriberLen = 15
+)
+
+// ParsePhone splits an international phone number like "+41 79 123 45 67" or
+// "0041791234567" into the country calling code and the subscriber number as
+// used by HomePhone, MobilePhone and WorkPhone. Spaces, dashes, dots, slashes
+// and parentheses get removed.
+func ParsePhone(e164 string) (cc, subscriber string, err error) {
+	digits := stripPhoneFormatting(e164)
+	switch {
+	case strings.HasPrefix(digits, "+"):
+		digits = digits[1:]
+	case strings.HasPrefix(digits, "00"):
+		digits = digits[2:]
+	default:
+		return "", "", fmt.Errorf("phone number %q must start with + or 00", e164)
+	}
+	if digits == "" || !isDigits(digits) {
+		return "", "", fmt.Errorf("phone number %q must only contain digits", e164)
+	}
+	if len(digits) > 15 {
+		return "", "", fmt.Errorf("phone number %q exceeds 15 digits", e164)
+	}
+	ccLen := callingCodeLen(digits)
+	if len(digits) < ccLen+4 {
+		return "", "", fmt.Errorf("phone number %q is too short", e164)
+	}
+	return digits[:ccLen], digits[ccLen:], nil
+}
+
+// callingCodeLen returns the length of the ITU-T E.164 country calling code at
+// the start of digits. The zones 1 and 7 use one digit, the listed two digit
+// codes are assigned completely, all others use three digits.
+func callingCodeLen(digits string) int {
+	switch digits[0] {
+	case '1', '7':
+		return 1
+	}
+	if len(digits) < 2 {
+		return len(digits)
+	}
+	switch digits[:2] {
+	case "20", "27",
+		"30", "31", "32", "33", "34", "36", "39",
+		"40", "41", "43", "44", "45", "46", "47", "48", "49",
+		"51", "52", "53", "54", "55", "56", "57", "58",
+		"60", "61", "62", "63", "64", "65", "66",
+		"81", "82", "84", "86",
+		"90", "91", "92", "93", "94", "95", "98":
+		return 2
+	}
+	return 3
+}
+
+// stripPhoneFormatting removes the usual formatting characters of phone
+// numbers and a national trunk prefix written as "(0)".
+func stripPhoneFormatting(s string) string {
+	s = strings.Replace(s, "(0)", "", -1)
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '-', '.', '/', '(', ')', '\t':
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// normalizePhone removes the formatting of the subscriber and a leading + or
+// 00 of the country code.
+func normalizePhone(cc, subscriber *string) {
+	c := stripPhoneFormatting(*cc)
+	switch {
+	case strings.HasPrefix(c, "+"):
+		c = c[1:]
+	case strings.HasPrefix(c, "00"):
+		c = c[2:]
+	}
+	*cc = c
+	*subscriber = stripPhoneFormatting(*subscriber)
+}
+
+// validatePhone checks that both parts consist of digits within the limits of
+// EMV 3-D Secure.
+func validatePhone(v *validator, field, cc, subscriber string) {
+	if cc == "" && subscriber == "" {
+		return
+	}
+	if cc == "" || len(cc) > maxPhoneCcLen || !isDigits(cc) {
+		v.invalid(field+".cc", "must consist of 1 to 3 digits")
+	}
+	if subscriber == "" || len(subscriber) > maxPhoneSubscriberLen || !isDigits(subscriber) {
+		v.invalid(field+".subscriber", "must consist of 1 to 15 digits")
+	}
+}
+
+// Normalize removes the formatting of the phone number, see Cardholder.Normalize.
+func (p *HomePhone) Normalize() { normalizePhone(&p.Cc, &p.Subscriber) }
+
+// Normalize removes the formatting of the phone number, see Cardholder.Normalize.
+func (p *MobilePhone) Normalize() { normalizePhone(&p.Cc, &p.Subscriber) }
+
+// Normalize removes the formatting of the phone number, see Cardholder.Normalize.
+func (p *WorkPhone) Normalize() { normalizePhone(&p.Cc, &p.Subscriber) }
+
+// Normalize removes spaces, dashes, dots, slashes and parentheses from the
+// subscriber numbers and a leading + or 00 from the country codes of all
+// phone numbers, e.g. "+41" and "79 123 45 67" become "41" and "791234567".
+func (c *Cardholder) Normalize() {
+	if c.HomePhone != nil {
+		c.HomePhone.Normalize()
+	}
+	if c.MobilePhone != nil {
+		c.MobilePhone.Normalize()
+	}
+	if c.WorkPhone != nil {
+		c.WorkPhone.Normalize()
+	}
+}
+
+// normalizeCardholder returns card with normalized phones of the 3D cardholder.
+// The cardholder and its phones get copied so that the request of the caller
+// stays untouched.
+func normalizeCardholder(card *Card) *Card {
+	if card == nil || card.ThreeD.Cardholder == nil {
+		return card
+	}
+	ch := *card.ThreeD.Cardholder
+	if ch.HomePhone != nil {
+		p := *ch.HomePhone
+		ch.HomePhone = &p
+	}
+	if ch.MobilePhone != nil {
+		p := *ch.MobilePhone
+		ch.MobilePhone = &p
+	}
+	if ch.WorkPhone != nil {
+		p := *ch.WorkPhone
+		ch.WorkPhone = &p
+	}
+	ch.Normalize()
+	cc := *card
+	cc.ThreeD.Cardholder = &ch
+	return &cc
+}
@@ -0,0 +1,101 @@
+package datatrans_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/globusdigital/datatrans"
+)
+
+func TestParsePhone(t *testing.T) {
+	tests := []struct {
+		in             string
+		cc, subscriber string
+		wantErr        bool
+	}{
+		{in: "+41791234567", cc: "41", subscriber: "791234567"},
+		{in: "+41 79 123 45 67", cc: "41", subscriber: "791234567"},
+		{in: "+41 (0)79 123-45-67", cc: "41", subscriber: "791234567"},
+		{in: "0041 79/123.45.67", cc: "41", subscriber: "791234567"},
+		{in: "+1 (415) 555-2671", cc: "1", subscriber: "4155552671"},
+		{in: "+7 495 123 45 67", cc: "7", subscriber: "4951234567"},
+		{in: "+352 621 123 456", cc: "352", subscriber: "621123456"},
+		{in: "+423 234 56 78", cc: "423", subscriber: "2345678"},
+		{in: "079 123 45 67", wantErr: true},
+		{in: "+41 79 ABC", wantErr: true},
+		{in: "+41 79", wantErr: true},
+		{in: "+4179123456789012", wantErr: true},
+		{in: "+", wantErr: true},
+		{in: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		cc, subscriber, err := datatrans.ParsePhone(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%q: unexpected error: %v", tt.in, err)
+			continue
+		}
+		if cc != tt.cc || subscriber != tt.subscriber {
+			t.Errorf("%q: want %q %q, have %q %q", tt.in, tt.cc, tt.subscriber, cc, subscriber)
+		}
+	}
+}
+
+func TestCardholder_NormalizePhones(t *testing.T) {
+	ch := datatrans.Cardholder{
+		HomePhone:   &datatrans.HomePhone{Cc: "+41", Subscriber: "44 123 45 67"},
+		MobilePhone: &datatrans.MobilePhone{Cc: "0041", Subscriber: "(079) 123-45-67"},
+		WorkPhone:   &datatrans.WorkPhone{Cc: "41", Subscriber: "44.987.65.43"},
+	}
+	if err := ch.Validate(); err == nil {
+		t.Error("expected an error before normalizing")
+	}
+	ch.Normalize()
+	must(t, ch.Validate())
+	if *ch.HomePhone != (datatrans.HomePhone{Cc: "41", Subscriber: "441234567"}) ||
+		*ch.MobilePhone != (datatrans.MobilePhone{Cc: "41", Subscriber: "0791234567"}) ||
+		*ch.WorkPhone != (datatrans.WorkPhone{Cc: "41", Subscriber: "449876543"}) {
+		t.Errorf("invalid phones: %#v %#v %#v", ch.HomePhone, ch.MobilePhone, ch.WorkPhone)
+	}
+
+	ch.WorkPhone = &datatrans.WorkPhone{Cc: "4100", Subscriber: "1234567890123456"}
+	err := ch.Validate()
+	if want := "Cardholder: workPhone.cc must consist of 1 to 3 digits, workPhone.subscriber must consist of 1 to 15 digits"; err == nil || err.Error() != want {
+		t.Errorf("\nWant: %s\nHave: %v", want, err)
+	}
+}
+
+func TestClient_Authorize_StrictValidationCardholderPhones(t *testing.T) {
+	var body string
+	c, err := datatrans.MakeClient(
+		datatrans.OptionStrictValidation(true),
+		datatrans.OptionHTTPRequestFn(mockResponse(t, 200, `{"transactionId":"210215103042148501"}`, func(t *testing.T, req *http.Request) {
+			data, _ := ioutil.ReadAll(req.Body)
+			body = string(data)
+		})),
+		datatrans.OptionMerchant{
+			MerchantID: "322342",
+			Password:   "sfdgsdfg",
+		},
+	)
+	must(t, err)
+
+	ch := &datatrans.Cardholder{
+		MobilePhone: &datatrans.MobilePhone{Cc: "+41", Subscriber: "(079) 123-45-67"},
+	}
+	_, err = c.Authorize(context.Background(), datatrans.RequestAuthorize{
+		Currency: "CHF",
+		RefNo:    "872732",
+		Amount:   1337,
+		Card:     &datatrans.Card{ThreeD: datatrans.ThreeD{Cardholder: ch}},
+	})
+	must(t, err)
+	if want := `"mobilePhone":{"cc":"41","subscriber":"0791234567"}`; !strings.Contains(body, want) {
+		t.Errorf("want %s in body: %s", want, body)
+	}
+	if *ch.MobilePhone != (datatrans.MobilePhone{Cc: "+41", Subscriber: "(079) 123-45-67"}) {
+		t.Errorf("the cardholder of the caller must not change: %#v", ch.MobilePhone)
+	}
+}
@@ -0,0 +1,160 @@
+package datatrans
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// BatchError contains the error of one failed batch. Offset is the index of
+// the first sale of the batch in the input slice.
+type BatchError struct {
+	Offset int
+	Length int
+	Err    error
+}
+
+func (be BatchError) Error() string {
+	return fmt.Sprintf("sales[%d:%d]: %s", be.Offset, be.Offset+be.Length, be.Err)
+}
+
+func (be BatchError) Unwrap() error { return be.Err }
+
+// BulkError aggregates the errors of all failed batches.
+type BulkError []BatchError
+
+func (be BulkError) Error() string {
+	msgs := make([]string, len(be))
+	for i, e := range be {
+		msgs[i] = e.Error()
+	}
+	return fmt.Sprintf("%d batch(es) failed: %s", len(be), strings.Join(msgs, "; "))
+}
+
+// ReconciliationsSalesBulkStream reports bulk sales like ReconciliationsSalesBulk
+// but streams the JSON body to datatrans instead of marshaling all sales into
+// memory upfront. The requests get the same checks and headers as all other
+// requests, including the idempotency key, which is derived by encoding each
+// batch twice. Datatrans does not document a maximum number of sales per
+// request: batchSize splits the sales into requests of at most batchSize sales,
+// zero or less sends all sales in one request. All sales get checked against
+// OptionAmountBounds before the first request. All batches get sent, even if
+// one fails, unless ctx is done. The returned response contains the results of
+// all successful batches and the error is of type BulkError, the batches
+// skipped due to ctx are reported as one BatchError.
+func (c *Client) ReconciliationsSalesBulkStream(ctx context.Context, sales RequestReconciliationsSales, batchSize int) (*ResponseReconciliationsSales, error) {
+	if c.strictValidation {
+		if err := sales.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	m, _ := c.merchant(c.currentInternalID)
+	if err := m.AmountBounds.checkSales(sales.Sales); err != nil {
+		return nil, fmt.Errorf("ClientID:%q: %w", c.currentInternalID, err)
+	}
+	if batchSize <= 0 {
+		batchSize = len(sales.Sales)
+	}
+
+	var rrs ResponseReconciliationsSales
+	var bulkErr BulkError
+	for offset := 0; offset < len(sales.Sales); offset += batchSize {
+		end := offset + batchSize
+		if end > len(sales.Sales) {
+			end = len(sales.Sales)
+		}
+		if err := ctxErr(ctx, "next batch"); err != nil {
+			bulkErr = append(bulkErr, BatchError{Offset: offset, Length: len(sales.Sales) - offset, Err: err})
+			break
+		}
+		batch, err := c.reconciliationsSalesBulkStream(ctx, RequestReconciliationsSales{Sales: sales.Sales[offset:end]})
+		if err != nil {
+			bulkErr = append(bulkErr, BatchError{Offset: offset, Length: end - offset, Err: err})
+			continue
+		}
+		rrs.Sales = append(rrs.Sales, batch.Sales...)
+	}
+	if len(bulkErr) > 0 {
+		return &rrs, bulkErr
+	}
+	return &rrs, nil
+}
+
+func (c *Client) reconciliationsSalesBulkStream(ctx context.Context, sales RequestReconciliationsSales) (*ResponseReconciliationsSales, error) {
+	internalID := c.currentInternalID
+	postData, lang, err := c.prepareBody(sales)
+	if err != nil {
+		return nil, err
+	}
+	sales = postData.(RequestReconciliationsSales)
+
+	pr, pw := io.Pipe()
+	defer pr.Close() // unblocks the writer in case the body has not been consumed
+
+	req, err := c.newJSONReq(ctx, http.MethodPost, pathReconciliationsSalesBulk, pr, lang, func(w io.Writer) error {
+		return writeSalesJSON(w, sales.Sales)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		pw.CloseWithError(writeSalesJSON(pw, sales.Sales))
+	}()
+
+	var rrs ResponseReconciliationsSales
+	if err := c.do(req, &rrs); err != nil {
+		return nil, fmt.Errorf("ClientID:%q: failed to execute HTTP request: %w", internalID, err)
+	}
+	return &rrs, nil
+}
+
+// writeSalesJSON writes the same JSON as MarshalJSON for
+// RequestReconciliationsSales, one sale at a time.
+func writeSalesJSON(w io.Writer, sales []RequestReconciliationsSale) error {
+	if _, err := io.WriteString(w, `{"sales":[`); err != nil {
+		return err
+	}
+	for i, s := range sales {
+		if i > 0 {
+			if _, err := io.WriteString(w, ","); err != nil {
+				return err
+			}
+		}
+		data, err := json.Marshal(s)
+		if err != nil {
+			return fmt.Errorf("failed to marshal sales[%d]: %w", i, err)
+		}
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w, `]}`)
+	return err
+}
+
+// Totals sums the amounts of the sales per currency, e.g. to compare them with
+// the own bookkeeping before sending the batch. Use ValidateAmounts to detect
+// sales without amount or currency, Totals counts them as they are.
+func (r RequestReconciliationsSales) Totals() map[string]int {
+	totals := make(map[string]int)
+	for _, s := range r.Sales {
+		totals[s.Currency] += s.Amount
+	}
+	return totals
+}
+
+// ValidateAmounts checks that every sale has a non-zero amount and a
+// currency. Validate does not require them because datatrans matches sales by
+// transactionId.
+func (r RequestReconciliationsSales) ValidateAmounts() error {
+	v := validator{typ: "RequestReconciliationsSales"}
+	for i, s := range r.Sales {
+		v.required(fmt.Sprintf("sales[%d].amount", i), s.Amount != 0)
+		v.required(fmt.Sprintf("sales[%d].currency", i), s.Currency != "")
+	}
+	return v.err()
+}
@@ -0,0 +1,231 @@
+package datatrans_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/globusdigital/datatrans"
+)
+
+func makeSales(n int) datatrans.RequestReconciliationsSales {
+	var rs datatrans.RequestReconciliationsSales
+	for i := 0; i < n; i++ {
+		rs.Sales = append(rs.Sales, datatrans.RequestReconciliationsSale{
+			Date:          time.Date(2021, 2, 15, 9, 30, 42, 0, time.UTC),
+			TransactionID: strconv.Itoa(210215103042148501 + i),
+			Currency:      "CHF",
+			Amount:        1000 + i,
+			Type:          "payment",
+			Refno:         "refno-" + strconv.Itoa(i),
+		})
+	}
+	return rs
+}
+
+func TestClient_ReconciliationsSalesBulkStream(t *testing.T) {
+	var bodies, keys []string
+	c, err := datatrans.MakeClient(
+		datatrans.OptionHTTPRequestFn(func(req *http.Request) (*http.Response, error) {
+			var buf bytes.Buffer
+			buf.ReadFrom(req.Body)
+			bodies = append(bodies, buf.String())
+			keys = append(keys, req.Header.Get("Idempotency-Key"))
+
+			var sales datatrans.RequestReconciliationsSales
+			if err := json.Unmarshal(buf.Bytes(), &sales); err != nil {
+				t.Fatal(err)
+			}
+			var resp datatrans.ResponseReconciliationsSales
+			for _, s := range sales.Sales {
+				resp.Sales = append(resp.Sales, datatrans.ResponseReconciliationsSale{TransactionID: s.TransactionID, MatchResult: "MATCHED"})
+			}
+			data, _ := json.Marshal(resp)
+			return &http.Response{
+				StatusCode: 200,
+				Body:       ioutil.NopCloser(bytes.NewReader(data)),
+			}, nil
+		}),
+		datatrans.OptionMerchant{
+			MerchantID:        "322342",
+			Password:          "sfdgsdfg",
+			EnableIdempotency: true,
+		},
+	)
+	must(t, err)
+
+	t.Run("same bytes as buffered", func(t *testing.T) {
+		bodies, keys = nil, nil
+		sales := makeSales(3)
+		_, err := c.ReconciliationsSalesBulk(context.Background(), sales)
+		must(t, err)
+		rrs, err := c.ReconciliationsSalesBulkStream(context.Background(), sales, 0)
+		must(t, err)
+		if len(bodies) != 2 || bodies[0] != bodies[1] {
+			t.Errorf("bodies differ:\n%s\n%s", bodies[0], bodies[1])
+		}
+		if keys[0] == "" || keys[0] != keys[1] {
+			t.Errorf("idempotency keys differ: %q", keys)
+		}
+		if len(rrs.Sales) != 3 {
+			t.Errorf("invalid response: %#v", rrs)
+		}
+	})
+
+	t.Run("one request without batch size", func(t *testing.T) {
+		bodies = nil
+		_, err := c.ReconciliationsSalesBulkStream(context.Background(), makeSales(2500), 0)
+		must(t, err)
+		if len(bodies) != 1 {
+			t.Errorf("expected 1 request, got %d", len(bodies))
+		}
+	})
+
+	t.Run("batching", func(t *testing.T) {
+		bodies = nil
+		rrs, err := c.ReconciliationsSalesBulkStream(context.Background(), makeSales(2500), 1000)
+		must(t, err)
+		if len(bodies) != 3 {
+			t.Errorf("expected 3 batches, got %d", len(bodies))
+		}
+		if len(rrs.Sales) != 2500 || rrs.Sales[2499].TransactionID != strconv.Itoa(210215103042148501+2499) {
+			t.Errorf("invalid response with %d sales", len(rrs.Sales))
+		}
+	})
+}
+
+func TestClient_ReconciliationsSalesBulkStream_Error(t *testing.T) {
+	var calls int
+	c, err := datatrans.MakeClient(
+		datatrans.OptionHTTPRequestFn(func(req *http.Request) (*http.Response, error) {
+			calls++
+			if calls == 2 {
+				return &http.Response{
+					StatusCode: 500,
+					Body:       ioutil.NopCloser(strings.NewReader(`{"error": {"code": "SERVER_ERROR"}}`)),
+				}, nil
+			}
+			return &http.Response{
+				StatusCode: 200,
+				Body:       ioutil.NopCloser(strings.NewReader(`{"sales":[{"transactionId":"1"}]}`)),
+			}, nil
+		}),
+		datatrans.OptionMerchant{
+			MerchantID: "322342",
+			Password:   "sfdgsdfg",
+		},
+	)
+	must(t, err)
+
+	rrs, err := c.ReconciliationsSalesBulkStream(context.Background(), makeSales(2500), 1000)
+	bulkErr, ok := err.(datatrans.BulkError)
+	if !ok || len(bulkErr) != 1 || bulkErr[0].Offset != 1000 || bulkErr[0].Length != 1000 {
+		t.Fatalf("invalid error: %#v", err)
+	}
+	if calls != 3 || len(rrs.Sales) != 2 {
+		t.Errorf("all batches should have been sent: calls %d, sales %d", calls, len(rrs.Sales))
+	}
+}
+
+func TestClient_ReconciliationsSalesBulkStream_Canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var calls int
+	c, err := datatrans.MakeClient(
+		datatrans.OptionHTTPRequestFn(func(req *http.Request) (*http.Response, error) {
+			calls++
+			cancel()
+			ioutil.ReadAll(req.Body)
+			return &http.Response{
+				StatusCode: 200,
+				Body:       ioutil.NopCloser(strings.NewReader(`{"sales":[{"transactionId":"1"}]}`)),
+			}, nil
+		}),
+		datatrans.OptionMerchant{
+			MerchantID: "322342",
+			Password:   "sfdgsdfg",
+		},
+	)
+	must(t, err)
+
+	rrs, err := c.ReconciliationsSalesBulkStream(ctx, makeSales(2500), 1000)
+	bulkErr, ok := err.(datatrans.BulkError)
+	if !ok || len(bulkErr) != 1 || bulkErr[0].Offset != 1000 || bulkErr[0].Length != 1500 || !errors.Is(bulkErr[0], context.Canceled) {
+		t.Fatalf("invalid error: %#v", err)
+	}
+	if calls != 1 || len(rrs.Sales) != 1 {
+		t.Errorf("only the first batch should have been sent: calls %d, sales %d", calls, len(rrs.Sales))
+	}
+}
+
+func TestRequestReconciliationsSale_MarshalJSON(t *testing.T) {
+	zurich := time.FixedZone("CET", 3600)
+	data, err := json.Marshal(datatrans.RequestReconciliationsSale{
+		Date:          time.Date(2021, 2, 15, 10, 30, 42, 123456789, zurich),
+		TransactionID: "210215103042148501",
+		Currency:      "CHF",
+		Amount:        1000,
+		Type:          "payment",
+		Refno:         "872732",
+	})
+	must(t, err)
+	if want := `{"transactionId":"210215103042148501","currency":"CHF","amount":1000,"type":"payment","refno":"872732","date":"2021-02-15T09:30:42Z"}`; string(data) != want {
+		t.Errorf("\nWant: %s\nHave: %s", want, data)
+	}
+}
+
+func TestResponseReconciliationsSale_UnmarshalJSON(t *testing.T) {
+	var rrs datatrans.ResponseReconciliationsSales
+	must(t, json.Unmarshal([]byte(`{"sales":[
+		{"transactionId":"1","saleDate":"2021-02-15T09:30:42Z","reportedDate":"2021-02-16T08:00:00.123+0100","matchResult":"MATCHED"},
+		{"transactionId":"2","saleDate":"2021-02-15","reportedDate":"","matchResult":"NOT_MATCHED"}
+	]}`), &rrs))
+	if len(rrs.Sales) != 2 {
+		t.Fatalf("invalid sales: %#v", rrs)
+	}
+	s := rrs.Sales[0]
+	if s.TransactionID != "1" || s.MatchResult != "MATCHED" ||
+		!s.SaleDate.Equal(time.Date(2021, 2, 15, 9, 30, 42, 0, time.UTC)) ||
+		!s.ReportedDate.Equal(time.Date(2021, 2, 16, 7, 0, 0, 123000000, time.UTC)) {
+		t.Errorf("invalid sale: %#v", s)
+	}
+	s = rrs.Sales[1]
+	if !s.SaleDate.Equal(time.Date(2021, 2, 15, 0, 0, 0, 0, time.UTC)) || !s.ReportedDate.IsZero() {
+		t.Errorf("invalid sale: %#v", s)
+	}
+}
+
+func TestRequestReconciliationsSales_Totals(t *testing.T) {
+	sales := datatrans.RequestReconciliationsSales{Sales: []datatrans.RequestReconciliationsSale{
+		{TransactionID: "1", Currency: "CHF", Amount: 1000},
+		{TransactionID: "2", Currency: "EUR", Amount: 250},
+		{TransactionID: "3", Currency: "CHF", Amount: 500},
+		{TransactionID: "4", Currency: "USD", Amount: 99},
+		{TransactionID: "5", Currency: "EUR", Amount: -50},
+	}}
+	want := map[string]int{"CHF": 1500, "EUR": 200, "USD": 99}
+	if have := sales.Totals(); !reflect.DeepEqual(have, want) {
+		t.Errorf("want %v, have %v", want, have)
+	}
+	must(t, sales.ValidateAmounts())
+
+	sales.Sales = append(sales.Sales,
+		datatrans.RequestReconciliationsSale{TransactionID: "6", Currency: "CHF"},
+		datatrans.RequestReconciliationsSale{TransactionID: "7", Amount: 100},
+	)
+	err := sales.ValidateAmounts()
+	if want := "RequestReconciliationsSales: sales[5].amount required, sales[6].currency required"; err == nil || err.Error() != want {
+		t.Errorf("\nWant: %s\nHave: %v", want, err)
+	}
+	if have := sales.Totals(); have["CHF"] != 1500 || have[""] != 100 {
+		t.Errorf("invalid totals: %v", have)
+	}
+}
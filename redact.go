@@ -0,0 +1,247 @@
+package datatrans
+
+import "regexp"
+
+// redacted replaces values which must not be logged at all.
+const redacted = "[redacted]"
+
+// Masking levels for values which datatrans already returns masked, like the
+// card number in CardExtended.Masked, see OptionMaskedPANLevel and
+// CardExtended.RedactLevel.
+const (
+	MaskNone  = "none"  // keep the value as returned, e.g. 520000xxxxxx0080
+	MaskLast4 = "last4" // keep the last four characters, e.g. xxxxxxxxxxxx0080
+	MaskFull  = "full"  // mask all characters, e.g. xxxxxxxxxxxxxxxx
+)
+
+// maskLevel masks s according to level, unknown levels mask all characters.
+func maskLevel(s, level string) string {
+	switch level {
+	case MaskNone:
+		return s
+	case MaskLast4:
+		return maskLast4(s)
+	}
+	b := []byte(s)
+	for i := range b {
+		b[i] = 'x'
+	}
+	return string(b)
+}
+
+// maskLast4 replaces all but the last four characters of s with x, e.g.
+// 70119122433810042 becomes xxxxxxxxxxxxx0042. Values with four or fewer
+// characters get masked completely.
+func maskLast4(s string) string {
+	if s == "" {
+		return ""
+	}
+	keep := 4
+	if len(s) <= keep {
+		keep = 0
+	}
+	b := []byte(s)
+	for i := 0; i < len(b)-keep; i++ {
+		b[i] = 'x'
+	}
+	return string(b)
+}
+
+// aliasPattern matches the string values of alias keys in a JSON body,
+// maskedPattern the card numbers already masked by datatrans.
+var (
+	aliasPattern  = regexp.MustCompile(`"(alias|aliasCVV)"\s*:\s*"([^"]*)"`)
+	maskedPattern = regexp.MustCompile(`"(masked)"\s*:\s*"([^"]*)"`)
+)
+
+// redactBody masks card numbers according to level, all aliases to the last
+// four characters and removes the wallet payment tokens in a JSON body.
+// Returns a copy, body is not modified.
+func redactBody(body []byte, level string) []byte {
+	body = replaceValues(aliasPattern, redactPAN(body, level), maskLast4)
+	body = replaceValues(maskedPattern, body, func(s string) string { return maskLevel(s, level) })
+	return redactWallets(body)
+}
+
+// replaceValues replaces the second submatch of all matches of re in body
+// with the result of fn.
+func replaceValues(re *regexp.Regexp, body []byte, fn func(string) string) []byte {
+	return re.ReplaceAllFunc(body, func(match []byte) []byte {
+		sub := re.FindSubmatchIndex(match)
+		masked := append([]byte(nil), match[:sub[4]]...)
+		masked = append(masked, fn(string(match[sub[4]:sub[5]]))...)
+		return append(masked, match[sub[5]:]...)
+	})
+}
+
+// walletPattern matches the start of the Apple Pay and Google Pay objects in
+// a JSON body.
+var walletPattern = regexp.MustCompile(`"(APL|PAY)"\s*:\s*\{`)
+
+// walletTokenPattern matches the secret string values of ApplePayToken and
+// GooglePayToken, walletSignaturesPattern the signatures of the Google Pay
+// intermediate signing key.
+var (
+	walletTokenPattern      = regexp.MustCompile(`"(data|signature|signedMessage|signedKey|ephemeralPublicKey|wrappedKey)"\s*:\s*"(?:[^"\\]|\\.)*"`)
+	walletSignaturesPattern = regexp.MustCompile(`"signatures"\s*:\s*\[[^\]]*\]`)
+)
+
+// redactWallets replaces the payment tokens within the APL and PAY objects of
+// a JSON body, like the Redact methods of the requests do.
+func redactWallets(body []byte) []byte {
+	locs := walletPattern.FindAllIndex(body, -1)
+	if locs == nil {
+		return body
+	}
+	var out []byte
+	prev := 0
+	for _, loc := range locs {
+		start := loc[1] - 1
+		if start < prev {
+			continue
+		}
+		end := objectEnd(body, start)
+		obj := walletTokenPattern.ReplaceAll(body[start:end], []byte(`"$1":"`+redacted+`"`))
+		obj = walletSignaturesPattern.ReplaceAll(obj, []byte(`"signatures":["`+redacted+`"]`))
+		out = append(out, body[prev:start]...)
+		out = append(out, obj...)
+		prev = end
+	}
+	return append(out, body[prev:]...)
+}
+
+// objectEnd returns the index after the JSON object which starts at
+// body[start], or len(body) for an unterminated object.
+func objectEnd(body []byte, start int) int {
+	depth := 0
+	inString := false
+	for i := start; i < len(body); i++ {
+		switch b := body[i]; {
+		case inString && b == '\\':
+			i++
+		case b == '"':
+			inString = !inString
+		case inString:
+		case b == '{':
+			depth++
+		case b == '}':
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+	return len(body)
+}
+
+// Redact returns a copy safe for logging: Alias and AliasCVV are masked to
+// the last four characters.
+func (c Card) Redact() Card {
+	c.Alias = maskLast4(c.Alias)
+	c.AliasCVV = maskLast4(c.AliasCVV)
+	return c
+}
+
+// Redact returns a copy safe for logging: Alias, AliasCVV and Masked are
+// masked to the last four characters. Use RedactLevel for other levels of
+// Masked.
+func (c CardExtended) Redact() CardExtended {
+	return c.RedactLevel(MaskLast4)
+}
+
+// RedactLevel works like Redact but masks Masked with the given level, one of
+// MaskNone, MaskLast4 or MaskFull. Unknown levels mask all characters.
+func (c CardExtended) RedactLevel(level string) CardExtended {
+	c.Alias = maskLast4(c.Alias)
+	c.AliasCVV = maskLast4(c.AliasCVV)
+	c.Masked = maskLevel(c.Masked, level)
+	return c
+}
+
+func redactCard(c *Card) *Card {
+	if c == nil {
+		return nil
+	}
+	rc := c.Redact()
+	return &rc
+}
+
+func redactCardExtended(c *CardExtended) *CardExtended {
+	if c == nil {
+		return nil
+	}
+	rc := c.Redact()
+	return &rc
+}
+
+// redactPaymentMethods returns copies of the payment method parameters with
+// the wallet payment tokens removed and the aliases masked.
+func redactPaymentMethods(apl *ApplePay, pay *GooglePay, pap *PayPal, kln *Klarna, twi *TWINT) (*ApplePay, *GooglePay, *PayPal, *Klarna, *TWINT) {
+	if apl != nil {
+		c := *apl
+		c.Token.Data, c.Token.Signature, c.Token.Header = redacted, redacted, nil
+		apl = &c
+	}
+	if pay != nil {
+		c := *pay
+		c.Token.SignedMessage, c.Token.Signature, c.Token.IntermediateSigningKey = redacted, redacted, nil
+		pay = &c
+	}
+	if pap != nil {
+		c := *pap
+		c.Alias = maskLast4(c.Alias)
+		pap = &c
+	}
+	if kln != nil {
+		kln = &Klarna{Alias: maskLast4(kln.Alias)}
+	}
+	if twi != nil {
+		twi = &TWINT{Alias: maskLast4(twi.Alias)}
+	}
+	return apl, pay, pap, kln, twi
+}
+
+// Redact returns a copy safe for logging: card and payment method aliases
+// are masked and wallet payment tokens removed. CustomFields are kept as is.
+func (r RequestAuthorize) Redact() RequestAuthorize {
+	r.Card = redactCard(r.Card)
+	r.APL, r.PAY, r.PAP, r.KLN, r.TWI = redactPaymentMethods(r.APL, r.PAY, r.PAP, r.KLN, r.TWI)
+	return r
+}
+
+// Redact returns a copy safe for logging: card and payment method aliases
+// are masked and wallet payment tokens removed. CustomFields are kept as is.
+func (r RequestInitialize) Redact() RequestInitialize {
+	r.Card = redactCard(r.Card)
+	r.APL, r.PAY, r.PAP, r.KLN, r.TWI = redactPaymentMethods(r.APL, r.PAY, r.PAP, r.KLN, r.TWI)
+	return r
+}
+
+// Redact returns a copy safe for logging with the card aliases masked.
+func (r RequestValidateAlias) Redact() RequestValidateAlias {
+	r.Card = redactCard(r.Card)
+	return r
+}
+
+// Redact returns a copy safe for logging with the card aliases masked.
+func (r RequestCreditAuthorize) Redact() RequestCreditAuthorize {
+	r.Card = redactCard(r.Card)
+	return r
+}
+
+// Redact returns a copy safe for logging: the card is masked and the raw
+// JSON body, which contains the unmasked values, gets removed.
+func (rs ResponseStatus) Redact() ResponseStatus {
+	rs.Card = redactCardExtended(rs.Card)
+	rs.RawJSONBody = nil
+	return rs
+}
+
+// Redact returns a copy safe for logging: the alias and card are masked and
+// the raw JSON body gets removed.
+func (r ResponseAliasConvert) Redact() ResponseAliasConvert {
+	r.Alias = maskLast4(r.Alias)
+	r.Card = redactCardExtended(r.Card)
+	r.RawJSONBody = nil
+	return r
+}
@@ -0,0 +1,129 @@
+package datatrans_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/globusdigital/datatrans"
+)
+
+func TestRequestAuthorize_Redact(t *testing.T) {
+	req := datatrans.RequestAuthorize{
+		Amount:   1337,
+		Currency: "CHF",
+		RefNo:    "872732",
+		Card: &datatrans.Card{
+			Alias:       "70119122433810042",
+			AliasCVV:    "CVV7011912243381",
+			ExpiryMonth: "12",
+			ExpiryYear:  "21",
+		},
+		PAY: &datatrans.GooglePay{Token: datatrans.GooglePayToken{ProtocolVersion: "ECv2", SignedMessage: "secret"}},
+	}
+	rr := req.Redact()
+
+	if req.Card.Alias != "70119122433810042" || req.PAY.Token.SignedMessage != "secret" {
+		t.Error("original must not be modified")
+	}
+	if rr.Card.Alias != "xxxxxxxxxxxxx0042" || rr.Card.AliasCVV != "xxxxxxxxxxxx3381" {
+		t.Errorf("card not masked: %#v", rr.Card)
+	}
+	if rr.Amount != 1337 || rr.Currency != "CHF" || rr.RefNo != "872732" || rr.Card.ExpiryMonth != "12" || rr.PAY.Token.ProtocolVersion != "ECv2" {
+		t.Errorf("non sensitive fields modified: %#v", rr)
+	}
+	if s := fmt.Sprintf("%+v %+v", rr.Card, rr.PAY); strings.Contains(s, "70119122433810042") || strings.Contains(s, "secret") {
+		t.Errorf("sensitive value leaked: %s", s)
+	}
+}
+
+func TestRequestInitialize_Redact(t *testing.T) {
+	req := datatrans.RequestInitialize{
+		Currency: "CHF",
+		RefNo:    "872732",
+		Amount:   1337,
+		Card:     &datatrans.Card{Alias: "70119122433810042"},
+		APL:      &datatrans.ApplePay{Token: datatrans.ApplePayToken{Version: "EC_v1", Data: "apl-secret", Signature: "apl-signature"}},
+		PAY:      &datatrans.GooglePay{Token: datatrans.GooglePayToken{ProtocolVersion: "ECv2", SignedMessage: "pay-secret", Signature: "pay-signature"}},
+		PAP:      &datatrans.PayPal{Alias: "B-5XK96311NV397871M", ImageURL: "https://example.com/logo.png"},
+		KLN:      &datatrans.Klarna{Alias: "KLN9876543210"},
+		TWI:      &datatrans.TWINT{Alias: "TWI1234567890"},
+	}
+	rr := req.Redact()
+
+	if req.APL.Token.Data != "apl-secret" || req.PAY.Token.SignedMessage != "pay-secret" || req.PAP.Alias != "B-5XK96311NV397871M" ||
+		req.KLN.Alias != "KLN9876543210" || req.TWI.Alias != "TWI1234567890" {
+		t.Error("original must not be modified")
+	}
+	if rr.Card.Alias != "xxxxxxxxxxxxx0042" {
+		t.Errorf("card not masked: %#v", rr.Card)
+	}
+	if rr.APL.Token.Data == "apl-secret" || rr.APL.Token.Signature == "apl-signature" || rr.APL.Token.Version != "EC_v1" {
+		t.Errorf("APL not redacted: %#v", rr.APL)
+	}
+	if rr.PAY.Token.SignedMessage == "pay-secret" || rr.PAY.Token.Signature == "pay-signature" || rr.PAY.Token.ProtocolVersion != "ECv2" {
+		t.Errorf("PAY not redacted: %#v", rr.PAY)
+	}
+	if rr.PAP.Alias != "xxxxxxxxxxxxxxx871M" || rr.PAP.ImageURL != "https://example.com/logo.png" {
+		t.Errorf("PAP not masked: %#v", rr.PAP)
+	}
+	if rr.KLN.Alias != "xxxxxxxxx3210" {
+		t.Errorf("KLN not masked: %#v", rr.KLN)
+	}
+	if rr.TWI.Alias != "xxxxxxxxx7890" {
+		t.Errorf("TWI not masked: %#v", rr.TWI)
+	}
+	if s := fmt.Sprintf("%+v %+v %+v %+v %+v", rr.APL, rr.PAY, rr.PAP, rr.KLN, rr.TWI); strings.Contains(s, "secret") ||
+		strings.Contains(s, "signature") || strings.Contains(s, "5XK963") || strings.Contains(s, "987654") || strings.Contains(s, "123456") {
+		t.Errorf("sensitive value leaked: %s", s)
+	}
+}
+
+func TestResponseStatus_Redact(t *testing.T) {
+	rs := datatrans.ResponseStatus{
+		TransactionID: "210215103042148501",
+		Card: &datatrans.CardExtended{
+			Alias:  "70119122433810042",
+			Masked: "424242xxxxxx4242",
+			Info:   &datatrans.CardExtendedInfo{Brand: "VISA CREDIT"},
+		},
+		RawJSONBody: datatrans.RawJSONBody(`{"card":{"alias":"70119122433810042"}}`),
+	}
+	rr := rs.Redact()
+	if rr.TransactionID != "210215103042148501" || rr.Card.Info.Brand != "VISA CREDIT" {
+		t.Errorf("non sensitive fields modified: %#v", rr)
+	}
+	if rr.Card.Alias != "xxxxxxxxxxxxx0042" || rr.Card.Masked != "xxxxxxxxxxxx4242" || rr.RawJSONBody != nil {
+		t.Errorf("not redacted: %#v", rr)
+	}
+	if rs.Card.Alias != "70119122433810042" {
+		t.Error("original must not be modified")
+	}
+}
+
+func TestCardExtended_RedactLevel(t *testing.T) {
+	card := datatrans.CardExtended{Alias: "70119122433810042", Masked: "520000xxxxxx0080", ExpiryMonth: "12"}
+	tests := []struct {
+		level      string
+		wantMasked string
+	}{
+		{level: datatrans.MaskNone, wantMasked: "520000xxxxxx0080"},
+		{level: datatrans.MaskLast4, wantMasked: "xxxxxxxxxxxx0080"},
+		{level: datatrans.MaskFull, wantMasked: "xxxxxxxxxxxxxxxx"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.level, func(t *testing.T) {
+			rc := card.RedactLevel(tt.level)
+			if rc.Masked != tt.wantMasked {
+				t.Errorf("want masked %q, have %q", tt.wantMasked, rc.Masked)
+			}
+			if rc.Alias != "xxxxxxxxxxxxx0042" || rc.ExpiryMonth != "12" {
+				t.Errorf("invalid other fields: %#v", rc)
+			}
+		})
+	}
+
+	if rc := card.Redact(); rc.Masked != "xxxxxxxxxxxx0080" {
+		t.Errorf("default must be last4, have %q", rc.Masked)
+	}
+}
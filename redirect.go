@@ -0,0 +1,61 @@
+package datatrans
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// ErrMissingTransactionID gets returned by TransactionIDFromReturn if the
+// request does not contain the datatransTrxId parameter.
+var ErrMissingTransactionID = errors.New("missing parameter datatransTrxId")
+
+// ErrMissingLocation gets returned by ResponseInitialize.RedirectURLWith if
+// datatrans did not return a Location, e.g. in Lightbox Mode.
+var ErrMissingLocation = errors.New("missing Location, not in redirect mode")
+
+// RedirectURLWith returns the Location of the payment page with params added
+// to its query string, e.g. for tracking. The parameters of datatrans are
+// preserved, a param which already exists in Location returns an error.
+func (ri ResponseInitialize) RedirectURLWith(params url.Values) (string, error) {
+	if ri.Location == "" {
+		return "", ErrMissingLocation
+	}
+	u, err := url.Parse(ri.Location)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse Location %q: %w", ri.Location, err)
+	}
+	q := u.Query()
+	for k, vs := range params {
+		if _, ok := q[k]; ok {
+			return "", fmt.Errorf("param %q already set by datatrans", k)
+		}
+		q[k] = vs
+	}
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// TransactionIDFromReturn extracts the transaction ID which datatrans adds to
+// the success, cancel or error URL when redirecting the customer back, see
+// Redirect.Method. With GET the ID is part of the query string, with POST it
+// is part of the form encoded body.
+func TransactionIDFromReturn(r *http.Request) (string, error) {
+	var id string
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		id = r.URL.Query().Get("datatransTrxId")
+	case http.MethodPost:
+		if err := r.ParseForm(); err != nil {
+			return "", fmt.Errorf("failed to parse return form: %w", err)
+		}
+		id = r.PostForm.Get("datatransTrxId")
+	default:
+		return "", fmt.Errorf("unsupported return method %s", r.Method)
+	}
+	if id == "" {
+		return "", ErrMissingTransactionID
+	}
+	return id, nil
+}
@@ -0,0 +1,57 @@
+package datatrans_test
+
+import (
+	"errors"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/globusdigital/datatrans"
+)
+
+func TestTransactionIDFromReturn(t *testing.T) {
+	t.Run("GET", func(t *testing.T) {
+		r := httptest.NewRequest("GET", "/success?order=4711&datatransTrxId=210215103033478409", nil)
+		id, err := datatrans.TransactionIDFromReturn(r)
+		must(t, err)
+		if id != "210215103033478409" {
+			t.Errorf("invalid ID: %q", id)
+		}
+	})
+
+	t.Run("POST", func(t *testing.T) {
+		r := httptest.NewRequest("POST", "/success", strings.NewReader("order=4711&datatransTrxId=210215103033478409"))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		id, err := datatrans.TransactionIDFromReturn(r)
+		must(t, err)
+		if id != "210215103033478409" {
+			t.Errorf("invalid ID: %q", id)
+		}
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		r := httptest.NewRequest("GET", "/success?order=4711", nil)
+		if _, err := datatrans.TransactionIDFromReturn(r); !errors.Is(err, datatrans.ErrMissingTransactionID) {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+}
+
+func TestResponseInitialize_RedirectURLWith(t *testing.T) {
+	ri := datatrans.ResponseInitialize{Location: "https://pay.sandbox.datatrans.com/v1/start/210215103033478409?lang=de"}
+
+	u, err := ri.RedirectURLWith(url.Values{"utm_source": {"newsletter"}, "cart": {"a b"}})
+	must(t, err)
+	if want := "https://pay.sandbox.datatrans.com/v1/start/210215103033478409?cart=a+b&lang=de&utm_source=newsletter"; u != want {
+		t.Errorf("\nWant: %s\nHave: %s", want, u)
+	}
+
+	if _, err := ri.RedirectURLWith(url.Values{"lang": {"en"}}); err == nil {
+		t.Error("expected an error for an overwritten param")
+	}
+
+	if _, err := (datatrans.ResponseInitialize{}).RedirectURLWith(nil); !errors.Is(err, datatrans.ErrMissingLocation) {
+		t.Errorf("expected ErrMissingLocation, got: %v", err)
+	}
+}
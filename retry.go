@@ -0,0 +1,168 @@
+package datatrans
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Jitter randomizes the backoff between two attempts so that clients do not
+// retry in lockstep once datatrans recovers.
+type Jitter func(backoff time.Duration) time.Duration
+
+var (
+	jitterMu   sync.Mutex
+	jitterRand = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+func randDuration(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	jitterMu.Lock()
+	defer jitterMu.Unlock()
+	return time.Duration(jitterRand.Int63n(int64(max) + 1))
+}
+
+// FullJitter waits a random duration between zero and the backoff. This is
+// the default.
+func FullJitter(backoff time.Duration) time.Duration { return randDuration(backoff) }
+
+// EqualJitter waits at least half of the backoff plus a random duration up to
+// the other half.
+func EqualJitter(backoff time.Duration) time.Duration {
+	return backoff/2 + randDuration(backoff-backoff/2)
+}
+
+// NoJitter waits exactly the backoff.
+func NoJitter(backoff time.Duration) time.Duration { return backoff }
+
+// OptionRetry retries requests which failed because of a network error, a
+// timeout (408), rate limiting (429) or a server error (5xx). Only requests
+// which can safely be sent again get retried: GET and DELETE requests and
+// POST requests with an Idempotency-Key, see OptionMerchant.EnableIdempotency.
+// The backoff doubles with every attempt, starting at BaseDelay and capped at
+// MaxDelay, and gets randomized by Jitter. A Retry-After header of the server
+// takes precedence if it is longer than the backoff. No retry takes place if
+// the wait would exceed the deadline of the context.
+type OptionRetry struct {
+	MaxAttempts int           // including the first attempt, default 3
+	BaseDelay   time.Duration // default 200ms
+	MaxDelay    time.Duration // default 10s
+	Jitter      Jitter        // default FullJitter
+}
+
+func (o OptionRetry) apply(c *Client) error {
+	if o.MaxAttempts == 0 {
+		o.MaxAttempts = 3
+	}
+	if o.BaseDelay == 0 {
+		o.BaseDelay = 200 * time.Millisecond
+	}
+	if o.MaxDelay == 0 {
+		o.MaxDelay = 10 * time.Second
+	}
+	if o.Jitter == nil {
+		o.Jitter = FullJitter
+	}
+	c.retry = &o
+	return nil
+}
+
+// backoff returns the randomized wait before the next attempt.
+func (o OptionRetry) backoff(attempt int) time.Duration {
+	d := o.BaseDelay
+	for i := 1; i < attempt && d < o.MaxDelay; i++ {
+		d *= 2
+	}
+	if d > o.MaxDelay {
+		d = o.MaxDelay
+	}
+	return o.Jitter(d)
+}
+
+// send executes the request and retries it according to OptionRetry.
+func (c *Client) send(req *http.Request) (*http.Response, error) {
+	resp, err := c.doFn(req)
+	if c.retry == nil || !isRetryableRequest(req) {
+		return resp, err
+	}
+	ctx := req.Context()
+	for attempt := 1; attempt < c.retry.MaxAttempts && shouldRetry(ctx, resp, err); attempt++ {
+		delay := c.retry.backoff(attempt)
+		if ra, ok := retryAfter(resp, c.clock.Now()); ok && ra > delay {
+			delay = ra
+		}
+		if dl, ok := ctx.Deadline(); ok && c.clock.Now().Add(delay).After(dl) {
+			break
+		}
+		closeResponse(resp)
+		if err := c.clock.Sleep(ctx, delay); err != nil {
+			return nil, err
+		}
+		if key := req.Header.Get("Idempotency-Key"); key != "" {
+			if err := c.idempotencyKeys.checkRetry(key, c.clock.Now()); err != nil {
+				return nil, err
+			}
+		}
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(ctx)
+			req.Body = body
+		}
+		resp, err = c.doFn(req)
+	}
+	return resp, err
+}
+
+// isRetryableRequest reports whether the request is idempotent and its body
+// can be sent again.
+func isRetryableRequest(req *http.Request) bool {
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false
+	}
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodDelete:
+		return true
+	}
+	return req.Header.Get("Idempotency-Key") != ""
+}
+
+func shouldRetry(ctx context.Context, resp *http.Response, err error) bool {
+	if err != nil {
+		return ctx.Err() == nil
+	}
+	switch resp.StatusCode {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests:
+		return true
+	}
+	return resp.StatusCode >= http.StatusInternalServerError
+}
+
+// retryAfter parses the Retry-After header, either in seconds or as HTTP
+// date.
+func retryAfter(resp *http.Response, now time.Time) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+	v := resp.Header.Get("Retry-After")
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := t.Sub(now); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
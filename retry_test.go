@@ -0,0 +1,126 @@
+package datatrans
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// retryClient returns a client answering with the given responses in order
+// and using fc instead of waiting.
+func retryClient(t *testing.T, fc *fakeClock, opt OptionRetry, enableIdempotency bool, responses ...*http.Response) (*Client, *int) {
+	t.Helper()
+	var calls int
+	c, err := MakeClient(
+		opt,
+		optionClock{fc},
+		OptionHTTPRequestFn(func(req *http.Request) (*http.Response, error) {
+			resp := responses[calls]
+			calls++
+			if resp == nil {
+				return nil, context.DeadlineExceeded // transport error
+			}
+			return resp, nil
+		}),
+		OptionMerchant{
+			EnableIdempotency: enableIdempotency,
+			MerchantID:        "322342",
+			Password:          "sfdgsdfg",
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &c, &calls
+}
+
+func testResponse(status int, retryAfter string) *http.Response {
+	resp := &http.Response{
+		StatusCode: status,
+		Header:     http.Header{},
+		Body:       ioutil.NopCloser(strings.NewReader(`{"transactionId":"210215103042148501"}`)),
+	}
+	if status >= 300 {
+		resp.Body = ioutil.NopCloser(strings.NewReader(`{"error":{"code":"SERVER_ERROR"}}`))
+	}
+	if retryAfter != "" {
+		resp.Header.Set("Retry-After", retryAfter)
+	}
+	return resp
+}
+
+func TestOptionRetry_Backoff(t *testing.T) {
+	fc := newFakeClock(time.Now())
+	c, calls := retryClient(t, fc, OptionRetry{BaseDelay: 100 * time.Millisecond, Jitter: NoJitter}, false,
+		testResponse(503, ""), nil, testResponse(200, ""))
+	if _, err := c.Status(context.Background(), "210215103042148501"); err != nil {
+		t.Fatal(err)
+	}
+	if want := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond}; !reflect.DeepEqual(fc.sleeps, want) {
+		t.Errorf("invalid sleeps: %v", fc.sleeps)
+	}
+	if *calls != 3 {
+		t.Errorf("invalid number of calls: %d", *calls)
+	}
+}
+
+func TestOptionRetry_RetryAfter(t *testing.T) {
+	fc := newFakeClock(time.Now())
+	c, _ := retryClient(t, fc, OptionRetry{BaseDelay: 100 * time.Millisecond}, false,
+		testResponse(429, "5"), testResponse(503, "0"), testResponse(200, ""))
+	if _, err := c.Status(context.Background(), "210215103042148501"); err != nil {
+		t.Fatal(err)
+	}
+	if len(fc.sleeps) != 2 || fc.sleeps[0] != 5*time.Second || fc.sleeps[1] > 200*time.Millisecond {
+		t.Errorf("Retry-After not respected: %v", fc.sleeps)
+	}
+
+	// waiting for Retry-After would exceed the deadline
+	fc = newFakeClock(time.Now())
+	c, calls := retryClient(t, fc, OptionRetry{}, false, testResponse(503, "5"), testResponse(200, ""))
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := c.Status(ctx, "210215103042148501"); err == nil {
+		t.Error("expected the server error")
+	}
+	if len(fc.sleeps) != 0 || *calls != 1 {
+		t.Errorf("should not retry beyond the deadline: %v %d", fc.sleeps, *calls)
+	}
+}
+
+func TestOptionRetry_NotIdempotent(t *testing.T) {
+	c, calls := retryClient(t, newFakeClock(time.Now()), OptionRetry{}, false, testResponse(503, ""), testResponse(200, ""))
+	if err := c.Cancel(context.Background(), "210215103042148501", "872732"); err == nil {
+		t.Error("expected the server error")
+	}
+	if *calls != 1 {
+		t.Errorf("POST without Idempotency-Key must not be retried: %d calls", *calls)
+	}
+
+	c, calls = retryClient(t, newFakeClock(time.Now()), OptionRetry{}, true, testResponse(503, ""), testResponse(204, ""))
+	if err := c.Cancel(context.Background(), "210215103042148501", "872732"); err != nil {
+		t.Fatal(err)
+	}
+	if *calls != 2 {
+		t.Errorf("POST with Idempotency-Key should be retried: %d calls", *calls)
+	}
+}
+
+func TestJitter(t *testing.T) {
+	const backoff = 100 * time.Millisecond
+	for i := 0; i < 1000; i++ {
+		if d := FullJitter(backoff); d < 0 || d > backoff {
+			t.Fatalf("FullJitter out of bounds: %s", d)
+		}
+		if d := EqualJitter(backoff); d < backoff/2 || d > backoff {
+			t.Fatalf("EqualJitter out of bounds: %s", d)
+		}
+	}
+	if d := (OptionRetry{BaseDelay: time.Second, MaxDelay: 3 * time.Second, Jitter: NoJitter}).backoff(5); d != 3*time.Second {
+		t.Errorf("backoff not capped: %s", d)
+	}
+}
@@ -0,0 +1,18 @@
+package datatrans
+
+// SecureFieldsJSConfig contains the values the Secure Fields browser SDK needs
+// to initialize the fields, see https://docs.datatrans.ch/docs/secure-fields.
+// Serialize it to JSON and hand it to the frontend.
+type SecureFieldsJSConfig struct {
+	MerchantID    string `json:"merchantId"`
+	TransactionID string `json:"transactionId"`
+}
+
+// SecureFieldsConfig returns the browser SDK config for a transaction created
+// with Client.SecureFieldsInit.
+func (ri ResponseInitialize) SecureFieldsConfig(merchantID string) SecureFieldsJSConfig {
+	return SecureFieldsJSConfig{
+		MerchantID:    merchantID,
+		TransactionID: ri.TransactionId,
+	}
+}
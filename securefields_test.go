@@ -0,0 +1,98 @@
+package datatrans_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/globusdigital/datatrans"
+)
+
+func TestResponseInitialize_SecureFieldsConfig(t *testing.T) {
+	ri := datatrans.ResponseInitialize{TransactionId: "210215103033478409"}
+	data, err := json.Marshal(ri.SecureFieldsConfig("1100012345"))
+	must(t, err)
+	if want := `{"merchantId":"1100012345","transactionId":"210215103033478409"}`; string(data) != want {
+		t.Errorf("\nWant: %s\nHave: %s", want, data)
+	}
+}
+
+func TestClient_SecureFieldsIdempotencyKey(t *testing.T) {
+	keys := map[string]string{}
+	c, err := datatrans.MakeClient(
+		datatrans.OptionHTTPRequestFn(func(req *http.Request) (*http.Response, error) {
+			keys[req.Method] = req.Header.Get("Idempotency-Key")
+			return &http.Response{
+				StatusCode: 200,
+				Body:       ioutil.NopCloser(strings.NewReader(`{"transactionId":"210215103033478409"}`)),
+			}, nil
+		}),
+		datatrans.OptionMerchant{
+			EnableIdempotency: true,
+			MerchantID:        "322342",
+			Password:          "sfdgsdfg",
+		},
+	)
+	must(t, err)
+
+	_, err = c.SecureFieldsInit(context.Background(), datatrans.RequestSecureFieldsInit{Amount: 1337, Currency: "CHF", ReturnUrl: "https://example.com/return"})
+	must(t, err)
+	must(t, c.SecureFieldsUpdate(context.Background(), "210215103033478409", datatrans.RequestSecureFieldsUpdate{Amount: 1337, Currency: "CHF"}))
+	if keys[http.MethodPost] == "" {
+		t.Error("the POST request must carry an Idempotency-Key")
+	}
+	if k, ok := keys[http.MethodPatch]; !ok || k != "" {
+		t.Errorf("the PATCH request must not carry an Idempotency-Key: %q", k)
+	}
+}
+
+func TestClient_SecureFieldsUpdateCheck(t *testing.T) {
+	newClient := func(status datatrans.Status, calls *[]string) datatrans.Client {
+		c, err := datatrans.MakeClient(
+			datatrans.OptionSecureFieldsUpdateCheck(true),
+			datatrans.OptionHTTPRequestFn(func(req *http.Request) (*http.Response, error) {
+				*calls = append(*calls, req.Method+" "+req.URL.Path)
+				if req.Method == http.MethodGet {
+					return &http.Response{
+						StatusCode: 200,
+						Body:       ioutil.NopCloser(strings.NewReader(`{"status":"` + string(status) + `"}`)),
+					}, nil
+				}
+				return &http.Response{StatusCode: 204, Body: ioutil.NopCloser(strings.NewReader(""))}, nil
+			}),
+			datatrans.OptionMerchant{
+				MerchantID: "322342",
+				Password:   "sfdgsdfg",
+			},
+		)
+		must(t, err)
+		return c
+	}
+	rsu := datatrans.RequestSecureFieldsUpdate{Amount: 1337, Currency: "CHF"}
+
+	t.Run("initialized", func(t *testing.T) {
+		var calls []string
+		c := newClient(datatrans.StatusInitialized, &calls)
+		must(t, c.SecureFieldsUpdate(context.Background(), "210215103033478409", rsu))
+		want := "GET /v1/transactions/210215103033478409,PATCH /v1/transactions/secureFields/210215103033478409"
+		if s := strings.Join(calls, ","); s != want {
+			t.Errorf("invalid calls: %q", s)
+		}
+	})
+
+	t.Run("authenticated", func(t *testing.T) {
+		var calls []string
+		c := newClient(datatrans.StatusAuthenticated, &calls)
+		err := c.SecureFieldsUpdate(context.Background(), "210215103033478409", rsu)
+		if !errors.Is(err, datatrans.ErrSecureFieldsUpdateNotAllowed) {
+			t.Errorf("expected ErrSecureFieldsUpdateNotAllowed, got: %v", err)
+		}
+		if len(calls) != 1 {
+			t.Errorf("update should not be sent: %q", calls)
+		}
+	})
+}
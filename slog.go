@@ -0,0 +1,73 @@
+//go:build go1.21
+// +build go1.21
+
+package datatrans
+
+import "log/slog"
+
+// The log/slog package is only available since Go 1.21, older versions can use
+// the Redact methods.
+
+// LogValue implements slog.LogValuer and logs the card with masked aliases.
+func (c Card) LogValue() slog.Value {
+	c = c.Redact()
+	return slog.GroupValue(
+		slog.String("alias", c.Alias),
+		slog.String("aliasCVV", c.AliasCVV),
+		slog.String("expiryMonth", c.ExpiryMonth),
+		slog.String("expiryYear", c.ExpiryYear),
+	)
+}
+
+// LogValue implements slog.LogValuer and logs the card with masked aliases,
+// the card number gets masked to the last four digits.
+func (c CardExtended) LogValue() slog.Value {
+	c = c.Redact()
+	attrs := []slog.Attr{
+		slog.String("alias", c.Alias),
+		slog.String("aliasCVV", c.AliasCVV),
+		slog.String("masked", c.Masked),
+		slog.String("expiryMonth", c.ExpiryMonth),
+		slog.String("expiryYear", c.ExpiryYear),
+	}
+	if c.Info != nil {
+		attrs = append(attrs, slog.String("brand", c.Info.Brand), slog.String("country", c.Info.Country))
+	}
+	return slog.GroupValue(attrs...)
+}
+
+// LogValue implements slog.LogValuer. Only the amount, references and the
+// masked card get logged, wallet tokens and custom fields are omitted.
+func (r RequestAuthorize) LogValue() slog.Value {
+	attrs := []slog.Attr{
+		slog.Int("amount", r.Amount),
+		slog.String("currency", r.Currency),
+		slog.String("refno", r.RefNo),
+		slog.String("refno2", r.RefNo2),
+		slog.Bool("autoSettle", r.AutoSettle),
+	}
+	if r.Card != nil {
+		attrs = append(attrs, slog.Any("card", *r.Card))
+	}
+	return slog.GroupValue(attrs...)
+}
+
+// LogValue implements slog.LogValuer. The raw JSON body and customer are
+// omitted, the card gets masked.
+func (rs ResponseStatus) LogValue() slog.Value {
+	attrs := []slog.Attr{
+		slog.String("transactionId", rs.TransactionID),
+		slog.String("merchantId", rs.MerchantID),
+		slog.String("type", rs.Type),
+		slog.String("status", string(rs.Status)),
+		slog.String("currency", rs.Currency),
+		slog.String("refno", rs.RefNo),
+		slog.String("paymentMethod", rs.PaymentMethod),
+		slog.Int64("authorizedAmount", int64(rs.Detail.Authorize.Amount)),
+		slog.Int64("settledAmount", int64(rs.Detail.Settle.Amount)),
+	}
+	if rs.Card != nil {
+		attrs = append(attrs, slog.Any("card", *rs.Card))
+	}
+	return slog.GroupValue(attrs...)
+}
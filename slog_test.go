@@ -0,0 +1,57 @@
+//go:build go1.21
+// +build go1.21
+
+package datatrans_test
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/globusdigital/datatrans"
+)
+
+func TestLogValue(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+
+	card := &datatrans.Card{Alias: "70119122433810042", AliasCVV: "CVV7011912243381", ExpiryMonth: "12"}
+	logger.Info("authorize",
+		"card", card,
+		"req", datatrans.RequestAuthorize{Amount: 1337, Currency: "CHF", RefNo: "872732", Card: card},
+		"status", datatrans.ResponseStatus{
+			TransactionID: "210215103042148501",
+			Detail:        datatrans.StatusDetail{Authorize: datatrans.AuthorizeDetail{Amount: 1337}},
+			Card:          &datatrans.CardExtended{Alias: "70119122433810042", Masked: "424242xxxxxx4242"},
+			RawJSONBody:   datatrans.RawJSONBody(`{"alias":"70119122433810042"}`),
+		},
+	)
+
+	out := buf.String()
+	for _, secret := range []string{"70119122433810042", "CVV7011912243381", "424242"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("%q leaked: %s", secret, out)
+		}
+	}
+	for _, want := range []string{
+		`"alias":"xxxxxxxxxxxxx0042"`,
+		`"masked":"xxxxxxxxxxxx4242"`,
+		`"transactionId":"210215103042148501"`,
+		`"amount":1337`,
+		`"authorizedAmount":1337`,
+		`"expiryMonth":"12"`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("%s missing: %s", want, out)
+		}
+	}
+}
+
+func TestLogValue_MaskedPANLevel(t *testing.T) {
+	var buf bytes.Buffer
+	slog.New(slog.NewJSONHandler(&buf, nil)).Info("status", "card", datatrans.CardExtended{Masked: "520000xxxxxx0080"})
+	if out := buf.String(); !strings.Contains(out, `"masked":"xxxxxxxxxxxx0080"`) {
+		t.Errorf("card number not masked to the last four digits: %s", out)
+	}
+}
@@ -0,0 +1,88 @@
+package datatrans
+
+import "fmt"
+
+// HistoryAction is the action of a History entry.
+type HistoryAction string
+
+// Actions as used in History.Action which change the status of a transaction.
+const (
+	ActionAuthorize HistoryAction = "authorize"
+	ActionSettle    HistoryAction = "settle"
+	ActionCredit    HistoryAction = "credit"
+	ActionCancel    HistoryAction = "cancel"
+)
+
+// transitions encodes the allowed actions per transaction status, see
+// https://docs.datatrans.ch/docs/transaction-statuses
+//
+//	initialized ───authorize──┬──> authorized ──settle──> settled ──end of day──> transmitted
+//	authenticated ─authorize──┘        │                   │  │                       │
+//	                                 cancel              cancel credit             credit
+//	                                   └──> canceled <─────┘
+//
+// A credit creates a new credit transaction, the settled or transmitted
+// transaction keeps its status. challenge_required and challenge_ongoing wait
+// for the customer, canceled and failed are final.
+var transitions = map[Status]map[HistoryAction]bool{
+	StatusInitialized:       {ActionAuthorize: true},
+	StatusChallengeRequired: {},
+	StatusChallengeOngoing:  {},
+	StatusAuthenticated:     {ActionAuthorize: true},
+	StatusAuthorized:        {ActionSettle: true, ActionCancel: true},
+	StatusSettled:           {ActionCancel: true, ActionCredit: true},
+	StatusTransmitted:       {ActionCredit: true},
+	StatusCanceled:          {},
+	StatusFailed:            {},
+}
+
+// CanTransition reports whether action can be applied to a transaction with
+// the status from, e.g. to check the last ResponseStatus.Status before
+// calling Settle, Credit or Cancel. Unknown statuses or actions return an
+// error.
+func CanTransition(from Status, action HistoryAction) (bool, error) {
+	actions, ok := transitions[from]
+	if !ok {
+		return false, fmt.Errorf("unknown transaction status %q", from)
+	}
+	switch action {
+	case ActionAuthorize, ActionSettle, ActionCredit, ActionCancel:
+	default:
+		return false, fmt.Errorf("unknown action %q", action)
+	}
+	return actions[action], nil
+}
+
+// Refundable returns the amount which can still be credited, the settled
+// amount minus the already credited amount. ok is false if the status does not
+// allow a credit, e.g. for an authorized, canceled or credit transaction, or
+// if nothing is left to credit. The amounts come from Detail and, whichever is
+// higher, the successful settle and credit entries of History.
+func (rs ResponseStatus) Refundable() (amount int, currency string, ok bool) {
+	if can, _ := CanTransition(rs.Status, ActionCredit); !can || rs.Type == "credit" {
+		return 0, "", false
+	}
+	settled, credited := int(rs.Detail.Settle.Amount), int(rs.Detail.Credit.Amount)
+	var settledHistory, creditedHistory int
+	for _, h := range rs.History {
+		if !h.Success {
+			continue
+		}
+		switch h.Action {
+		case ActionSettle:
+			settledHistory += int(h.Amount)
+		case ActionCredit:
+			creditedHistory += int(h.Amount)
+		}
+	}
+	if settledHistory > settled {
+		settled = settledHistory
+	}
+	if creditedHistory > credited {
+		credited = creditedHistory
+	}
+	if settled <= credited {
+		return 0, "", false
+	}
+	return settled - credited, rs.Currency, true
+}
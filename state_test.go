@@ -0,0 +1,124 @@
+package datatrans_test
+
+import (
+	"testing"
+
+	"github.com/globusdigital/datatrans"
+)
+
+func TestCanTransition(t *testing.T) {
+	tests := []struct {
+		from    datatrans.Status
+		action  datatrans.HistoryAction
+		want    bool
+		wantErr bool
+	}{
+		{from: datatrans.StatusInitialized, action: datatrans.ActionAuthorize, want: true},
+		{from: datatrans.StatusAuthenticated, action: datatrans.ActionAuthorize, want: true},
+		{from: datatrans.StatusAuthorized, action: datatrans.ActionSettle, want: true},
+		{from: datatrans.StatusAuthorized, action: datatrans.ActionCancel, want: true},
+		{from: datatrans.StatusSettled, action: datatrans.ActionCancel, want: true},
+		{from: datatrans.StatusSettled, action: datatrans.ActionCredit, want: true},
+		{from: datatrans.StatusTransmitted, action: datatrans.ActionCredit, want: true},
+
+		{from: datatrans.StatusAuthorized, action: datatrans.ActionCredit},
+		{from: datatrans.StatusCanceled, action: datatrans.ActionSettle},
+		{from: datatrans.StatusSettled, action: datatrans.ActionSettle},
+		{from: datatrans.StatusTransmitted, action: datatrans.ActionCancel},
+		{from: datatrans.StatusInitialized, action: datatrans.ActionSettle},
+		{from: datatrans.StatusChallengeRequired, action: datatrans.ActionAuthorize},
+		{from: datatrans.StatusFailed, action: datatrans.ActionCancel},
+
+		{from: "unknown", action: datatrans.ActionSettle, wantErr: true},
+		{from: datatrans.StatusAuthorized, action: "refund", wantErr: true},
+	}
+	for _, tt := range tests {
+		have, err := datatrans.CanTransition(tt.from, tt.action)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s -> %s: unexpected error: %v", tt.from, tt.action, err)
+		}
+		if have != tt.want {
+			t.Errorf("%s -> %s: want %t, have %t", tt.from, tt.action, tt.want, have)
+		}
+	}
+}
+
+func TestResponseStatus_Refundable(t *testing.T) {
+	settle := func(amount int) datatrans.History {
+		return datatrans.History{Action: datatrans.ActionSettle, Amount: datatrans.FlexInt(amount), Success: true}
+	}
+	credit := func(amount int) datatrans.History {
+		return datatrans.History{Action: datatrans.ActionCredit, Amount: datatrans.FlexInt(amount), Success: true}
+	}
+	tests := []struct {
+		name       string
+		rs         datatrans.ResponseStatus
+		wantAmount int
+		wantOK     bool
+	}{
+		{
+			name: "fully settled",
+			rs: datatrans.ResponseStatus{
+				Type: "payment", Status: datatrans.StatusSettled, Currency: "CHF",
+				Detail:  datatrans.StatusDetail{Settle: datatrans.SettleDetail{Amount: 1000}},
+				History: []datatrans.History{settle(1000)},
+			},
+			wantAmount: 1000,
+			wantOK:     true,
+		},
+		{
+			name: "split settlements transmitted",
+			rs: datatrans.ResponseStatus{
+				Type: "payment", Status: datatrans.StatusTransmitted, Currency: "CHF",
+				History: []datatrans.History{settle(600), settle(400), {Action: datatrans.ActionSettle, Amount: 500}},
+			},
+			wantAmount: 1000,
+			wantOK:     true,
+		},
+		{
+			name: "partially credited",
+			rs: datatrans.ResponseStatus{
+				Type: "payment", Status: datatrans.StatusSettled, Currency: "CHF",
+				Detail: datatrans.StatusDetail{
+					Settle: datatrans.SettleDetail{Amount: 1000},
+					Credit: datatrans.CreditDetail{Amount: 300},
+				},
+				History: []datatrans.History{settle(1000), credit(300)},
+			},
+			wantAmount: 700,
+			wantOK:     true,
+		},
+		{
+			name: "fully credited",
+			rs: datatrans.ResponseStatus{
+				Type: "payment", Status: datatrans.StatusSettled, Currency: "CHF",
+				History: []datatrans.History{settle(1000), credit(300), credit(700)},
+			},
+		},
+		{
+			name: "unsettled",
+			rs: datatrans.ResponseStatus{
+				Type: "payment", Status: datatrans.StatusAuthorized, Currency: "CHF",
+				Detail: datatrans.StatusDetail{Authorize: datatrans.AuthorizeDetail{Amount: 1000}},
+			},
+		},
+		{
+			name: "credit transaction",
+			rs: datatrans.ResponseStatus{
+				Type: "credit", Status: datatrans.StatusSettled, Currency: "CHF",
+				Detail: datatrans.StatusDetail{Settle: datatrans.SettleDetail{Amount: 300}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			amount, currency, ok := tt.rs.Refundable()
+			if amount != tt.wantAmount || ok != tt.wantOK {
+				t.Errorf("want %d %t, have %d %t", tt.wantAmount, tt.wantOK, amount, ok)
+			}
+			if ok && currency != "CHF" {
+				t.Errorf("invalid currency %q", currency)
+			}
+		})
+	}
+}
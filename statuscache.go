@@ -0,0 +1,82 @@
+package datatrans
+
+import (
+	"container/list"
+	"reflect"
+	"sync"
+)
+
+// statusCache is a LRU cache for statuses of finished transactions. It is
+// shared between clones of a Client.
+type statusCache struct {
+	mu    sync.Mutex
+	size  int
+	ll    *list.List // front is the most recently used entry
+	items map[string]*list.Element
+}
+
+type statusCacheEntry struct {
+	key string
+	rs  ResponseStatus
+}
+
+func newStatusCache(size int) *statusCache {
+	return &statusCache{
+		size:  size,
+		ll:    list.New(),
+		items: make(map[string]*list.Element, size),
+	}
+}
+
+// isCacheable reports whether the status of a transaction can no longer
+// change through the regular flow.
+func isCacheable(status Status) bool {
+	switch status {
+	case StatusSettled, StatusTransmitted, StatusCanceled, StatusFailed:
+		return true
+	}
+	return false
+}
+
+// get returns a deep copy of the cached status so that callers cannot modify
+// the cached entry.
+func (sc *statusCache) get(key string) (*ResponseStatus, bool) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	el, ok := sc.items[key]
+	if !ok {
+		return nil, false
+	}
+	sc.ll.MoveToFront(el)
+	rs := deepCopy(reflect.ValueOf(el.Value.(*statusCacheEntry).rs)).Interface().(ResponseStatus)
+	return &rs, true
+}
+
+func (sc *statusCache) add(key string, rs ResponseStatus) {
+	if !isCacheable(rs.Status) {
+		return
+	}
+	rs = deepCopy(reflect.ValueOf(rs)).Interface().(ResponseStatus)
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if el, ok := sc.items[key]; ok {
+		el.Value.(*statusCacheEntry).rs = rs
+		sc.ll.MoveToFront(el)
+		return
+	}
+	sc.items[key] = sc.ll.PushFront(&statusCacheEntry{key: key, rs: rs})
+	if sc.ll.Len() > sc.size {
+		oldest := sc.ll.Back()
+		sc.ll.Remove(oldest)
+		delete(sc.items, oldest.Value.(*statusCacheEntry).key)
+	}
+}
+
+func (sc *statusCache) remove(key string) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if el, ok := sc.items[key]; ok {
+		sc.ll.Remove(el)
+		delete(sc.items, key)
+	}
+}
@@ -0,0 +1,63 @@
+package datatrans_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/globusdigital/datatrans"
+)
+
+func TestOptionStatusCache(t *testing.T) {
+	calls := map[string]int{}
+	c, err := datatrans.MakeClient(
+		datatrans.OptionStatusCache(2),
+		datatrans.OptionHTTPRequestFn(func(req *http.Request) (*http.Response, error) {
+			calls[req.Method+" "+req.URL.Path]++
+			status := "settled"
+			if strings.HasSuffix(req.URL.Path, "/2") {
+				status = "authorized"
+			}
+			return &http.Response{
+				StatusCode: 200,
+				Body:       ioutil.NopCloser(strings.NewReader(`{"transactionId":"1","status":"` + status + `"}`)),
+			}, nil
+		}),
+		datatrans.OptionMerchant{
+			MerchantID: "322342",
+			Password:   "sfdgsdfg",
+		},
+	)
+	must(t, err)
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		rs, err := c.Status(ctx, "1")
+		must(t, err)
+		if rs.Status != datatrans.StatusSettled {
+			t.Errorf("invalid status: %q", rs.Status)
+		}
+		rs.Status = "modified" // must not affect the cache
+		_, err = c.Status(ctx, "2")
+		must(t, err)
+	}
+	if n := calls["GET /v1/transactions/1"]; n != 1 {
+		t.Errorf("settled status should be cached, fetched %d times", n)
+	}
+	if n := calls["GET /v1/transactions/2"]; n != 2 {
+		t.Errorf("authorized status must not be cached, fetched %d times", n)
+	}
+
+	must(t, c.Cancel(ctx, "1", "872732"))
+	_, err = c.Status(ctx, "1")
+	must(t, err)
+	if n := calls["GET /v1/transactions/1"]; n != 2 {
+		t.Errorf("cancel should invalidate the cache, fetched %d times", n)
+	}
+
+	if _, err := datatrans.MakeClient(datatrans.OptionStatusCache(0), datatrans.OptionMerchant{}); err == nil {
+		t.Error("expected an error for a zero cache size")
+	}
+}
@@ -0,0 +1,160 @@
+package datatrans
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// 3DS Requestor Initiated indicator (threeRIInd) values for merchant initiated
+// transactions as defined by EMV 3-D Secure.
+const (
+	ThreeRIIndRecurring            = "01"
+	ThreeRIIndInstalment           = "02"
+	ThreeRIIndAddCard              = "03"
+	ThreeRIIndMaintainCardInfo     = "04"
+	ThreeRIIndAccountVerification  = "05"
+	ThreeRIIndSplitDelayedShipment = "06"
+	ThreeRIIndTopUp                = "07"
+	ThreeRIIndMailOrder            = "08"
+	ThreeRIIndTelephoneOrder       = "09"
+	ThreeRIIndWhitelistStatusCheck = "10"
+	ThreeRIIndOtherPayment         = "11"
+)
+
+const (
+	threeDSDeviceChannel3RI         = "03"
+	threeDSMessageCategoryPayment   = "01"
+	threeDSPriorAuthMethodChallenge = "02"
+)
+
+// NewMITThreeD returns the 3D data for a merchant initiated transaction (3DS
+// Requestor Initiated, 3RI). priorRef is the dsTransID of the prior cardholder
+// authenticated transaction, threeRIInd one of the ThreeRIInd constants. The
+// prior authentication method defaults to a challenge (02), the usual case for
+// the initial transaction of a recurring payment. Attach the result to
+// Card.ThreeD.
+func NewMITThreeD(priorRef, threeRIInd string) (ThreeD, error) {
+	if priorRef == "" || len(priorRef) > 36 {
+		return ThreeD{}, fmt.Errorf("priorRef must contain between 1 and 36 characters")
+	}
+	if len(threeRIInd) != 2 || !isDigits(threeRIInd) {
+		return ThreeD{}, fmt.Errorf("invalid threeRIInd %q", threeRIInd)
+	}
+	if n, _ := strconv.Atoi(threeRIInd); n < 1 || n > 11 {
+		return ThreeD{}, fmt.Errorf("invalid threeRIInd %q", threeRIInd)
+	}
+	return ThreeD{
+		DeviceChannel:   threeDSDeviceChannel3RI,
+		MessageCategory: threeDSMessageCategoryPayment,
+		ThreeRIInd:      threeRIInd,
+		ThreeDSRequestor: &ThreeDSRequestor{
+			ThreeDSRequestorPriorAuthenticationInfo: ThreeDSRequestorPriorAuthenticationInfo{
+				ThreeDSReqPriorRef:        priorRef,
+				ThreeDSReqPriorAuthMethod: threeDSPriorAuthMethodChallenge,
+			},
+		},
+	}, nil
+}
+
+// BrowserInformationOption configures NewBrowserInformation.
+type BrowserInformationOption struct {
+	// TrustForwardedFor takes the IP address from the last entry of the
+	// X-Forwarded-For header, as appended by the proxy in front of the server,
+	// instead of RemoteAddr. Only enable it behind such a proxy, otherwise the
+	// customer can send any IP address.
+	TrustForwardedFor bool
+}
+
+// NewBrowserInformation extracts the 3DS browser data available on the server
+// side from the request of the customer: accept header, IP address, language
+// and user agent. Screen and color settings can only be collected within the
+// browser. The IP address gets taken from RemoteAddr, see
+// BrowserInformationOption.TrustForwardedFor.
+func NewBrowserInformation(r *http.Request, bo BrowserInformationOption) *BrowserInformation {
+	bi := &BrowserInformation{
+		BrowserAcceptHeader: r.Header.Get("Accept"),
+		BrowserUserAgent:    r.UserAgent(),
+	}
+	if lang := r.Header.Get("Accept-Language"); lang != "" {
+		lang = strings.SplitN(lang, ",", 2)[0]
+		bi.BrowserLanguage = strings.TrimSpace(strings.SplitN(lang, ";", 2)[0])
+	}
+	if fwd := r.Header.Get("X-Forwarded-For"); bo.TrustForwardedFor && fwd != "" {
+		bi.BrowserIP = strings.TrimSpace(fwd[strings.LastIndex(fwd, ",")+1:])
+	} else if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		bi.BrowserIP = host
+	}
+	return bi
+}
+
+// AttachBrowserInformation fills the empty browser fields of Card.ThreeD with
+// the data from the request of the customer, see NewBrowserInformation. It
+// does nothing if no card has been set.
+func (ri *RequestInitialize) AttachBrowserInformation(r *http.Request, bo BrowserInformationOption) {
+	if ri.Card == nil || r == nil {
+		return
+	}
+	card := *ri.Card
+	var bi BrowserInformation
+	if card.ThreeD.BrowserInformation != nil {
+		bi = *card.ThreeD.BrowserInformation
+	}
+	nbi := NewBrowserInformation(r, bo)
+	if bi.BrowserAcceptHeader == "" {
+		bi.BrowserAcceptHeader = nbi.BrowserAcceptHeader
+	}
+	if bi.BrowserIP == "" {
+		bi.BrowserIP = nbi.BrowserIP
+	}
+	if bi.BrowserLanguage == "" {
+		bi.BrowserLanguage = nbi.BrowserLanguage
+	}
+	if bi.BrowserUserAgent == "" {
+		bi.BrowserUserAgent = nbi.BrowserUserAgent
+	}
+	card.ThreeD.BrowserInformation = &bi
+	ri.Card = &card
+}
+
+// SubMerchant contains the 3D data of the sub merchant a marketplace or
+// payment platform processes a transaction for. The credentials of the
+// platform stay the same, see OptionMerchant.
+type SubMerchant struct {
+	Acquirer *Acquirer // AcquirerBin and AcquirerMerchantID must be set together
+	Merchant *Merchant // name, MCC and numeric country code of the sub merchant
+}
+
+// withSubMerchant returns a copy of card, or a new card, with the acquirer and
+// merchant of sm set in the 3D data.
+func (sm SubMerchant) withSubMerchant(card *Card) *Card {
+	var c Card
+	if card != nil {
+		c = *card
+	}
+	if sm.Acquirer != nil {
+		acq := *sm.Acquirer
+		c.ThreeD.Acquirer = &acq
+	}
+	if sm.Merchant != nil {
+		m := *sm.Merchant
+		c.ThreeD.Merchant = &m
+	}
+	return &c
+}
+
+// SetSubMerchant sets the acquirer and merchant of Card.ThreeD for a
+// marketplace transaction. A card gets created if none has been set, the
+// previous card is not modified.
+func (ri *RequestInitialize) SetSubMerchant(sm SubMerchant) {
+	ri.Card = sm.withSubMerchant(ri.Card)
+}
+
+// SetSubMerchant sets the acquirer and merchant of Card.ThreeD for a
+// marketplace transaction. A card gets created if none has been set, the
+// previous card is not modified.
+func (ra *RequestAuthorize) SetSubMerchant(sm SubMerchant) {
+	ra.Card = sm.withSubMerchant(ra.Card)
+}
@@ -0,0 +1,232 @@
+package datatrans_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/globusdigital/datatrans"
+)
+
+func TestNewMITThreeD(t *testing.T) {
+	td, err := datatrans.NewMITThreeD("f25084f0-5b16-4c0a-ae5d-b24808a95e4b", datatrans.ThreeRIIndRecurring)
+	must(t, err)
+
+	data, err := json.Marshal(datatrans.Card{Alias: "7LHXscqwAAEAAAGQvYQBwc5zX9vtAHrl", ThreeD: td})
+	must(t, err)
+	const wantJSON = `{"alias":"7LHXscqwAAEAAAGQvYQBwc5zX9vtAHrl","3D":{"deviceChannel":"03","messageCategory":"01","threeDSRequestor":{"threeDSRequestorPriorAuthenticationInfo":{"threeDSReqPriorRef":"f25084f0-5b16-4c0a-ae5d-b24808a95e4b","threeDSReqPriorAuthMethod":"02"}},"threeRIInd":"01"}}`
+	if string(data) != wantJSON {
+		t.Errorf("\nWant: %s\nHave: %s", wantJSON, data)
+	}
+
+	if _, err := datatrans.NewMITThreeD("", datatrans.ThreeRIIndRecurring); err == nil {
+		t.Error("expected an error for an empty priorRef")
+	}
+	for _, ind := range []string{"00", "12", "0a", "0:", "1/", "1", "011", " 1", "+1"} {
+		if _, err := datatrans.NewMITThreeD("f25084f0-5b16-4c0a-ae5d-b24808a95e4b", ind); err == nil {
+			t.Errorf("expected an error for the invalid threeRIInd %q", ind)
+		}
+	}
+	if _, err := datatrans.NewMITThreeD("f25084f0-5b16-4c0a-ae5d-b24808a95e4b", datatrans.ThreeRIIndOtherPayment); err != nil {
+		t.Errorf("unexpected error for threeRIInd 11: %v", err)
+	}
+}
+
+func TestRequestInitialize_AttachBrowserInformation(t *testing.T) {
+	hr := httptest.NewRequest("GET", "/checkout", nil)
+	hr.RemoteAddr = "77.109.165.195:51234"
+	hr.Header.Set("Accept", "text/html,application/xhtml+xml")
+	hr.Header.Set("Accept-Language", "de-CH,de;q=0.9,en;q=0.8")
+	hr.Header.Set("User-Agent", "Mozilla/5.0")
+	hr.Header.Set("X-Forwarded-For", "10.0.0.1")
+
+	ri := datatrans.RequestInitialize{
+		Amount:   1000,
+		Currency: "CHF",
+		RefNo:    "872732",
+	}
+	ri.AttachBrowserInformation(hr, datatrans.BrowserInformationOption{}) // no card, nothing happens
+	if ri.Card != nil {
+		t.Fatal("card should still be nil")
+	}
+
+	ri.Card = &datatrans.Card{Alias: "7LHXscqwAAEAAAGQvYQBwc5zX9vtAHrl"}
+	ri.AttachBrowserInformation(hr, datatrans.BrowserInformationOption{})
+	want := datatrans.BrowserInformation{
+		BrowserAcceptHeader: "text/html,application/xhtml+xml",
+		BrowserIP:           "77.109.165.195",
+		BrowserLanguage:     "de-CH",
+		BrowserUserAgent:    "Mozilla/5.0",
+	}
+	if bi := ri.Card.ThreeD.BrowserInformation; bi == nil || *bi != want {
+		t.Errorf("\nWant: %#v\nHave: %#v", want, bi)
+	}
+}
+
+func TestNewBrowserInformation_ForwardedFor(t *testing.T) {
+	hr := httptest.NewRequest("GET", "/checkout", nil)
+	hr.RemoteAddr = "10.0.0.2:51234"
+	hr.Header.Set("X-Forwarded-For", "1.2.3.4, 77.109.165.195")
+
+	if ip := datatrans.NewBrowserInformation(hr, datatrans.BrowserInformationOption{}).BrowserIP; ip != "10.0.0.2" {
+		t.Errorf("X-Forwarded-For must be ignored by default, have %q", ip)
+	}
+	bo := datatrans.BrowserInformationOption{TrustForwardedFor: true}
+	if ip := datatrans.NewBrowserInformation(hr, bo).BrowserIP; ip != "77.109.165.195" {
+		t.Errorf("want the entry appended by the proxy, have %q", ip)
+	}
+	hr.Header.Del("X-Forwarded-For")
+	if ip := datatrans.NewBrowserInformation(hr, bo).BrowserIP; ip != "10.0.0.2" {
+		t.Errorf("want RemoteAddr without X-Forwarded-For, have %q", ip)
+	}
+}
+
+func TestThreeD_OmitEmptyNested(t *testing.T) {
+	data, err := json.Marshal(datatrans.Card{
+		Alias: "7LHXscqwAAEAAAGQvYQBwc5zX9vtAHrl",
+		ThreeD: datatrans.ThreeD{
+			ThreeDSRequestor:  &datatrans.ThreeDSRequestor{ThreeDSRequestorChallengeInd: "01"},
+			CardholderAccount: &datatrans.CardholderAccount{AcctType: "02"},
+			Purchase:          &datatrans.Purchase{PurchaseAmount: 1000},
+			MessageExtension:  []datatrans.MessageExtension{{ID: "A"}},
+		},
+	})
+	must(t, err)
+	const wantJSON = `{"alias":"7LHXscqwAAEAAAGQvYQBwc5zX9vtAHrl","3D":{"threeDSRequestor":{"threeDSRequestorChallengeInd":"01"},"cardholderAccount":{"acctType":"02"},"purchase":{"purchaseAmount":1000},"messageExtension":[{"id":"A"}]}}`
+	if string(data) != wantJSON {
+		t.Errorf("\nWant: %s\nHave: %s", wantJSON, data)
+	}
+
+	data, err = json.Marshal(datatrans.ThreeDSRequestor{
+		ThreeDSRequestorAuthenticationInfo: datatrans.ThreeDSRequestorAuthenticationInfo{ThreeDSReqAuthMethod: "02"},
+	})
+	must(t, err)
+	if want := `{"threeDSRequestorAuthenticationInfo":{"threeDSReqAuthMethod":"02"}}`; string(data) != want {
+		t.Errorf("\nWant: %s\nHave: %s", want, data)
+	}
+}
+
+func TestSetSubMerchant(t *testing.T) {
+	c, err := datatrans.MakeClient(
+		datatrans.OptionStrictValidation(true),
+		datatrans.OptionHTTPRequestFn(mockResponse(t, 200, `{"transactionId":"210215103042148501"}`, nil)),
+		datatrans.OptionMerchant{
+			MerchantID: "322342",
+			Password:   "sfdgsdfg",
+		},
+	)
+	must(t, err)
+
+	card := &datatrans.Card{Alias: "7LHXscqwAAEAAAGQvYQBwc5zX9vtAHrl"}
+	ra := datatrans.RequestAuthorize{Amount: 1337, Currency: "CHF", RefNo: "872732", Card: card}
+	ra.SetSubMerchant(datatrans.SubMerchant{
+		Acquirer: &datatrans.Acquirer{AcquirerBin: "400000"},
+		Merchant: &datatrans.Merchant{MerchantName: "Shop", Mcc: "5411", MerchantCountryCode: "756"},
+	})
+	if card.ThreeD.Acquirer != nil {
+		t.Error("original card must not be modified")
+	}
+	if ra.Card.Alias != card.Alias || ra.Card.ThreeD.Merchant.MerchantName != "Shop" {
+		t.Errorf("sub merchant not set: %#v", ra.Card)
+	}
+
+	_, err = c.Authorize(context.Background(), ra)
+	if have := fmt.Sprint(err); have != "Acquirer: acquirerMerchantId required" {
+		t.Errorf("invalid error: %q", have)
+	}
+
+	ra.SetSubMerchant(datatrans.SubMerchant{Acquirer: &datatrans.Acquirer{AcquirerBin: "400000", AcquirerMerchantID: "123"}})
+	_, err = c.Authorize(context.Background(), ra)
+	must(t, err)
+
+	var ri datatrans.RequestInitialize
+	ri.SetSubMerchant(datatrans.SubMerchant{Merchant: &datatrans.Merchant{Mcc: "54"}})
+	if have := fmt.Sprint(datatrans.Merchant{Mcc: "54"}.Validate()); have != "Merchant: mcc must consist of 4 digits" {
+		t.Errorf("invalid error: %q", have)
+	}
+	if ri.Card == nil || ri.Card.ThreeD.Merchant.Mcc != "54" {
+		t.Errorf("card not created: %#v", ri.Card)
+	}
+}
+
+func TestClient_AuthorizeWithStepUp(t *testing.T) {
+	newClient := func(bodies *[]string, firstCode string, opts ...datatrans.Option) datatrans.Client {
+		opts = append(opts,
+			datatrans.OptionHTTPRequestFn(func(req *http.Request) (*http.Response, error) {
+				body, _ := ioutil.ReadAll(req.Body)
+				*bodies = append(*bodies, string(body))
+				if len(*bodies) == 1 {
+					return &http.Response{
+						StatusCode: 400,
+						Body:       ioutil.NopCloser(strings.NewReader(`{"error":{"code":"` + firstCode + `"}}`)),
+					}, nil
+				}
+				return &http.Response{
+					StatusCode: 200,
+					Body:       ioutil.NopCloser(strings.NewReader(`{"transactionId":"210215103042148501"}`)),
+				}, nil
+			}),
+			datatrans.OptionMerchant{
+				MerchantID: "322342",
+				Password:   "sfdgsdfg",
+			},
+		)
+		c, err := datatrans.MakeClient(opts...)
+		must(t, err)
+		return c
+	}
+	rva := datatrans.RequestAuthorize{
+		Amount:   1337,
+		Currency: "CHF",
+		RefNo:    "872732",
+		Card:     &datatrans.Card{Alias: "7LHXscqwAAEAAAGQvYQBwc5zX9vtAHrl", ExpiryMonth: "12", ExpiryYear: "25"},
+	}
+	threeD := datatrans.ThreeD{ThreeDSServerTransID: "f25084f0-5b16-4c0a-ae5d-b24808a95e4b"}
+
+	t.Run("soft decline", func(t *testing.T) {
+		var bodies []string
+		c := newClient(&bodies, datatrans.ErrCodeSoftDeclined)
+		rcm, err := c.AuthorizeWithStepUp(context.Background(), rva, threeD)
+		must(t, err)
+		if rcm.TransactionId != "210215103042148501" {
+			t.Errorf("invalid response: %#v", rcm)
+		}
+		want := []string{
+			`{"amount":1337,"currency":"CHF","refno":"872732","card":{"alias":"7LHXscqwAAEAAAGQvYQBwc5zX9vtAHrl","expiryMonth":"12","expiryYear":"25"}}`,
+			`{"amount":1337,"currency":"CHF","refno":"872732","card":{"alias":"7LHXscqwAAEAAAGQvYQBwc5zX9vtAHrl","expiryMonth":"12","expiryYear":"25","3D":{"threeDSServerTransID":"f25084f0-5b16-4c0a-ae5d-b24808a95e4b"}}}`,
+		}
+		if !reflect.DeepEqual(bodies, want) {
+			t.Errorf("\nWant: %q\nHave: %q", want, bodies)
+		}
+		if rva.Card.ThreeD.ThreeDSServerTransID != "" {
+			t.Error("card of the request has been modified")
+		}
+	})
+
+	t.Run("hard decline", func(t *testing.T) {
+		var bodies []string
+		c := newClient(&bodies, datatrans.ErrCodeDeclined)
+		if _, err := c.AuthorizeWithStepUp(context.Background(), rva, threeD); err == nil {
+			t.Error("expected an error")
+		}
+		if len(bodies) != 1 {
+			t.Errorf("no retry expected: %q", bodies)
+		}
+	})
+
+	t.Run("configured codes", func(t *testing.T) {
+		var bodies []string
+		c := newClient(&bodies, datatrans.ErrCodeReferral, datatrans.OptionStepUpCodes{datatrans.ErrCodeReferral})
+		_, err := c.AuthorizeWithStepUp(context.Background(), rva, threeD)
+		must(t, err)
+		if len(bodies) != 2 {
+			t.Errorf("retry expected: %q", bodies)
+		}
+	})
+}
@@ -0,0 +1,194 @@
+package datatrans
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Datatrans does not provide an API endpoint to list transactions by date or
+// to search them by refno, the transaction reports are only available in the
+// web administration tool. Therefore the Client has no StatusByRefNo. As a
+// replacement the StatusAggregator collects the statuses received via webhook
+// (or via Status) and provides the list of transactions of a time range or the
+// lookup by refno. It only knows the transactions passed to Add, e.g. by this
+// process.
+
+var (
+	// ErrNoMatch gets returned by StatusAggregator.StatusByRefNo if no
+	// transaction has the refno.
+	ErrNoMatch = errors.New("datatrans: no transaction found")
+	// ErrMultipleMatches gets returned by StatusAggregator.StatusByRefNo if
+	// more than one transaction has the refno.
+	ErrMultipleMatches = errors.New("datatrans: multiple transactions found")
+)
+
+// StatusAggregator collects transaction statuses in memory. It is safe for
+// concurrent use. The zero value is ready to use.
+type StatusAggregator struct {
+	mu       sync.Mutex
+	statuses map[string]ResponseStatus // key: transactionId
+}
+
+// Add stores or replaces the status of a transaction. Statuses without a
+// transactionId are ignored.
+func (sa *StatusAggregator) Add(rs ResponseStatus) {
+	if rs.TransactionID == "" {
+		return
+	}
+	sa.mu.Lock()
+	defer sa.mu.Unlock()
+	if sa.statuses == nil {
+		sa.statuses = make(map[string]ResponseStatus)
+	}
+	sa.statuses[rs.TransactionID] = rs
+}
+
+// Transactions returns all transactions with at least one history entry in
+// the half open range [from, to), sorted by transactionId. Times get compared
+// in UTC. An empty or inverted range returns nil.
+func (sa *StatusAggregator) Transactions(from, to time.Time) []ResponseStatus {
+	from, to = from.UTC(), to.UTC()
+	if !from.Before(to) {
+		return nil
+	}
+
+	sa.mu.Lock()
+	defer sa.mu.Unlock()
+
+	var list []ResponseStatus
+	for _, rs := range sa.statuses {
+		for _, h := range rs.History {
+			d := h.Date.UTC()
+			if !d.Before(from) && d.Before(to) {
+				list = append(list, rs)
+				break
+			}
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].TransactionID < list[j].TransactionID
+	})
+	return list
+}
+
+// StatusByRefNo returns the transaction with the refno among the statuses
+// added so far, it does not query datatrans. If multiple
+// transactions share the refno, e.g. after a retried initialization, the most
+// recent one according to its history gets returned together with an error
+// wrapping ErrMultipleMatches.
+func (sa *StatusAggregator) StatusByRefNo(refno string) (*ResponseStatus, error) {
+	if refno == "" {
+		return nil, fmt.Errorf("refno cannot be empty")
+	}
+
+	sa.mu.Lock()
+	defer sa.mu.Unlock()
+
+	var latest *ResponseStatus
+	var latestDate time.Time
+	matches := 0
+	for _, rs := range sa.statuses {
+		if rs.RefNo != refno {
+			continue
+		}
+		rs := rs
+		matches++
+		d := lastHistoryDate(rs)
+		if latest == nil || d.After(latestDate) || (d.Equal(latestDate) && rs.TransactionID > latest.TransactionID) {
+			latest, latestDate = &rs, d
+		}
+	}
+	switch {
+	case matches == 0:
+		return nil, fmt.Errorf("refno %q: %w", refno, ErrNoMatch)
+	case matches > 1:
+		return latest, fmt.Errorf("refno %q: %d transactions: %w", refno, matches, ErrMultipleMatches)
+	}
+	return latest, nil
+}
+
+// CancelByRefNo cancels the transaction with the refno via c if the
+// transactionId got lost. The transaction gets looked up with StatusByRefNo
+// because datatrans does not support a search by refno. The errors of
+// StatusByRefNo get returned without canceling, also if multiple transactions
+// share the refno.
+func (sa *StatusAggregator) CancelByRefNo(ctx context.Context, c API, refno string) error {
+	if sa == nil || c == nil {
+		return fmt.Errorf("StatusAggregator and API cannot be nil")
+	}
+	rs, err := sa.StatusByRefNo(refno)
+	if err != nil {
+		return err
+	}
+	return c.Cancel(ctx, rs.TransactionID, refno)
+}
+
+// StatusBatch fetches the statuses of many transactions with at most
+// concurrency parallel requests, e.g. for a daily reconciliation. Each ID ends
+// up either in the statuses or in the errors, duplicate IDs are fetched once.
+// Once ctx is done, the IDs not fetched yet get the context error.
+func (c *Client) StatusBatch(ctx context.Context, ids []string, concurrency int) (map[string]*ResponseStatus, map[string]error) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	statuses := make(map[string]*ResponseStatus, len(ids))
+	errs := make(map[string]error)
+	var mu sync.Mutex
+
+	work := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for id := range work {
+				rs, err := c.Status(ctx, id)
+				mu.Lock()
+				if err != nil {
+					errs[id] = err
+				} else {
+					statuses[id] = rs
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	seen := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		if err := ctxErr(ctx, "status of "+id); err != nil {
+			mu.Lock()
+			errs[id] = err
+			mu.Unlock()
+			continue
+		}
+		select {
+		case work <- id:
+		case <-ctx.Done():
+			mu.Lock()
+			errs[id] = ctxErr(ctx, "status of "+id)
+			mu.Unlock()
+		}
+	}
+	close(work)
+	wg.Wait()
+	return statuses, errs
+}
+
+func lastHistoryDate(rs ResponseStatus) time.Time {
+	var last time.Time
+	for _, h := range rs.History {
+		if h.Date.After(last) {
+			last = h.Date.Time
+		}
+	}
+	return last
+}
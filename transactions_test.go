@@ -0,0 +1,191 @@
+package datatrans_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/globusdigital/datatrans"
+)
+
+func TestStatusAggregator_Transactions(t *testing.T) {
+	day := time.Date(2021, 2, 15, 0, 0, 0, 0, time.UTC)
+	zurich := time.FixedZone("CET", 3600)
+
+	var sa datatrans.StatusAggregator
+	sa.Add(datatrans.ResponseStatus{
+		TransactionID: "2",
+		History:       []datatrans.History{{Action: "authorize", Date: datatrans.FlexTime{Time: day.Add(10 * time.Hour)}}},
+	})
+	sa.Add(datatrans.ResponseStatus{
+		TransactionID: "1",
+		History: []datatrans.History{
+			{Action: "authorize", Date: datatrans.FlexTime{Time: day.Add(-2 * time.Hour)}},
+			// 00:30 CET is 23:30 UTC of the previous day
+			{Action: "settle", Date: datatrans.FlexTime{Time: time.Date(2021, 2, 16, 0, 30, 0, 0, zurich)}},
+		},
+	})
+	sa.Add(datatrans.ResponseStatus{
+		TransactionID: "3",
+		History:       []datatrans.History{{Action: "authorize", Date: datatrans.FlexTime{Time: day.Add(24 * time.Hour)}}},
+	})
+	sa.Add(datatrans.ResponseStatus{}) // ignored
+
+	list := sa.Transactions(day, day.Add(24*time.Hour))
+	if len(list) != 2 || list[0].TransactionID != "1" || list[1].TransactionID != "2" {
+		t.Errorf("invalid transactions: %#v", list)
+	}
+
+	if list := sa.Transactions(day, day); list != nil {
+		t.Errorf("empty range should return nil: %#v", list)
+	}
+}
+
+func TestStatusAggregator_StatusByRefNo(t *testing.T) {
+	day := time.Date(2021, 2, 15, 0, 0, 0, 0, time.UTC)
+	history := func(h int) []datatrans.History {
+		return []datatrans.History{{Action: "authorize", Date: datatrans.FlexTime{Time: day.Add(time.Duration(h) * time.Hour)}}}
+	}
+
+	var sa datatrans.StatusAggregator
+	sa.Add(datatrans.ResponseStatus{TransactionID: "1", RefNo: "A", History: history(1)})
+	sa.Add(datatrans.ResponseStatus{TransactionID: "2", RefNo: "B", History: history(3)})
+	sa.Add(datatrans.ResponseStatus{TransactionID: "3", RefNo: "B", History: history(2)})
+
+	rs, err := sa.StatusByRefNo("A")
+	must(t, err)
+	if rs.TransactionID != "1" {
+		t.Errorf("invalid transaction: %#v", rs)
+	}
+
+	rs, err = sa.StatusByRefNo("B")
+	if !errors.Is(err, datatrans.ErrMultipleMatches) {
+		t.Errorf("expected ErrMultipleMatches, got: %v", err)
+	}
+	if rs == nil || rs.TransactionID != "2" {
+		t.Errorf("expected the most recent transaction: %#v", rs)
+	}
+
+	if _, err := sa.StatusByRefNo("C"); !errors.Is(err, datatrans.ErrNoMatch) {
+		t.Errorf("expected ErrNoMatch, got: %v", err)
+	}
+	if _, err := sa.StatusByRefNo(""); err == nil {
+		t.Error("expected an error for an empty refno")
+	}
+}
+
+func TestStatusAggregator_CancelByRefNo(t *testing.T) {
+	var calls []string
+	c, err := datatrans.MakeClient(
+		datatrans.OptionHTTPRequestFn(func(req *http.Request) (*http.Response, error) {
+			body, _ := ioutil.ReadAll(req.Body)
+			calls = append(calls, req.Method+" "+req.URL.Path+" "+string(body))
+			return &http.Response{StatusCode: 204, Body: ioutil.NopCloser(strings.NewReader(""))}, nil
+		}),
+		datatrans.OptionMerchant{
+			MerchantID: "322342",
+			Password:   "sfdgsdfg",
+		},
+	)
+	must(t, err)
+
+	var sa datatrans.StatusAggregator
+	sa.Add(datatrans.ResponseStatus{TransactionID: "210215103042148501", RefNo: "A"})
+	sa.Add(datatrans.ResponseStatus{TransactionID: "210215103042148502", RefNo: "B"})
+	sa.Add(datatrans.ResponseStatus{TransactionID: "210215103042148503", RefNo: "B"})
+
+	must(t, sa.CancelByRefNo(context.Background(), &c, "A"))
+	if want := []string{`POST /v1/transactions/210215103042148501/cancel {"refno":"A"}`}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("invalid calls: %q", calls)
+	}
+
+	calls = nil
+	if err := sa.CancelByRefNo(context.Background(), &c, "C"); !errors.Is(err, datatrans.ErrNoMatch) {
+		t.Errorf("expected ErrNoMatch, got: %v", err)
+	}
+	if err := sa.CancelByRefNo(context.Background(), &c, "B"); !errors.Is(err, datatrans.ErrMultipleMatches) {
+		t.Errorf("expected ErrMultipleMatches, got: %v", err)
+	}
+	if err := sa.CancelByRefNo(context.Background(), &c, ""); err == nil {
+		t.Error("expected an error for an empty refno")
+	}
+	var nilSA *datatrans.StatusAggregator
+	if err := nilSA.CancelByRefNo(context.Background(), &c, "A"); err == nil {
+		t.Error("expected an error for a nil StatusAggregator")
+	}
+	if err := sa.CancelByRefNo(context.Background(), nil, "A"); err == nil {
+		t.Error("expected an error for a nil API")
+	}
+	if len(calls) != 0 {
+		t.Errorf("no request expected: %q", calls)
+	}
+}
+
+func TestClient_StatusBatch(t *testing.T) {
+	var mu sync.Mutex
+	var active, maxActive int
+	c, err := datatrans.MakeClient(
+		datatrans.OptionHTTPRequestFn(func(req *http.Request) (*http.Response, error) {
+			mu.Lock()
+			active++
+			if active > maxActive {
+				maxActive = active
+			}
+			mu.Unlock()
+			time.Sleep(10 * time.Millisecond)
+			mu.Lock()
+			active--
+			mu.Unlock()
+
+			id := strings.TrimPrefix(req.URL.Path, "/v1/transactions/")
+			if strings.HasPrefix(id, "missing") {
+				return &http.Response{
+					StatusCode: 404,
+					Body:       ioutil.NopCloser(strings.NewReader(`{"error":{"code":"TRANSACTION_NOT_FOUND"}}`)),
+				}, nil
+			}
+			return &http.Response{
+				StatusCode: 200,
+				Body:       ioutil.NopCloser(strings.NewReader(`{"transactionId":"` + id + `","status":"settled"}`)),
+			}, nil
+		}),
+		datatrans.OptionMerchant{
+			MerchantID: "322342",
+			Password:   "sfdgsdfg",
+		},
+	)
+	must(t, err)
+
+	ids := []string{"1", "missing-1", "2", "3", "missing-2", "4", "5", "2"}
+	statuses, errs := c.StatusBatch(context.Background(), ids, 3)
+	if len(statuses) != 5 || len(errs) != 2 {
+		t.Fatalf("invalid result: %d statuses, %d errors", len(statuses), len(errs))
+	}
+	for _, id := range []string{"1", "2", "3", "4", "5"} {
+		if rs := statuses[id]; rs == nil || rs.TransactionID != id {
+			t.Errorf("invalid status of %s: %#v", id, rs)
+		}
+	}
+	for _, id := range []string{"missing-1", "missing-2"} {
+		var errResp datatrans.ErrorResponse
+		if !errors.As(errs[id], &errResp) || errResp.ErrorDetail.Code != datatrans.ErrCodeTransactionNotFound {
+			t.Errorf("invalid error of %s: %v", id, errs[id])
+		}
+	}
+	if maxActive > 3 {
+		t.Errorf("concurrency exceeded: %d", maxActive)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	statuses, errs = c.StatusBatch(ctx, []string{"1", "2"}, 3)
+	if len(statuses) != 0 || !errors.Is(errs["1"], context.Canceled) || !errors.Is(errs["2"], context.Canceled) {
+		t.Errorf("expected context errors: %v %v", statuses, errs)
+	}
+}
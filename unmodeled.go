@@ -0,0 +1,130 @@
+package datatrans
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+var (
+	jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// UnmodeledFields reports the JSON keys of raw which have no corresponding
+// struct field in v, e.g. to spot fields returned by datatrans which this
+// package does not support yet. Nested keys are reported as dotted paths,
+// array elements with "[]", like "card.info.issuer" or "history[].ip". Keys get
+// matched case insensitively like encoding/json does. Maps, interfaces and
+// types with a custom unmarshaler accept any key. The returned paths are
+// sorted.
+func UnmodeledFields(raw RawJSONBody, v interface{}) ([]string, error) {
+	var data interface{}
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal raw body: %w", err)
+	}
+	var paths []string
+	collectUnmodeled(&paths, "", data, reflect.TypeOf(v))
+	sort.Strings(paths)
+	return paths, nil
+}
+
+func collectUnmodeled(paths *[]string, prefix string, data interface{}, t reflect.Type) {
+	if t == nil {
+		return
+	}
+	for t.Kind() == reflect.Ptr {
+		if t.Implements(jsonUnmarshalerType) || t.Implements(textUnmarshalerType) {
+			return
+		}
+		t = t.Elem()
+	}
+	if reflect.PtrTo(t).Implements(jsonUnmarshalerType) || reflect.PtrTo(t).Implements(textUnmarshalerType) {
+		return
+	}
+
+	switch d := data.(type) {
+	case map[string]interface{}:
+		if t.Kind() != reflect.Struct {
+			return
+		}
+		fields := jsonFields(t)
+		for key, val := range d {
+			path := key
+			if prefix != "" {
+				path = prefix + "." + key
+			}
+			ft, ok := fields[key]
+			if !ok {
+				for name, typ := range fields {
+					if strings.EqualFold(name, key) {
+						ft, ok = typ, true
+						break
+					}
+				}
+			}
+			if !ok {
+				*paths = append(*paths, path)
+				continue
+			}
+			collectUnmodeled(paths, path, val, ft)
+		}
+	case []interface{}:
+		if t.Kind() != reflect.Slice && t.Kind() != reflect.Array {
+			return
+		}
+		seen := map[string]bool{}
+		var elemPaths []string
+		for _, val := range d {
+			collectUnmodeled(&elemPaths, prefix+"[]", val, t.Elem())
+		}
+		for _, p := range elemPaths {
+			if !seen[p] {
+				seen[p] = true
+				*paths = append(*paths, p)
+			}
+		}
+	}
+}
+
+// jsonFields returns the types of the struct fields by their JSON name,
+// including the promoted fields of embedded structs without a JSON name.
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	fields := map[string]reflect.Type{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := tag
+		if idx := strings.IndexByte(tag, ','); idx >= 0 {
+			name = tag[:idx]
+		}
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				for n, typ := range jsonFields(ft) {
+					if _, ok := fields[n]; !ok {
+						fields[n] = typ
+					}
+				}
+				continue
+			}
+		}
+		if f.PkgPath != "" && !f.Anonymous {
+			continue // unexported
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[name] = f.Type
+	}
+	return fields
+}
@@ -0,0 +1,58 @@
+package datatrans_test
+
+import (
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	"github.com/globusdigital/datatrans"
+)
+
+func TestUnmodeledFields(t *testing.T) {
+	raw, err := ioutil.ReadFile("testdata/status_response.json")
+	must(t, err)
+
+	got, err := datatrans.UnmodeledFields(raw, &datatrans.ResponseStatus{})
+	must(t, err)
+	if want := []string{"twi"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("\nWant: %q\nHave: %q", want, got)
+	}
+
+	type trimmedStatus struct {
+		TransactionID string `json:"transactionId"`
+		Status        string
+		Card          *struct {
+			Masked string `json:"masked"`
+			Info   map[string]string
+		} `json:"card"`
+		History []struct {
+			Action string             `json:"action"`
+			Date   datatrans.FlexTime `json:"date"`
+		} `json:"history"`
+		datatrans.CustomFields `json:"-"`
+	}
+	got, err = datatrans.UnmodeledFields(raw, trimmedStatus{})
+	must(t, err)
+	want := []string{
+		"card.expiryMonth",
+		"card.expiryYear",
+		"card.fingerprint",
+		"currency",
+		"detail",
+		"history[].amount",
+		"history[].ip",
+		"history[].source",
+		"history[].success",
+		"paymentMethod",
+		"refno",
+		"twi",
+		"type",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("\nWant: %q\nHave: %q", want, got)
+	}
+
+	if _, err := datatrans.UnmodeledFields(datatrans.RawJSONBody(`{`), &datatrans.ResponseStatus{}); err == nil {
+		t.Error("expected an error for invalid JSON")
+	}
+}
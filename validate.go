@@ -0,0 +1,409 @@
+package datatrans
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// FieldError describes a single missing or invalid field of a request.
+type FieldError struct {
+	Field   string // JSON name of the field
+	Message string
+}
+
+// ValidationError gets returned by the Validate functions of the request types
+// and lists all missing or invalid fields at once.
+type ValidationError struct {
+	Type   string // name of the request type
+	Fields []FieldError
+}
+
+func (ve ValidationError) Error() string {
+	var buf strings.Builder
+	buf.WriteString(ve.Type)
+	buf.WriteString(": ")
+	for i, fe := range ve.Fields {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		buf.WriteString(fe.Field)
+		buf.WriteByte(' ')
+		buf.WriteString(fe.Message)
+	}
+	return buf.String()
+}
+
+// validator collects field errors of one request type.
+type validator struct {
+	typ    string
+	fields []FieldError
+}
+
+func (v *validator) required(field string, present bool) {
+	if !present {
+		v.invalid(field, "required")
+	}
+}
+
+func (v *validator) invalid(field, msg string) {
+	v.fields = append(v.fields, FieldError{Field: field, Message: msg})
+}
+
+func (v *validator) err() error {
+	if len(v.fields) == 0 {
+		return nil
+	}
+	return ValidationError{Type: v.typ, Fields: v.fields}
+}
+
+// Validate checks that all required fields are set.
+func (r RequestSecureFieldsInit) Validate() error {
+	v := validator{typ: "RequestSecureFieldsInit"}
+	v.required("amount", r.Amount != 0)
+	v.required("currency", r.Currency != "")
+	v.required("returnUrl", r.ReturnUrl != "")
+	return v.err()
+}
+
+// Validate checks that all required fields are set.
+func (r RequestSecureFieldsUpdate) Validate() error {
+	v := validator{typ: "RequestSecureFieldsUpdate"}
+	v.required("amount", r.Amount != 0)
+	v.required("currency", r.Currency != "")
+	return v.err()
+}
+
+// Validate checks that all required fields are set and that only one payment
+// instrument is set.
+func (r RequestInitialize) Validate() error {
+	v := validator{typ: "RequestInitialize"}
+	v.required("amount", r.Amount != 0)
+	v.required("currency", r.Currency != "")
+	v.required("refno", r.RefNo != "")
+	validateInstruments(&v, r.Card != nil, r.APL != nil, r.PAY != nil)
+	return v.err()
+}
+
+// validateCombinations checks the rules documented at OptionStrictValidation.
+func (r RequestInitialize) validateCombinations() error {
+	v := validator{typ: "RequestInitialize"}
+	if o := r.Option; o != nil {
+		autoSettle := r.AutoSettle
+		if r.AutoSettleExplicit != nil {
+			autoSettle = *r.AutoSettleExplicit
+		}
+		if o.AuthenticationOnly && autoSettle {
+			v.invalid("option.authenticationOnly", "cannot be combined with autoSettle, no authorization takes place")
+		}
+		switch o.RememberMe {
+		case "", RememberMeTrue, RememberMeChecked:
+		default:
+			v.invalid("option.rememberMe", `must be "true" or "checked"`)
+		}
+		if o.RememberMe != "" && !o.CreateAlias {
+			v.invalid("option.rememberMe", "requires option.createAlias")
+		}
+	}
+	validateItems(&v, r.Amount, r.Items)
+	return v.err()
+}
+
+// Validate checks the closed sets of Gender and Type, that a company customer
+// has a name and a register number, that BirthDate is a date in the past
+// formatted as YYYY-MM-DD and that Country is an ISO 3166-1 alpha-2 code. Call
+// Normalize beforehand to accept abbreviations like "M" or "F".
+func (c Customer) Validate() error {
+	return c.validate(time.Now())
+}
+
+// validate checks the customer like Validate, a BirthDate after now is in the
+// future.
+func (c Customer) validate(now time.Time) error {
+	v := validator{typ: "Customer"}
+	if c.Country != "" && !ValidAlpha2(c.Country) {
+		v.invalid("country", "must be an ISO 3166-1 alpha-2 code")
+	}
+	if c.BirthDate != "" {
+		bd, err := time.Parse(birthDateLayout, c.BirthDate)
+		switch {
+		case err != nil:
+			v.invalid("birthDate", "must be formatted as YYYY-MM-DD")
+		case bd.After(now):
+			v.invalid("birthDate", "cannot be in the future")
+		}
+	}
+	switch c.Gender {
+	case "", GenderFemale, GenderMale:
+	default:
+		v.invalid("gender", `must be "female" or "male"`)
+	}
+	switch c.Type {
+	case "", CustomerTypePrivate:
+	case CustomerTypeCompany:
+		v.required("name", c.Name != "")
+		v.required("companyRegisterNumber", c.CompanyRegisterNumber != "")
+	default:
+		v.invalid("type", `must be "P" or "C"`)
+	}
+	return v.err()
+}
+
+// Validate checks AddrMatch, that the address countries are ISO 3166-1 numeric
+// codes and that the phone numbers consist of digits as required by EMV 3-D
+// Secure. Call Normalize beforehand to remove the formatting of the phone
+// numbers.
+func (c Cardholder) Validate() error {
+	v := validator{typ: "Cardholder"}
+	switch c.AddrMatch {
+	case "", AddrMatchYes, AddrMatchNo:
+	default:
+		v.invalid("addrMatch", `must be "Y" or "N"`)
+	}
+	if c.BillAddrCountry != "" && !ValidNumericCountry(c.BillAddrCountry) {
+		v.invalid("billAddrCountry", "must be an ISO 3166-1 numeric code")
+	}
+	if c.ShipAddrCountry != "" && !ValidNumericCountry(c.ShipAddrCountry) {
+		v.invalid("shipAddrCountry", "must be an ISO 3166-1 numeric code")
+	}
+	if p := c.HomePhone; p != nil {
+		validatePhone(&v, "homePhone", p.Cc, p.Subscriber)
+	}
+	if p := c.MobilePhone; p != nil {
+		validatePhone(&v, "mobilePhone", p.Cc, p.Subscriber)
+	}
+	if p := c.WorkPhone; p != nil {
+		validatePhone(&v, "workPhone", p.Cc, p.Subscriber)
+	}
+	return v.err()
+}
+
+// Validate checks that the indicators contain the codes defined by EMV 3-D
+// Secure.
+func (m MerchantRiskIndicator) Validate() error {
+	v := validator{typ: "MerchantRiskIndicator"}
+	validateIndicator(&v, "shipIndicator", string(m.ShipIndicator), 7)
+	validateIndicator(&v, "deliveryTimeframe", string(m.DeliveryTimeframe), 4)
+	validateIndicator(&v, "reorderItemsInd", m.ReorderItemsInd, 2)
+	validateIndicator(&v, "preOrderPurchaseInd", m.PreOrderPurchaseInd, 2)
+	return v.err()
+}
+
+// Validate checks that the indicators contain the codes defined by EMV 3-D
+// Secure.
+func (a AcctInfo) Validate() error {
+	v := validator{typ: "AcctInfo"}
+	validateIndicator(&v, "chAccChangeInd", a.ChAccChangeInd, 4)
+	validateIndicator(&v, "chAccPwChangeInd", a.ChAccPwChangeInd, 5)
+	validateIndicator(&v, "shipAddressUsageInd", a.ShipAddressUsageInd, 4)
+	validateIndicator(&v, "suspiciousAccActivity", a.SuspiciousAccActivity, 2)
+	validateIndicator(&v, "shipNameIndicator", a.ShipNameIndicator, 2)
+	validateIndicator(&v, "paymentAccInd", a.PaymentAccInd, 5)
+	return v.err()
+}
+
+// validateIndicator checks that a set value is one of the two digit codes "01"
+// up to max.
+func validateIndicator(v *validator, field, value string, max int) {
+	if value == "" {
+		return
+	}
+	if len(value) != 2 || value[0] != '0' || value[1] < '1' || int(value[1]-'0') > max {
+		v.invalid(field, fmt.Sprintf("must be a code from 01 to %02d", max))
+	}
+}
+
+// Validate checks that the acquirer BIN and merchant ID are set together.
+func (a Acquirer) Validate() error {
+	v := validator{typ: "Acquirer"}
+	if (a.AcquirerBin == "") != (a.AcquirerMerchantID == "") {
+		v.required("acquirerBin", a.AcquirerBin != "")
+		v.required("acquirerMerchantId", a.AcquirerMerchantID != "")
+	}
+	return v.err()
+}
+
+// Validate checks that Mcc consists of four digits and that
+// MerchantCountryCode is an ISO 3166-1 numeric code as required by EMV 3-D
+// Secure.
+func (m Merchant) Validate() error {
+	v := validator{typ: "Merchant"}
+	if m.Mcc != "" && (len(m.Mcc) != 4 || !isDigits(m.Mcc)) {
+		v.invalid("mcc", "must consist of 4 digits")
+	}
+	if m.MerchantCountryCode != "" && !ValidNumericCountry(m.MerchantCountryCode) {
+		v.invalid("merchantCountryCode", "must be an ISO 3166-1 numeric code")
+	}
+	return v.err()
+}
+
+// validateCardThreeD validates the cardholder, account info, risk indicators,
+// acquirer and merchant of the 3D data of card.
+func validateCardThreeD(card *Card) error {
+	if card == nil {
+		return nil
+	}
+	td := card.ThreeD
+	if td.Cardholder != nil {
+		if err := td.Cardholder.Validate(); err != nil {
+			return err
+		}
+	}
+	if td.CardholderAccount != nil {
+		if err := td.CardholderAccount.AcctInfo.Validate(); err != nil {
+			return err
+		}
+	}
+	if td.Purchase != nil {
+		if err := td.Purchase.MerchantRiskIndicator.Validate(); err != nil {
+			return err
+		}
+	}
+	if td.Acquirer != nil {
+		if err := td.Acquirer.Validate(); err != nil {
+			return err
+		}
+	}
+	if td.Merchant != nil {
+		if err := td.Merchant.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateItems checks that the totals of the items add up to the amount.
+func validateItems(v *validator, amount int, items []LineItem) {
+	if len(items) == 0 {
+		return
+	}
+	total := 0
+	for _, li := range items {
+		total += li.Total()
+	}
+	if total != amount {
+		v.invalid("order.articles", fmt.Sprintf("total %d does not match amount %d", total, amount))
+	}
+}
+
+// Validate checks that all required fields are set and that only one payment
+// instrument is set.
+func (r RequestAuthorize) Validate() error {
+	v := validator{typ: "RequestAuthorize"}
+	v.required("amount", r.Amount != 0)
+	v.required("currency", r.Currency != "")
+	v.required("refno", r.RefNo != "")
+	validateInstruments(&v, r.Card != nil, r.APL != nil, r.PAY != nil)
+	return v.err()
+}
+
+// validateInstruments checks that at most one of the card and the wallet
+// payment tokens is set.
+func validateInstruments(v *validator, card, apl, pay bool) {
+	var set []string
+	if card {
+		set = append(set, "card")
+	}
+	if apl {
+		set = append(set, "APL")
+	}
+	if pay {
+		set = append(set, "PAY")
+	}
+	for i := 1; i < len(set); i++ {
+		v.invalid(set[i], "cannot be combined with "+set[0]+", only one payment instrument can be set")
+	}
+}
+
+// validateCombinations checks the rules documented at OptionStrictValidation.
+func (r RequestAuthorize) validateCombinations() error {
+	v := validator{typ: "RequestAuthorize"}
+	validateItems(&v, r.Amount, r.Items)
+	return v.err()
+}
+
+// Validate checks that all required fields are set.
+func (r RequestAuthorizeTransaction) Validate() error {
+	v := validator{typ: "RequestAuthorizeTransaction"}
+	v.required("refno", r.RefNo != "")
+	return v.err()
+}
+
+// Validate checks that all required fields are set and that the
+// authenticationResponse contains a known value.
+func (r RequestThreeDSContinue) Validate() error {
+	v := validator{typ: "RequestThreeDSContinue"}
+	v.required("refno", r.RefNo != "")
+	if r.ThreeD != nil {
+		switch r.ThreeD.AuthenticationResponse {
+		case "", "Y", "A", "N", "U", "R":
+		default:
+			v.invalid("3D.authenticationResponse", "must be one of Y, A, N, U, R")
+		}
+	}
+	return v.err()
+}
+
+// Validate checks that all required fields are set.
+func (r RequestValidateAlias) Validate() error {
+	v := validator{typ: "RequestValidateAlias"}
+	v.required("currency", r.Currency != "")
+	v.required("refno", r.RefNo != "")
+	return v.err()
+}
+
+// Validate checks that all required fields are set and that ShipmentRef and
+// RefNo2 are not both set.
+func (r RequestSettle) Validate() error {
+	v := validator{typ: "RequestSettle"}
+	v.required("amount", r.Amount != 0)
+	v.required("currency", r.Currency != "")
+	v.required("refno", r.RefNo != "")
+	if r.ShipmentRef != "" && r.RefNo2 != "" {
+		v.invalid("refno2", "cannot be combined with shipmentRef")
+	}
+	return v.err()
+}
+
+// Validate checks that all required fields are set.
+func (r RequestCancel) Validate() error {
+	v := validator{typ: "RequestCancel"}
+	v.required("refno", r.RefNo != "")
+	return v.err()
+}
+
+// Validate checks that all required fields are set.
+func (r RequestCredit) Validate() error {
+	v := validator{typ: "RequestCredit"}
+	v.required("currency", r.Currency != "")
+	v.required("refno", r.RefNo != "")
+	return v.err()
+}
+
+// Validate checks that all required fields are set.
+func (r RequestCreditAuthorize) Validate() error {
+	v := validator{typ: "RequestCreditAuthorize"}
+	v.required("amount", r.Amount != 0)
+	v.required("currency", r.Currency != "")
+	v.required("refno", r.RefNo != "")
+	return v.err()
+}
+
+// Validate checks that all required fields are set. The matching on the
+// datatrans side is based on the transactionId.
+func (r RequestReconciliationsSale) Validate() error {
+	v := validator{typ: "RequestReconciliationsSale"}
+	v.required("transactionId", r.TransactionID != "")
+	return v.err()
+}
+
+// Validate checks that at least one sale has been provided and lists every
+// sale without transactionId.
+func (r RequestReconciliationsSales) Validate() error {
+	v := validator{typ: "RequestReconciliationsSales"}
+	v.required("sales", len(r.Sales) > 0)
+	for i, s := range r.Sales {
+		v.required(fmt.Sprintf("sales[%d].transactionId", i), s.TransactionID != "")
+	}
+	return v.err()
+}
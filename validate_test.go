@@ -0,0 +1,351 @@
+package datatrans_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/globusdigital/datatrans"
+)
+
+func TestRequestSettle_Validate(t *testing.T) {
+	err := datatrans.RequestSettle{RefNo: "872732"}.Validate()
+
+	var ve datatrans.ValidationError
+	if !errors.As(err, &ve) {
+		t.Fatalf("expected a ValidationError, got: %#v", err)
+	}
+	want := datatrans.ValidationError{
+		Type: "RequestSettle",
+		Fields: []datatrans.FieldError{
+			{Field: "amount", Message: "required"},
+			{Field: "currency", Message: "required"},
+		},
+	}
+	if !reflect.DeepEqual(ve, want) {
+		t.Errorf("\nWant: %#v\nHave: %#v", want, ve)
+	}
+	if have := err.Error(); have != "RequestSettle: amount required, currency required" {
+		t.Errorf("invalid error message: %q", have)
+	}
+
+	must(t, datatrans.RequestSettle{Amount: 100, Currency: "CHF", RefNo: "872732"}.Validate())
+}
+
+func TestRequestInitialize_Validate(t *testing.T) {
+	err := datatrans.RequestInitialize{}.Validate()
+
+	var ve datatrans.ValidationError
+	if !errors.As(err, &ve) {
+		t.Fatalf("expected a ValidationError, got: %#v", err)
+	}
+	want := datatrans.ValidationError{
+		Type: "RequestInitialize",
+		Fields: []datatrans.FieldError{
+			{Field: "amount", Message: "required"},
+			{Field: "currency", Message: "required"},
+			{Field: "refno", Message: "required"},
+		},
+	}
+	if !reflect.DeepEqual(ve, want) {
+		t.Errorf("\nWant: %#v\nHave: %#v", want, ve)
+	}
+
+	must(t, datatrans.RequestInitialize{Amount: 100, Currency: "CHF", RefNo: "872732"}.Validate())
+}
+
+func TestRequestReconciliationsSales_Validate(t *testing.T) {
+	sales := datatrans.RequestReconciliationsSales{Sales: []datatrans.RequestReconciliationsSale{
+		{TransactionID: "210215103042148501"},
+		{},
+		{TransactionID: "210215103042148503"},
+		{},
+	}}
+	err := sales.Validate()
+
+	var ve datatrans.ValidationError
+	if !errors.As(err, &ve) {
+		t.Fatalf("expected a ValidationError, got: %#v", err)
+	}
+	want := datatrans.ValidationError{
+		Type: "RequestReconciliationsSales",
+		Fields: []datatrans.FieldError{
+			{Field: "sales[1].transactionId", Message: "required"},
+			{Field: "sales[3].transactionId", Message: "required"},
+		},
+	}
+	if !reflect.DeepEqual(ve, want) {
+		t.Errorf("\nWant: %#v\nHave: %#v", want, ve)
+	}
+
+	for _, strict := range []bool{false, true} {
+		var called int
+		c, err := datatrans.MakeClient(
+			datatrans.OptionStrictValidation(strict),
+			datatrans.OptionHTTPRequestFn(func(req *http.Request) (*http.Response, error) {
+				called++
+				return &http.Response{
+					StatusCode: 200,
+					Body:       ioutil.NopCloser(strings.NewReader(`{"sales":[]}`)),
+				}, nil
+			}),
+			datatrans.OptionMerchant{
+				MerchantID: "322342",
+				Password:   "sfdgsdfg",
+			},
+		)
+		must(t, err)
+		_, err = c.ReconciliationsSalesBulk(context.Background(), sales)
+		if strict && (!errors.As(err, &ve) || called != 0) {
+			t.Errorf("strict: expected a ValidationError without request, got: %v", err)
+		}
+		if !strict && (err != nil || called != 1) {
+			t.Errorf("not strict: expected the request to be sent, got: %v", err)
+		}
+	}
+}
+
+func TestClient_Initialize_StrictValidation(t *testing.T) {
+	c, err := datatrans.MakeClient(
+		datatrans.OptionStrictValidation(true),
+		datatrans.OptionHTTPRequestFn(func(req *http.Request) (*http.Response, error) {
+			return &http.Response{
+				StatusCode: 201,
+				Body:       ioutil.NopCloser(strings.NewReader(`{"transactionId":"210215103033478409"}`)),
+			}, nil
+		}),
+		datatrans.OptionMerchant{
+			MerchantID: "322342",
+			Password:   "sfdgsdfg",
+		},
+	)
+	must(t, err)
+
+	tests := []struct {
+		name       string
+		autoSettle bool
+		option     datatrans.InitializeOption
+		wantFields []string
+	}{
+		{
+			name:       "authenticationOnly with autoSettle",
+			autoSettle: true,
+			option:     datatrans.InitializeOption{AuthenticationOnly: true},
+			wantFields: []string{"option.authenticationOnly"},
+		},
+		{
+			name:       "rememberMe without createAlias",
+			option:     datatrans.InitializeOption{RememberMe: "checked"},
+			wantFields: []string{"option.rememberMe"},
+		},
+		{
+			name:       "invalid rememberMe",
+			option:     datatrans.InitializeOption{RememberMe: "false", CreateAlias: true},
+			wantFields: []string{"option.rememberMe"},
+		},
+		{
+			name:   "rememberMe checked",
+			option: datatrans.InitializeOption{RememberMe: datatrans.RememberMeChecked, CreateAlias: true},
+		},
+		{
+			name:       "both",
+			autoSettle: true,
+			option:     datatrans.InitializeOption{AuthenticationOnly: true, RememberMe: "yes", CreateAlias: true},
+			wantFields: []string{"option.authenticationOnly", "option.rememberMe"},
+		},
+		{
+			name:       "valid",
+			autoSettle: true,
+			option:     datatrans.InitializeOption{RememberMe: "true", CreateAlias: true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opt := tt.option
+			_, err := c.Initialize(context.Background(), datatrans.RequestInitialize{
+				Currency:   "CHF",
+				RefNo:      "872732",
+				Amount:     1337,
+				AutoSettle: tt.autoSettle,
+				Option:     &opt,
+			})
+			if tt.wantFields == nil {
+				must(t, err)
+				return
+			}
+			var ve datatrans.ValidationError
+			if !errors.As(err, &ve) {
+				t.Fatalf("expected a ValidationError, got: %v", err)
+			}
+			var haveFields []string
+			for _, f := range ve.Fields {
+				haveFields = append(haveFields, f.Field)
+			}
+			if !reflect.DeepEqual(haveFields, tt.wantFields) {
+				t.Errorf("want %v, have %v: %s", tt.wantFields, haveFields, err)
+			}
+		})
+	}
+}
+
+func TestCustomer_Validate(t *testing.T) {
+	t.Run("valid company", func(t *testing.T) {
+		c := datatrans.Customer{
+			Type:                  "c",
+			Gender:                "F",
+			Name:                  "Globus AG",
+			CompanyRegisterNumber: "CHE-123.456.789",
+		}
+		c.Normalize()
+		if c.Type != datatrans.CustomerTypeCompany || c.Gender != datatrans.GenderFemale {
+			t.Errorf("not normalized: %q %q", c.Type, c.Gender)
+		}
+		must(t, c.Validate())
+	})
+
+	t.Run("company without register number", func(t *testing.T) {
+		err := datatrans.Customer{Type: datatrans.CustomerTypeCompany, Name: "Globus AG"}.Validate()
+		if have := fmt.Sprint(err); have != "Customer: companyRegisterNumber required" {
+			t.Errorf("invalid error: %q", have)
+		}
+	})
+
+	t.Run("bad gender", func(t *testing.T) {
+		c := datatrans.Customer{Gender: "x"}
+		c.Normalize()
+		err := c.Validate()
+		if have := fmt.Sprint(err); have != `Customer: gender must be "female" or "male"` {
+			t.Errorf("invalid error: %q", have)
+		}
+	})
+}
+
+func TestCustomer_Validate_BirthDate(t *testing.T) {
+	var c datatrans.Customer
+	c.SetBirthDate(time.Date(1984, 3, 7, 23, 0, 0, 0, time.UTC))
+	if c.BirthDate != "1984-03-07" {
+		t.Errorf("invalid BirthDate: %q", c.BirthDate)
+	}
+	must(t, c.Validate())
+
+	c.BirthDate = "07.03.1984"
+	if have := fmt.Sprint(c.Validate()); have != "Customer: birthDate must be formatted as YYYY-MM-DD" {
+		t.Errorf("invalid error: %q", have)
+	}
+}
+
+func TestLineItems(t *testing.T) {
+	var body string
+	c, err := datatrans.MakeClient(
+		datatrans.OptionStrictValidation(true),
+		datatrans.OptionHTTPRequestFn(func(req *http.Request) (*http.Response, error) {
+			data, _ := ioutil.ReadAll(req.Body)
+			body = string(data)
+			return &http.Response{
+				StatusCode: 201,
+				Body:       ioutil.NopCloser(strings.NewReader(`{"transactionId":"210215103033478409"}`)),
+			}, nil
+		}),
+		datatrans.OptionMerchant{
+			MerchantID: "322342",
+			Password:   "sfdgsdfg",
+		},
+	)
+	must(t, err)
+
+	ri := datatrans.RequestInitialize{
+		Currency:       "CHF",
+		RefNo:          "872732",
+		Amount:         2500,
+		PaymentMethods: []string{datatrans.PaymentMethodKLN},
+		Items: []datatrans.LineItem{
+			{ID: "1", Name: "Socks", Quantity: 2, UnitPrice: 1000, TaxRate: 7.7, TaxAmount: 143},
+			{Name: "Shipping", Type: "shipping", Quantity: 1, UnitPrice: 500},
+		},
+	}
+	_, err = c.Initialize(context.Background(), ri)
+	must(t, err)
+	const wantBody = `{"amount":2500,"currency":"CHF","order":{"articles":[{"id":"1","name":"Socks","quantity":2,"price":1000,"taxPercent":7.7,"tax":143},{"name":"Shipping","type":"shipping","quantity":1,"price":500}]},"paymentMethods":["KLN"],"refno":"872732"}`
+	if body != wantBody {
+		t.Errorf("\nWant: %s\nHave: %s", wantBody, body)
+	}
+
+	ri.Amount = 2400
+	_, err = c.Initialize(context.Background(), ri)
+	if have := fmt.Sprint(err); have != "RequestInitialize: order.articles total 2500 does not match amount 2400" {
+		t.Errorf("invalid error: %q", have)
+	}
+
+	_, err = c.Authorize(context.Background(), datatrans.RequestAuthorize{
+		Currency: "CHF",
+		RefNo:    "872732",
+		Amount:   100,
+		Items:    ri.Items,
+	})
+	if have := fmt.Sprint(err); have != "RequestAuthorize: order.articles total 2500 does not match amount 100" {
+		t.Errorf("invalid error: %q", have)
+	}
+}
+
+func TestThreeDIndicators_Validate(t *testing.T) {
+	for _, am := range []datatrans.AddrMatch{"", datatrans.AddrMatchYes, datatrans.AddrMatchNo} {
+		must(t, datatrans.Cardholder{AddrMatch: am}.Validate())
+	}
+	for _, am := range []datatrans.AddrMatch{"y", "yes", "1"} {
+		if err := (datatrans.Cardholder{AddrMatch: am}).Validate(); err == nil || err.Error() != `Cardholder: addrMatch must be "Y" or "N"` {
+			t.Errorf("%q: invalid error: %v", am, err)
+		}
+	}
+
+	for _, si := range []datatrans.ShipIndicator{"", datatrans.ShipIndicatorBillingAddress, datatrans.ShipIndicatorDigitalGoods, datatrans.ShipIndicatorOther} {
+		must(t, datatrans.MerchantRiskIndicator{ShipIndicator: si}.Validate())
+	}
+	for _, si := range []datatrans.ShipIndicator{"00", "08", "1", "001", "A1"} {
+		if err := (datatrans.MerchantRiskIndicator{ShipIndicator: si}).Validate(); err == nil || err.Error() != "MerchantRiskIndicator: shipIndicator must be a code from 01 to 07" {
+			t.Errorf("%q: invalid error: %v", si, err)
+		}
+	}
+
+	must(t, datatrans.AcctInfo{ChAccPwChangeInd: "05", PaymentAccInd: "01"}.Validate())
+	if err := (datatrans.AcctInfo{ShipNameIndicator: "03"}).Validate(); err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestClient_Authorize_StrictValidationThreeD(t *testing.T) {
+	c, err := datatrans.MakeClient(
+		datatrans.OptionStrictValidation(true),
+		datatrans.OptionHTTPRequestFn(func(req *http.Request) (*http.Response, error) {
+			t.Fatal("no request expected")
+			return nil, nil
+		}),
+		datatrans.OptionMerchant{
+			MerchantID: "322342",
+			Password:   "sfdgsdfg",
+		},
+	)
+	must(t, err)
+
+	_, err = c.Authorize(context.Background(), datatrans.RequestAuthorize{
+		Currency: "CHF",
+		RefNo:    "872732",
+		Amount:   1337,
+		Card: &datatrans.Card{
+			ThreeD: datatrans.ThreeD{
+				Purchase: &datatrans.Purchase{
+					MerchantRiskIndicator: datatrans.MerchantRiskIndicator{ShipIndicator: "8"},
+				},
+			},
+		},
+	})
+	var ve datatrans.ValidationError
+	if !errors.As(err, &ve) || ve.Type != "MerchantRiskIndicator" {
+		t.Errorf("expected a MerchantRiskIndicator ValidationError, got: %v", err)
+	}
+}
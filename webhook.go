@@ -2,26 +2,100 @@ package datatrans
 
 import (
 	"bytes"
+	"context"
 	"crypto/hmac"
 	"crypto/sha256"
+	"encoding/base64"
 	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 )
 
 var (
 	ErrWebhookMissingSignature  = errors.New("malformed header Datatrans-Signature")
 	ErrWebhookMismatchSignature = errors.New("mismatch of Datatrans-Signature")
+	ErrWebhookMethodNotAllowed  = errors.New("HTTP method not allowed for webhook")
 )
 
 // https://api-reference.datatrans.ch/#section/Webhook/Webhook-signing
 type WebhookOption struct {
-	Sign2HMACKey string                   // hex encoded
+	Sign2HMACKey string // hex encoded
+	// Keys contains additional hex encoded keys by their key ID for a zero
+	// downtime rollover. If the signature header contains a key ID, e.g.
+	// "t=...,kid=2,s0=...", only the key with that ID gets used, otherwise
+	// Sign2HMACKey and all Keys get tried. Sign2HMACKey can be left empty if
+	// Keys is set.
+	Keys         map[string]string
 	ErrorHandler func(error) http.Handler // optional custom error handler
+	// SignatureHeader defines the name of the HTTP header which contains the
+	// signature. Default: Datatrans-Signature
+	SignatureHeader string
+	// Methods lists the allowed HTTP methods, other methods get rejected with
+	// ErrWebhookMethodNotAllowed before the signature gets checked. Default:
+	// POST
+	Methods []string
+	// ParseStatus unmarshals the validated body into a ResponseStatus which
+	// is available via WebhookFromContext. The body stays readable.
+	ParseStatus bool
+}
+
+// Webhook contains the data of a validated webhook request.
+type Webhook struct {
+	Timestamp string          // raw value of the signature timestamp in milliseconds
+	Time      time.Time       // parsed Timestamp, zero if not parseable
+	Status    *ResponseStatus // only set with WebhookOption.ParseStatus
+}
+
+type ctxKeyWebhook struct{}
+
+// WebhookFromContext returns the webhook data stored by the ValidateWebhook
+// middleware.
+func WebhookFromContext(ctx context.Context) (Webhook, bool) {
+	wh, ok := ctx.Value(ctxKeyWebhook{}).(Webhook)
+	return wh, ok
+}
+
+// ValidateWebhookKey checks that hexKey is a usable Sign2HMACKey. Call it at
+// startup to detect a misconfigured key before the first webhook arrives.
+func ValidateWebhookKey(hexKey string) error {
+	_, err := decodeWebhookKey(hexKey)
+	return err
+}
+
+func decodeWebhookKey(hexKey string) ([]byte, error) {
+	if hexKey == "" {
+		return nil, errors.New("Sign2HMACKey cannot be empty")
+	}
+	key, err := hex.DecodeString(hexKey)
+	if err == nil {
+		return key, nil
+	}
+	if looksLikeBase64(hexKey) {
+		return nil, fmt.Errorf("failed to hex decode Sign2HMACKey of length %d, it seems to be base64 encoded, copy the hex encoded key from the datatrans web administration tool: %w", len(hexKey), err)
+	}
+	return nil, fmt.Errorf("failed to hex decode Sign2HMACKey of length %d: %w", len(hexKey), err)
+}
+
+// looksLikeBase64 reports whether s is not made of hex digits only and decodes
+// as standard or URL base64.
+func looksLikeBase64(s string) bool {
+	if strings.Trim(s, "0123456789abcdefABCDEF") == "" {
+		return false
+	}
+	for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding} {
+		if _, err := enc.DecodeString(s); err == nil {
+			return true
+		}
+	}
+	return false
 }
 
 // ValidateWebhook an HTTP middleware which checks that the signature in the header is valid.
@@ -34,26 +108,38 @@ func ValidateWebhook(wo WebhookOption) (func(next http.Handler) http.Handler, er
 		}
 	}
 
-	key, err := hex.DecodeString(wo.Sign2HMACKey)
+	if wo.SignatureHeader == "" {
+		wo.SignatureHeader = "Datatrans-Signature"
+	}
+
+	keys, err := decodeWebhookKeys(wo)
 	if err != nil {
-		return nil, fmt.Errorf("failed to hex decode Sign2HMACKey")
+		return nil, err
+	}
+
+	if len(wo.Methods) == 0 {
+		wo.Methods = []string{http.MethodPost}
 	}
 
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !methodAllowed(wo.Methods, r.Method) {
+				wo.ErrorHandler(fmt.Errorf("%s: %w", r.Method, ErrWebhookMethodNotAllowed)).ServeHTTP(w, r)
+				return
+			}
+
 			// Datatrans-Signature: t=1559303131511,s0=33819a1220fd8e38fc5bad3f57ef31095fac0deb38c001ba347e694f48ffe2fc
 
-			tm, s0 := extractTimeAndHash(r.Header.Get("Datatrans-Signature"))
-			if tm == "" || len(s0) == 0 {
+			// proxies might add their own copy of the header, so each value
+			// gets tried until one matches.
+			sigs := parseSignatures(r.Header.Values(wo.SignatureHeader))
+			if len(sigs) == 0 {
 				wo.ErrorHandler(ErrWebhookMissingSignature).ServeHTTP(w, r)
 				return
 			}
 
-			hmv := hmac.New(sha256.New, key)
-			hmv.Write([]byte(tm))
-
 			var buf bytes.Buffer
-			if _, err := io.Copy(io.MultiWriter(&buf, hmv), r.Body); err != nil {
+			if _, err := io.Copy(&buf, r.Body); err != nil {
 				_ = r.Body.Close()
 				wo.ErrorHandler(err).ServeHTTP(w, r)
 				return
@@ -61,31 +147,151 @@ func ValidateWebhook(wo WebhookOption) (func(next http.Handler) http.Handler, er
 			_ = r.Body.Close()
 			r.Body = ioutil.NopCloser(&buf)
 
-			if !hmac.Equal(hmv.Sum(nil), s0) {
-				wo.ErrorHandler(ErrWebhookMismatchSignature).ServeHTTP(w, r)
+			tm, err := verifySignatures(keys, sigs, buf.Bytes())
+			if err != nil {
+				wo.ErrorHandler(err).ServeHTTP(w, r)
 				return
 			}
 
+			wh := Webhook{Timestamp: tm}
+			if ms, err := strconv.ParseInt(tm, 10, 64); err == nil {
+				wh.Time = time.Unix(0, ms*int64(time.Millisecond))
+			}
+			if wo.ParseStatus {
+				wh.Status = new(ResponseStatus)
+				if err := json.Unmarshal(buf.Bytes(), wh.Status); err != nil {
+					wo.ErrorHandler(fmt.Errorf("failed to unmarshal webhook body: %w", err)).ServeHTTP(w, r)
+					return
+				}
+				wh.Status.setJSONRawBody(buf.Bytes())
+			}
+			r = r.WithContext(context.WithValue(r.Context(), ctxKeyWebhook{}, wh))
+
 			next.ServeHTTP(w, r)
 		})
 	}, nil
 }
 
-func extractTimeAndHash(headerValue string) (time string, s0hashB []byte) {
-	lhv := len(headerValue)
-	if lhv == 0 {
-		return "", nil
+// VerifyWebhookSignature checks the signature header value of a webhook
+// against body like the ValidateWebhook middleware, for frameworks which do
+// not use net/http handlers. Only the keys of opt are used. It returns
+// ErrWebhookMissingSignature, ErrWebhookMismatchSignature or an error about
+// invalid keys.
+func VerifyWebhookSignature(opt WebhookOption, header string, body []byte) error {
+	keys, err := decodeWebhookKeys(opt)
+	if err != nil {
+		return err
+	}
+	_, err = verifySignatures(keys, parseSignatures([]string{header}), body)
+	return err
+}
+
+// verifySignatures returns the time of the first signature matching body with
+// one of the keys.
+func verifySignatures(keys []webhookKey, sigs []signature, body []byte) (string, error) {
+	if len(sigs) == 0 {
+		return "", ErrWebhookMissingSignature
+	}
+	for _, sig := range sigs {
+		for _, k := range keys {
+			if sig.kid != "" && sig.kid != k.id {
+				continue
+			}
+			hmv := hmac.New(sha256.New, k.key)
+			hmv.Write([]byte(sig.time))
+			hmv.Write(body)
+			if hmac.Equal(hmv.Sum(nil), sig.s0) {
+				return sig.time, nil
+			}
+		}
+	}
+	return "", ErrWebhookMismatchSignature
+}
+
+func methodAllowed(methods []string, method string) bool {
+	for _, m := range methods {
+		if strings.EqualFold(m, method) {
+			return true
+		}
+	}
+	return false
+}
+
+type signature struct {
+	time string
+	kid  string // optional key ID
+	s0   []byte
+}
+
+// parseSignature parses the comma separated key=value pairs of the signature
+// header. Unknown pairs get ignored.
+func parseSignature(headerValue string) signature {
+	var sig signature
+	for _, pair := range strings.Split(headerValue, ",") {
+		eq := strings.IndexByte(pair, '=')
+		if eq < 1 {
+			continue
+		}
+		switch v := pair[eq+1:]; pair[:eq] {
+		case "t":
+			sig.time = v
+		case "kid":
+			sig.kid = v
+		case "s0":
+			sig.s0, _ = hex.DecodeString(v)
+		}
+	}
+	if sig.time == "" || len(sig.s0) == 0 {
+		return signature{}
 	}
-	commaIDX := strings.IndexRune(headerValue, ',')
-	if commaIDX < 1 {
-		return "", nil
+	return sig
+}
+
+// parseSignatures returns the valid signatures of the header values.
+func parseSignatures(headerValues []string) []signature {
+	var sigs []signature
+	for _, hv := range headerValues {
+		if sig := parseSignature(hv); sig.time != "" && len(sig.s0) > 0 {
+			sigs = append(sigs, sig)
+		}
 	}
+	return sigs
+}
+
+func extractTimeAndHash(headerValue string) (time string, s0hashB []byte) {
+	sig := parseSignature(headerValue)
+	return sig.time, sig.s0
+}
+
+type webhookKey struct {
+	id  string
+	key []byte
+}
 
-	time = headerValue[2:commaIDX]
-	if lhv < commaIDX+4 {
-		return "", nil
+// decodeWebhookKeys returns Sign2HMACKey followed by the Keys sorted by ID.
+func decodeWebhookKeys(wo WebhookOption) ([]webhookKey, error) {
+	var keys []webhookKey
+	if wo.Sign2HMACKey != "" || len(wo.Keys) == 0 {
+		key, err := decodeWebhookKey(wo.Sign2HMACKey)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, webhookKey{key: key})
+	}
+	ids := make([]string, 0, len(wo.Keys))
+	for id := range wo.Keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		if id == "" {
+			return nil, errors.New("Keys: key ID cannot be empty")
+		}
+		key, err := decodeWebhookKey(wo.Keys[id])
+		if err != nil {
+			return nil, fmt.Errorf("Keys[%q]: %w", id, err)
+		}
+		keys = append(keys, webhookKey{id: id, key: key})
 	}
-	s0hash := headerValue[commaIDX+4:]
-	s0hashB, _ = hex.DecodeString(s0hash)
-	return time, s0hashB
+	return keys, nil
 }
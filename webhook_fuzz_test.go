@@ -0,0 +1,33 @@
+//go:build go1.18
+// +build go1.18
+
+package datatrans
+
+import (
+	"strings"
+	"testing"
+)
+
+func FuzzExtractTimeAndHash(f *testing.F) {
+	for _, seed := range []string{
+		"t=1559303131511,s0=33819a1220fd8e38fc5bad3f57ef31095fac0deb38c001ba347e694f48ffe2fc",
+		"t=1559303131511,kid=2,s0=3381",
+		"t=,s0=",
+		"",
+		"t=1559303131511s0=33",
+		",t=1559303131511s0=33",
+		"t=1559303131511s0=33,",
+		",",
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, headerValue string) {
+		tm, s0 := extractTimeAndHash(headerValue)
+		if (tm == "") != (len(s0) == 0) {
+			t.Errorf("time and hash must be both set or both empty: %q %x", tm, s0)
+		}
+		if strings.Contains(tm, ",") {
+			t.Errorf("time contains a separator: %q", tm)
+		}
+	})
+}
@@ -5,10 +5,12 @@ import (
 	"crypto/hmac"
 	"crypto/sha256"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 )
 
 func must(t *testing.T, err error) {
@@ -31,6 +33,12 @@ func Test_extractTimeAndHash(t *testing.T) {
 			wantTime:    "1559303131511",
 			wantS0hash:  []byte{0x33, 0x81, 0x9a, 0x12, 0x20, 0xfd, 0x8e, 0x38, 0xfc, 0x5b, 0xad, 0x3f, 0x57, 0xef, 0x31, 0x9, 0x5f, 0xac, 0xd, 0xeb, 0x38, 0xc0, 0x1, 0xba, 0x34, 0x7e, 0x69, 0x4f, 0x48, 0xff, 0xe2, 0xfc},
 		},
+		{
+			name:        "with key id",
+			headerValue: "t=1559303131511,kid=2,s0=3381",
+			wantTime:    "1559303131511",
+			wantS0hash:  []byte{0x33, 0x81},
+		},
 		{
 			name:        "empty vals",
 			headerValue: "t=,s0=",
@@ -93,3 +101,242 @@ func TestValidateWebhook(t *testing.T) {
 		t.Error("something is wrong")
 	}
 }
+
+func TestValidateWebhook_Context(t *testing.T) {
+	sign2Key := []byte(`asdfasd^%@^&%fa`)
+	const timeStr = `1559303131511`
+
+	mw, err := ValidateWebhook(WebhookOption{
+		Sign2HMACKey: "617364666173645e25405e26256661",
+		ParseStatus:  true,
+	})
+	must(t, err)
+
+	const datatransBody = `{"transactionId": "210215103042148501", "status": "settled"}`
+	r := httptest.NewRequest("POST", "/", strings.NewReader(datatransBody))
+
+	ht := hmac.New(sha256.New, sign2Key)
+	fmt.Fprintf(ht, "%s%s", timeStr, datatransBody)
+	r.Header.Set("Datatrans-Signature", fmt.Sprintf("t=%s,s0=%x", timeStr, ht.Sum(nil)))
+
+	w := httptest.NewRecorder()
+	mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		wh, ok := WebhookFromContext(r.Context())
+		if !ok {
+			t.Fatal("webhook not found in context")
+		}
+		if wh.Timestamp != timeStr {
+			t.Errorf("invalid timestamp: %q", wh.Timestamp)
+		}
+		if want := time.Date(2019, 5, 31, 11, 45, 31, 511000000, time.UTC); !wh.Time.Equal(want) {
+			t.Errorf("invalid time: %s", wh.Time)
+		}
+		if wh.Status == nil || wh.Status.TransactionID != "210215103042148501" || wh.Status.Status != "settled" {
+			t.Errorf("invalid status: %#v", wh.Status)
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		if string(body) != datatransBody {
+			t.Errorf("body not readable: %q", body)
+		}
+		fmt.Fprintf(w, "success")
+	})).ServeHTTP(w, r)
+
+	if w.Body.String() != "success" {
+		t.Error("something is wrong")
+	}
+}
+
+func TestValidateWebhook_SignatureHeader(t *testing.T) {
+	sign2Key := []byte(`asdfasd^%@^&%fa`)
+	const timeStr = `1559303131511`
+	const datatransBody = `{"transactionId": "210215103042148501"}`
+
+	ht := hmac.New(sha256.New, sign2Key)
+	fmt.Fprintf(ht, "%s%s", timeStr, datatransBody)
+	validSig := fmt.Sprintf("t=%s,s0=%x", timeStr, ht.Sum(nil))
+
+	serve := func(wo WebhookOption, header http.Header) string {
+		mw, err := ValidateWebhook(wo)
+		must(t, err)
+		r := httptest.NewRequest("POST", "/", strings.NewReader(datatransBody))
+		r.Header = header
+		w := httptest.NewRecorder()
+		mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, "success")
+		})).ServeHTTP(w, r)
+		return w.Body.String()
+	}
+
+	t.Run("renamed header", func(t *testing.T) {
+		header := http.Header{}
+		header.Set("X-Upstream-Signature", validSig)
+		body := serve(WebhookOption{
+			Sign2HMACKey:    "617364666173645e25405e26256661",
+			SignatureHeader: "X-Upstream-Signature",
+		}, header)
+		if body != "success" {
+			t.Errorf("something is wrong: %q", body)
+		}
+	})
+
+	t.Run("multiple values", func(t *testing.T) {
+		header := http.Header{}
+		header.Add("Datatrans-Signature", "t=1559303131511,s0=33819a1220fd8e38fc5bad3f57ef31095fac0deb38c001ba347e694f48ffe2fc")
+		header.Add("Datatrans-Signature", validSig)
+		body := serve(WebhookOption{
+			Sign2HMACKey: "617364666173645e25405e26256661",
+		}, header)
+		if body != "success" {
+			t.Errorf("something is wrong: %q", body)
+		}
+	})
+
+	t.Run("multiple invalid values", func(t *testing.T) {
+		header := http.Header{}
+		header.Add("Datatrans-Signature", "t=1559303131511,s0=33819a1220fd8e38fc5bad3f57ef31095fac0deb38c001ba347e694f48ffe2fc")
+		header.Add("Datatrans-Signature", "garbage")
+		body := serve(WebhookOption{
+			Sign2HMACKey: "617364666173645e25405e26256661",
+		}, header)
+		if !strings.Contains(body, ErrWebhookMismatchSignature.Error()) {
+			t.Errorf("expected mismatch error: %q", body)
+		}
+	})
+}
+
+func TestValidateWebhook_Keys(t *testing.T) {
+	const timeStr = `1559303131511`
+	const datatransBody = `{"transactionId": "210215103042148501"}`
+	oldKey, newKey := []byte(`asdfasd^%@^&%fa`), []byte(`new-secret-key`)
+
+	sign := func(key []byte, kid string) string {
+		ht := hmac.New(sha256.New, key)
+		fmt.Fprintf(ht, "%s%s", timeStr, datatransBody)
+		if kid != "" {
+			return fmt.Sprintf("t=%s,kid=%s,s0=%x", timeStr, kid, ht.Sum(nil))
+		}
+		return fmt.Sprintf("t=%s,s0=%x", timeStr, ht.Sum(nil))
+	}
+
+	mw, err := ValidateWebhook(WebhookOption{
+		Keys: map[string]string{
+			"1": fmt.Sprintf("%x", oldKey),
+			"2": fmt.Sprintf("%x", newKey),
+		},
+	})
+	must(t, err)
+	serve := func(sig string) string {
+		r := httptest.NewRequest("POST", "/", strings.NewReader(datatransBody))
+		r.Header.Set("Datatrans-Signature", sig)
+		w := httptest.NewRecorder()
+		mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, "success")
+		})).ServeHTTP(w, r)
+		return w.Body.String()
+	}
+
+	tests := []struct {
+		name string
+		sig  string
+		want bool
+	}{
+		{"matching id", sign(newKey, "2"), true},
+		{"matching old id", sign(oldKey, "1"), true},
+		{"wrong id", sign(newKey, "1"), false},
+		{"unknown id", sign(newKey, "3"), false},
+		{"no id fallback new key", sign(newKey, ""), true},
+		{"no id fallback old key", sign(oldKey, ""), true},
+		{"no id unknown key", sign([]byte("other"), ""), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if body := serve(tt.sig); (body == "success") != tt.want {
+				t.Errorf("unexpected result: %q", body)
+			}
+		})
+	}
+
+	if _, err := ValidateWebhook(WebhookOption{Keys: map[string]string{"2": "YXNkZmFzZF4lQF4mJWZh"}}); err == nil || !strings.Contains(err.Error(), `Keys["2"]`) {
+		t.Errorf("expected an error for the invalid key, got: %v", err)
+	}
+}
+
+func TestValidateWebhook_Methods(t *testing.T) {
+	sign2Key := []byte(`asdfasd^%@^&%fa`)
+	const timeStr = `1559303131511`
+	ht := hmac.New(sha256.New, sign2Key)
+	fmt.Fprintf(ht, "%s", timeStr) // empty body
+	validSig := fmt.Sprintf("t=%s,s0=%x", timeStr, ht.Sum(nil))
+
+	serve := func(wo WebhookOption, method string) string {
+		wo.Sign2HMACKey = "617364666173645e25405e26256661"
+		mw, err := ValidateWebhook(wo)
+		must(t, err)
+		r := httptest.NewRequest(method, "/", nil)
+		r.Header.Set("Datatrans-Signature", validSig)
+		w := httptest.NewRecorder()
+		mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, "success")
+		})).ServeHTTP(w, r)
+		return w.Body.String()
+	}
+
+	if body := serve(WebhookOption{}, http.MethodPost); body != "success" {
+		t.Errorf("POST should be allowed: %q", body)
+	}
+	if body := serve(WebhookOption{}, http.MethodGet); !strings.Contains(body, ErrWebhookMethodNotAllowed.Error()) {
+		t.Errorf("GET should be rejected: %q", body)
+	}
+	if body := serve(WebhookOption{Methods: []string{http.MethodPost, http.MethodPut}}, http.MethodPut); body != "success" {
+		t.Errorf("PUT should be allowed: %q", body)
+	}
+}
+
+func TestVerifyWebhookSignature(t *testing.T) {
+	sign2Key := []byte(`asdfasd^%@^&%fa`)
+	const timeStr = `1559303131511`
+	const datatransBody = `{"transactionId": "210215103042148501"}`
+	ht := hmac.New(sha256.New, sign2Key)
+	fmt.Fprintf(ht, "%s%s", timeStr, datatransBody)
+	header := fmt.Sprintf("t=%s,s0=%x", timeStr, ht.Sum(nil))
+	wo := WebhookOption{Sign2HMACKey: "617364666173645e25405e26256661"}
+
+	must(t, VerifyWebhookSignature(wo, header, []byte(datatransBody)))
+
+	tampered := strings.Replace(datatransBody, "501", "502", 1)
+	if err := VerifyWebhookSignature(wo, header, []byte(tampered)); err != ErrWebhookMismatchSignature {
+		t.Errorf("expected ErrWebhookMismatchSignature, got: %v", err)
+	}
+	if err := VerifyWebhookSignature(wo, "garbage", []byte(datatransBody)); err != ErrWebhookMissingSignature {
+		t.Errorf("expected ErrWebhookMissingSignature, got: %v", err)
+	}
+	if err := VerifyWebhookSignature(WebhookOption{}, header, []byte(datatransBody)); err == nil {
+		t.Error("expected an error for a missing key")
+	}
+}
+
+func TestValidateWebhookKey(t *testing.T) {
+	must(t, ValidateWebhookKey("617364666173645e25405e26256661"))
+
+	tests := []struct {
+		name    string
+		key     string
+		wantMsg string
+	}{
+		{"empty", "", "cannot be empty"},
+		{"odd length", "617364666173645e25405e2625666", "length 29: encoding/hex: odd length hex string"},
+		{"base64", "YXNkZmFzZF4lQF4mJWZh", "seems to be base64 encoded"},
+		{"garbage", "not a key!", "length 10: encoding/hex: invalid byte"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateWebhookKey(tt.key)
+			if err == nil || !strings.Contains(err.Error(), tt.wantMsg) {
+				t.Errorf("expected error containing %q, got: %v", tt.wantMsg, err)
+			}
+			if _, err2 := ValidateWebhook(WebhookOption{Sign2HMACKey: tt.key}); err2 == nil || err2.Error() != err.Error() {
+				t.Errorf("ValidateWebhook should return the same error, got: %v", err2)
+			}
+		})
+	}
+}